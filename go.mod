@@ -2,4 +2,18 @@ module go-onnxruntime-example
 
 go 1.20
 
-require github.com/yam8511/go-onnxruntime v1.3.0
+require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/yam8511/go-onnxruntime v1.3.0
+)
+
+require (
+	github.com/gorilla/websocket v1.5.0 // indirect
+	golang.org/x/net v0.27.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+)
+
+require (
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.16.0 // indirect
+)
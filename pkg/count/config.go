@@ -0,0 +1,79 @@
+package count
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+)
+
+// Line 計數線, 由多個點組成的折線.
+// 物件由折線行進方向的左側跨到右側 (影像座標, y 向下) 記為 in, 反之為 out
+type Line struct {
+	Name   string
+	Points []image.Point
+}
+
+// Zone 計數區域, 以多邊形表示
+type Zone struct {
+	Name   string
+	Points []image.Point
+}
+
+// Config 計數線及區域的設定
+type Config struct {
+	Lines []Line
+	Zones []Zone
+}
+
+type shapeFile struct {
+	Name   string   `json:"name"`
+	Points [][2]int `json:"points"`
+}
+
+type configFile struct {
+	Lines []shapeFile `json:"lines"`
+	Zones []shapeFile `json:"zones"`
+}
+
+func toPoints(pts [][2]int) []image.Point {
+	points := make([]image.Point, len(pts))
+	for i, p := range pts {
+		points[i] = image.Pt(p[0], p[1])
+	}
+	return points
+}
+
+// LoadConfig 讀取 JSON 設定:
+// {"lines": [{"name": "door", "points": [[x, y], ...]}], "zones": [{"name": "queue", "points": [[x, y], ...]}]}
+func LoadConfig(filename string) (Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	f := configFile{}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{}
+	for i, l := range f.Lines {
+		if len(l.Points) < 2 {
+			return cfg, fmt.Errorf("line %d needs at least 2 points", i)
+		}
+		if l.Name == "" {
+			l.Name = fmt.Sprintf("line_%d", i)
+		}
+		cfg.Lines = append(cfg.Lines, Line{Name: l.Name, Points: toPoints(l.Points)})
+	}
+	for i, z := range f.Zones {
+		if len(z.Points) < 3 {
+			return cfg, fmt.Errorf("zone %d needs at least 3 points", i)
+		}
+		if z.Name == "" {
+			z.Name = fmt.Sprintf("zone_%d", i)
+		}
+		cfg.Zones = append(cfg.Zones, Zone{Name: z.Name, Points: toPoints(z.Points)})
+	}
+	return cfg, nil
+}
@@ -0,0 +1,258 @@
+package count
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Object 已追蹤的偵測結果
+type Object struct {
+	TrackID int
+	Label   string
+	Box     image.Rectangle
+}
+
+// Anchor 判斷跨線及區域所用的點: 框的底部中心 (腳的位置)
+func Anchor(box image.Rectangle) image.Point {
+	return image.Pt((box.Min.X+box.Max.X)/2, box.Max.Y)
+}
+
+type trackState struct {
+	label  string
+	anchor image.Point
+	seen   float64
+	enter  map[int]float64 // 區域索引對應進入的時間
+}
+
+// Counter 統計跨線方向及區域的人數與停留時間
+type Counter struct {
+	cfg    Config
+	tracks map[int]*trackState
+	in     []map[string]int // 每條線各類別 in 的次數
+	out    []map[string]int
+	visits []map[string]int // 每個區域各類別進入的次數
+	dwells [][]float64      // 每個區域已離開軌跡的停留時間
+	maxAge float64
+	now    float64
+}
+
+// NewCounter maxAge 秒沒出現的軌跡視為離開
+func NewCounter(cfg Config, maxAge float64) *Counter {
+	c := &Counter{
+		cfg:    cfg,
+		tracks: map[int]*trackState{},
+		maxAge: maxAge,
+	}
+	for range cfg.Lines {
+		c.in = append(c.in, map[string]int{})
+		c.out = append(c.out, map[string]int{})
+	}
+	for range cfg.Zones {
+		c.visits = append(c.visits, map[string]int{})
+		c.dwells = append(c.dwells, []float64{})
+	}
+	return c
+}
+
+func (c *Counter) Config() Config { return c.cfg }
+
+// Event 軌跡跨線或進出區域
+type Event struct {
+	Time    float64 `json:"time"`
+	Type    string  `json:"type"` // in, out (跨線方向) 或 enter, leave (區域)
+	Name    string  `json:"name"` // 線或區域的名稱
+	TrackID int     `json:"track_id"`
+	Label   string  `json:"label"`
+}
+
+// Update 以時間 t (秒) 的追蹤結果更新計數, TrackID 為 0 的物件不計, 回傳這次發生的事件
+func (c *Counter) Update(t float64, objs []Object) []Event {
+	c.now = t
+	events := []Event{}
+	event := func(typ, name string, id int, st *trackState) {
+		events = append(events, Event{Time: t, Type: typ, Name: name, TrackID: id, Label: st.label})
+	}
+	for _, obj := range objs {
+		if obj.TrackID == 0 {
+			continue
+		}
+		anchor := Anchor(obj.Box)
+		st, ok := c.tracks[obj.TrackID]
+		if !ok {
+			st = &trackState{label: obj.Label, anchor: anchor, enter: map[int]float64{}}
+			c.tracks[obj.TrackID] = st
+		} else {
+			for i, line := range c.cfg.Lines {
+				switch crossing(line.Points, st.anchor, anchor) {
+				case 1:
+					c.in[i][st.label]++
+					event("in", line.Name, obj.TrackID, st)
+				case -1:
+					c.out[i][st.label]++
+					event("out", line.Name, obj.TrackID, st)
+				}
+			}
+		}
+		st.anchor = anchor
+		st.seen = t
+
+		for i, zone := range c.cfg.Zones {
+			_, inside := st.enter[i]
+			switch now := contains(zone.Points, anchor); {
+			case now && !inside:
+				st.enter[i] = t
+				c.visits[i][st.label]++
+				event("enter", zone.Name, obj.TrackID, st)
+			case !now && inside:
+				c.leave(st, i)
+				event("leave", zone.Name, obj.TrackID, st)
+			}
+		}
+	}
+
+	for id, st := range c.tracks {
+		if t-st.seen > c.maxAge {
+			for i := range st.enter {
+				c.leave(st, i)
+				event("leave", c.cfg.Zones[i].Name, id, st)
+			}
+			delete(c.tracks, id)
+		}
+	}
+	return events
+}
+
+func (c *Counter) leave(st *trackState, zone int) {
+	c.dwells[zone] = append(c.dwells[zone], st.seen-st.enter[zone])
+	delete(st.enter, zone)
+}
+
+// LineCount 單一計數線的結果
+type LineCount struct {
+	Name string         `json:"name"`
+	In   map[string]int `json:"in"`
+	Out  map[string]int `json:"out"`
+}
+
+// Dwell 目前在區域內的軌跡及停留秒數
+type Dwell struct {
+	TrackID int     `json:"track_id"`
+	Label   string  `json:"label"`
+	Seconds float64 `json:"seconds"`
+}
+
+// ZoneCount 單一區域的結果
+type ZoneCount struct {
+	Name      string         `json:"name"`
+	Occupancy map[string]int `json:"occupancy"` // 目前各類別的數量
+	Visits    map[string]int `json:"visits"`    // 累計各類別進入的次數
+	Current   []Dwell        `json:"current"`   // 目前在區域內的停留時間
+	AvgDwell  float64        `json:"avg_dwell"` // 已離開者的平均停留秒數
+	MaxDwell  float64        `json:"max_dwell"` // 已離開者的最長停留秒數
+}
+
+// Summary 某個時間點的統計
+type Summary struct {
+	Time  float64     `json:"time"`
+	Lines []LineCount `json:"lines"`
+	Zones []ZoneCount `json:"zones"`
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	cp := make(map[string]int, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+func round(v float64) float64 { return math.Round(v*100) / 100 }
+
+// Summary 目前的統計結果
+func (c *Counter) Summary() Summary {
+	s := Summary{Time: round(c.now), Lines: []LineCount{}, Zones: []ZoneCount{}}
+	for i, line := range c.cfg.Lines {
+		s.Lines = append(s.Lines, LineCount{Name: line.Name, In: copyCounts(c.in[i]), Out: copyCounts(c.out[i])})
+	}
+
+	ids := make([]int, 0, len(c.tracks))
+	for id := range c.tracks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for i, zone := range c.cfg.Zones {
+		zc := ZoneCount{
+			Name:      zone.Name,
+			Occupancy: map[string]int{},
+			Visits:    copyCounts(c.visits[i]),
+			Current:   []Dwell{},
+		}
+		for _, id := range ids {
+			st := c.tracks[id]
+			if enter, ok := st.enter[i]; ok {
+				zc.Occupancy[st.label]++
+				zc.Current = append(zc.Current, Dwell{TrackID: id, Label: st.label, Seconds: round(c.now - enter)})
+			}
+		}
+		if n := len(c.dwells[i]); n > 0 {
+			sum := 0.0
+			for _, d := range c.dwells[i] {
+				sum += d
+				zc.MaxDwell = math.Max(zc.MaxDwell, d)
+			}
+			zc.AvgDwell = round(sum / float64(n))
+			zc.MaxDwell = round(zc.MaxDwell)
+		}
+		s.Zones = append(s.Zones, zc)
+	}
+	return s
+}
+
+func cross(o, a, b image.Point) int {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// crossing 移動 p -> q 跨過折線時回傳 1 (左到右, in) 或 -1 (右到左, out), 沒跨過回傳 0.
+// 起點剛好在線上不算, 避免停在線上時重複計數
+func crossing(line []image.Point, p, q image.Point) int {
+	for i := 0; i+1 < len(line); i++ {
+		a, b := line[i], line[i+1]
+		d1 := sign(cross(a, b, p))
+		d2 := sign(cross(a, b, q))
+		d3 := sign(cross(p, q, a))
+		d4 := sign(cross(p, q, b))
+		if d1 != 0 && d1 != d2 && d3 != d4 {
+			// 影像座標 y 向下, cross < 0 為行進方向的左側
+			if d1 < 0 {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// contains 點是否在多邊形內 (射線法)
+func contains(polygon []image.Point, p image.Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			float64(p.X) < float64(b.X-a.X)*float64(p.Y-a.Y)/float64(b.Y-a.Y)+float64(a.X) {
+			inside = !inside
+		}
+	}
+	return inside
+}
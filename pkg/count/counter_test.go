@@ -0,0 +1,116 @@
+package count
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+// 水平線由左往右畫, 影像座標 y 向下, 行進方向的左側為畫面上方
+var door = []image.Point{{0, 100}, {200, 100}}
+
+func TestCrossing(t *testing.T) {
+	cases := []struct {
+		name string
+		line []image.Point
+		p, q image.Point
+		want int
+	}{
+		{"top to bottom is in", door, image.Pt(100, 50), image.Pt(100, 150), 1},
+		{"bottom to top is out", door, image.Pt(100, 150), image.Pt(100, 50), -1},
+		{"reversed line", []image.Point{{200, 100}, {0, 100}}, image.Pt(100, 50), image.Pt(100, 150), -1},
+		{"line drawn downwards, screen right to left is in", []image.Point{{100, 0}, {100, 200}}, image.Pt(150, 50), image.Pt(50, 50), 1},
+		{"beyond the end", door, image.Pt(250, 50), image.Pt(250, 150), 0},
+		{"same side", door, image.Pt(50, 50), image.Pt(150, 90), 0},
+		{"start on the line", door, image.Pt(100, 100), image.Pt(100, 150), 0},
+		{"end on the line", door, image.Pt(100, 50), image.Pt(100, 100), 1},
+		{"second segment of a polyline", []image.Point{{0, 0}, {100, 100}, {200, 0}}, image.Pt(150, 100), image.Pt(150, 0), -1},
+	}
+	for _, c := range cases {
+		if got := crossing(c.line, c.p, c.q); got != c.want {
+			t.Errorf("%s: crossing %v -> %v = %d, want %d", c.name, c.p, c.q, got, c.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	// L 形的凹多邊形, 右下角 (50..100, 50..100) 不在裡面
+	l := []image.Point{{0, 0}, {100, 0}, {100, 50}, {50, 50}, {50, 100}, {0, 100}}
+	cases := []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(25, 25), true},
+		{image.Pt(75, 25), true},
+		{image.Pt(25, 75), true},
+		{image.Pt(75, 75), false},
+		{image.Pt(150, 25), false},
+		{image.Pt(-1, 50), false},
+	}
+	for _, c := range cases {
+		if got := contains(l, c.p); got != c.want {
+			t.Errorf("contains %v = %v, want %v", c.p, got, c.want)
+		}
+	}
+}
+
+// at 底部中心在 (x, y) 的框
+func at(id int, label string, x, y int) Object {
+	return Object{TrackID: id, Label: label, Box: image.Rect(x-10, y-40, x+10, y)}
+}
+
+func TestCounterUpdate(t *testing.T) {
+	cfg := Config{
+		Lines: []Line{{Name: "door", Points: door}},
+		Zones: []Zone{{Name: "queue", Points: []image.Point{{0, 0}, {100, 0}, {100, 80}, {0, 80}}}},
+	}
+	c := NewCounter(cfg, 2)
+	steps := []struct {
+		t    float64
+		objs []Object
+		want string // 依序發生的事件
+	}{
+		{0, []Object{at(1, "person", 50, 50), at(0, "person", 50, 50)}, "[enter queue 1]"}, // 沒有追蹤 ID 的不計
+		{1, []Object{at(1, "person", 50, 150)}, "[in door 1 leave queue 1]"},
+		{2, []Object{at(1, "person", 50, 50), at(2, "car", 150, 150)}, "[out door 1 enter queue 1]"},
+		{3, []Object{at(1, "person", 60, 60), at(2, "car", 150, 50)}, "[out door 2]"},
+		{4.5, []Object{at(2, "car", 150, 40)}, "[]"}, // 1 只消失 1.5 秒, 還在區域內
+		{6, nil, "[leave queue 1]"}, // 消失超過 2 秒視為離開
+		{7, nil, "[]"},
+	}
+	for _, s := range steps {
+		got := []string{}
+		for _, ev := range c.Update(s.t, s.objs) {
+			if ev.Time != s.t {
+				t.Errorf("t=%v: event time %v", s.t, ev.Time)
+			}
+			got = append(got, fmt.Sprintf("%s %s %d", ev.Type, ev.Name, ev.TrackID))
+		}
+		if fmt.Sprint(got) != s.want {
+			t.Errorf("t=%v: events %v, want %s", s.t, got, s.want)
+		}
+		if s.t == 4.5 {
+			zone := c.Summary().Zones[0]
+			if zone.Occupancy["person"] != 1 || len(zone.Current) != 1 || zone.Current[0].Seconds != 2.5 {
+				t.Errorf("t=4.5: queue %+v, want track 1 dwelling 2.5s", zone)
+			}
+		}
+	}
+
+	s := c.Summary()
+	line := s.Lines[0]
+	if line.In["person"] != 1 || line.Out["person"] != 1 || line.Out["car"] != 1 || line.In["car"] != 0 {
+		t.Errorf("door in %v out %v", line.In, line.Out)
+	}
+	zone := s.Zones[0]
+	if zone.Visits["person"] != 2 || zone.Occupancy["person"] != 0 || len(zone.Current) != 0 {
+		t.Errorf("queue %+v", zone)
+	}
+	// 停留 0..1 秒, 以及 2..3 秒 (最後看到的時間)
+	if zone.AvgDwell != 1 || zone.MaxDwell != 1 {
+		t.Errorf("dwell avg %v max %v, want 1 and 1", zone.AvgDwell, zone.MaxDwell)
+	}
+	if len(c.tracks) != 0 {
+		t.Errorf("%d tracks left after expiry", len(c.tracks))
+	}
+}
@@ -0,0 +1,26 @@
+package event
+
+import (
+	"image"
+	"time"
+)
+
+// Event 推送給下游的一筆偵測事件
+type Event struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Stream   string          `json:"stream"`
+	Frame    int             `json:"frame"`
+	TrackID  int             `json:"track_id,omitempty"`
+	Label    string          `json:"label"`
+	Score    float32         `json:"score"`
+	Box      image.Rectangle `json:"box"`
+	Data     any             `json:"data,omitempty"`     // 完整的偵測結果
+	Snapshot []byte          `json:"snapshot,omitempty"` // JPEG, JSON 中為 base64, 同一幀只附在每個類別的第一筆事件
+}
+
+// Sink 事件的去處, Send 不應該阻塞推論
+type Sink interface {
+	Send(ev Event) error
+	Close() error
+}
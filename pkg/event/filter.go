@@ -0,0 +1,92 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FilterOption 事件的過濾設定
+type FilterOption struct {
+	Classes []string      // 只送這些類別, 空白為全部
+	Rate    float64       // 每路串流每秒最多幾筆, 0 為不限
+	Burst   int           // 瞬間最多幾筆
+	Dedupe  time.Duration // 同一條軌跡 (沒有追蹤時為同一類別) 在這段時間內只送一次, 0 為不去重
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Filter 依類別, 每路串流的速率及每條軌跡去重決定事件是否送出
+type Filter struct {
+	opt     FilterOption
+	classes map[string]bool
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	seen    map[string]time.Time
+}
+
+func NewFilter(opt FilterOption) *Filter {
+	if opt.Burst < 1 {
+		opt.Burst = 1
+	}
+	f := &Filter{opt: opt, buckets: map[string]*bucket{}, seen: map[string]time.Time{}}
+	if len(opt.Classes) > 0 {
+		f.classes = map[string]bool{}
+		for _, c := range opt.Classes {
+			f.classes[c] = true
+		}
+	}
+	return f
+}
+
+func dedupeKey(ev Event) string {
+	if ev.TrackID > 0 {
+		return fmt.Sprintf("%s/#%d", ev.Stream, ev.TrackID)
+	}
+	return ev.Stream + "/" + ev.Label
+}
+
+// Allow 回傳事件是否送出, 送出的事件會計入速率及去重
+func (f *Filter) Allow(ev Event) bool {
+	if f.classes != nil && !f.classes[ev.Label] {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := dedupeKey(ev)
+	if f.opt.Dedupe > 0 {
+		if last, ok := f.seen[key]; ok && ev.Time.Sub(last) < f.opt.Dedupe {
+			return false
+		}
+	}
+	if f.opt.Rate > 0 {
+		b, ok := f.buckets[ev.Stream]
+		if !ok {
+			b = &bucket{tokens: float64(f.opt.Burst), last: ev.Time}
+			f.buckets[ev.Stream] = b
+		}
+		b.tokens += ev.Time.Sub(b.last).Seconds() * f.opt.Rate
+		if b.tokens > float64(f.opt.Burst) {
+			b.tokens = float64(f.opt.Burst)
+		}
+		b.last = ev.Time
+		if b.tokens < 1 {
+			return false
+		}
+		b.tokens--
+	}
+	if f.opt.Dedupe > 0 {
+		f.seen[key] = ev.Time
+		// 清掉過期的紀錄
+		for k, t := range f.seen {
+			if ev.Time.Sub(t) >= f.opt.Dedupe {
+				delete(f.seen, k)
+			}
+		}
+	}
+	return true
+}
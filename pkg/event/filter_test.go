@@ -0,0 +1,76 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(stream, label string, track int, sec float64) Event {
+	return Event{Stream: stream, Label: label, TrackID: track, Time: t0.Add(seconds(sec))}
+}
+
+// 每路串流各有一個 token bucket: 一開始可以送 Burst 筆, 之後每秒補 Rate 筆
+func TestFilterRate(t *testing.T) {
+	f := NewFilter(FilterOption{Rate: 2, Burst: 3})
+	steps := []struct {
+		ev   Event
+		want bool
+	}{
+		{at("gate", "person", 0, 0), true},
+		{at("gate", "person", 0, 0), true},
+		{at("gate", "person", 0, 0), true},
+		{at("gate", "person", 0, 0), false}, // burst 用完
+		{at("lobby", "person", 0, 0), true}, // 其他串流不受影響
+		{at("gate", "person", 0, 0.25), false},
+		{at("gate", "person", 0, 0.5), true}, // 0.5 秒補一筆
+		{at("gate", "person", 0, 0.5), false},
+		{at("gate", "person", 0, 10), true}, // 最多補到 burst
+		{at("gate", "person", 0, 10), true},
+		{at("gate", "person", 0, 10), true},
+		{at("gate", "person", 0, 10), false},
+	}
+	for i, s := range steps {
+		if got := f.Allow(s.ev); got != s.want {
+			t.Errorf("step %d %s at %v: allow %v, want %v", i, s.ev.Stream, s.ev.Time.Sub(t0), got, s.want)
+		}
+	}
+}
+
+// 同一條軌跡在 Dedupe 內只送一次, 沒有追蹤 ID 時以類別去重
+func TestFilterDedupe(t *testing.T) {
+	f := NewFilter(FilterOption{Dedupe: 10 * time.Second, Classes: []string{"person", "car"}})
+	steps := []struct {
+		ev   Event
+		want bool
+	}{
+		{at("gate", "person", 1, 0), true},
+		{at("gate", "person", 1, 5), false},
+		{at("gate", "person", 2, 5), true},  // 另一條軌跡
+		{at("lobby", "person", 1, 5), true}, // 另一路串流的同一個 ID
+		{at("gate", "person", 1, 10), true}, // 過了 10 秒
+		{at("gate", "car", 0, 0), true},
+		{at("gate", "car", 0, 3), false},
+		{at("gate", "bus", 7, 3), false}, // 不在 Classes 中
+	}
+	for i, s := range steps {
+		if got := f.Allow(s.ev); got != s.want {
+			t.Errorf("step %d %s/%s #%d at %v: allow %v, want %v", i, s.ev.Stream, s.ev.Label, s.ev.TrackID, s.ev.Time.Sub(t0), got, s.want)
+		}
+	}
+}
+
+// 被速率擋下的事件不算送出, 之後有額度時同一條軌跡仍然可以送
+func TestFilterRateBeforeDedupe(t *testing.T) {
+	f := NewFilter(FilterOption{Rate: 1, Burst: 1, Dedupe: time.Minute})
+	if !f.Allow(at("gate", "person", 1, 0)) {
+		t.Fatal("first event blocked")
+	}
+	if f.Allow(at("gate", "person", 2, 0.1)) {
+		t.Fatal("second event passed the rate limit")
+	}
+	if !f.Allow(at("gate", "person", 2, 1.1)) {
+		t.Error("track 2 was deduped although it was never sent")
+	}
+}
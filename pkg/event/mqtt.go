@@ -0,0 +1,164 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTTOption MQTT 發布的設定
+type MQTTOption struct {
+	Broker   string `json:"broker"` // 例如 tcp://localhost:1883
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	QoS      byte   `json:"qos"`
+	Retain   bool   `json:"retain"`
+	// Topic 預設的 topic, {stream} 及 {label} 會換成串流 ID 及類別
+	Topic string `json:"topic"`
+	// Topics 依 "串流/類別" 覆寫 topic, 可以用 * 代表任何串流或類別, 例如 {"gate/person": "alerts/gate", "*/car": "traffic/{stream}"}
+	Topics map[string]string `json:"topics"`
+	// Timeout 等待 broker 確認的秒數
+	Timeout float64 `json:"timeout"`
+	// MaxInflight 最多幾則發布等待確認, 滿了丟掉新的事件
+	MaxInflight int `json:"max_inflight"`
+}
+
+func DefaultMQTTOption() MQTTOption {
+	return MQTTOption{
+		ClientID:    "yolov8-events",
+		QoS:         1,
+		Topic:       "yolov8/{stream}/{label}",
+		Timeout:     5,
+		MaxInflight: 100,
+	}
+}
+
+// MQTT 以 QoS 1 (預設) 發布每筆事件, 斷線時由 client 自動重連
+type MQTT struct {
+	opt      MQTTOption
+	client   mqtt.Client
+	inflight chan struct{} // 等待確認的名額
+	acks     chan ack
+	done     chan struct{}
+	mu       sync.RWMutex
+	closed   bool
+	dropped  atomic.Int64
+	failed   atomic.Int64
+}
+
+// ack 一則等待確認的發布
+type ack struct {
+	token    mqtt.Token
+	deadline time.Time
+}
+
+func NewMQTT(opt MQTTOption) (*MQTT, error) {
+	if opt.Broker == "" {
+		return nil, errors.New("mqtt needs a broker")
+	}
+	if opt.Topic == "" {
+		opt.Topic = DefaultMQTTOption().Topic
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultMQTTOption().Timeout
+	}
+	if opt.MaxInflight <= 0 {
+		opt.MaxInflight = DefaultMQTTOption().MaxInflight
+	}
+	clientOpt := mqtt.NewClientOptions().
+		AddBroker(opt.Broker).
+		SetClientID(opt.ClientID).
+		SetUsername(opt.Username).
+		SetPassword(opt.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	client := mqtt.NewClient(clientOpt)
+	token := client.Connect()
+	if !token.WaitTimeout(seconds(opt.Timeout)) {
+		// SetConnectRetry 會在背景繼續重試, 要停掉
+		client.Disconnect(0)
+		return nil, fmt.Errorf("connect mqtt %s timeout", opt.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	m := &MQTT{
+		opt:      opt,
+		client:   client,
+		inflight: make(chan struct{}, opt.MaxInflight),
+		acks:     make(chan ack, opt.MaxInflight),
+		done:     make(chan struct{}),
+	}
+	go m.collect()
+	return m, nil
+}
+
+// Topic 依串流及類別找出 topic, 順序為 "串流/類別", "串流/*", "*/類別", 預設的 Topic
+func (m *MQTT) Topic(stream, label string) string {
+	topic := m.opt.Topic
+	for _, key := range []string{stream + "/" + label, stream + "/*", "*/" + label} {
+		if t, ok := m.opt.Topics[key]; ok {
+			topic = t
+			break
+		}
+	}
+	return strings.NewReplacer("{stream}", stream, "{label}", label).Replace(topic)
+}
+
+// Send 發布事件, 不等 broker 確認, 失敗時記錄在 Stats. 等待確認的發布已達 MaxInflight 時丟掉事件
+func (m *MQTT) Send(ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return fmt.Errorf("mqtt %s closed", m.opt.Broker)
+	}
+	select {
+	case m.inflight <- struct{}{}:
+	default:
+		m.dropped.Add(1)
+		return fmt.Errorf("mqtt %s: %d publishes in flight", m.opt.Broker, m.opt.MaxInflight)
+	}
+	token := m.client.Publish(m.Topic(ev.Stream, ev.Label), m.opt.QoS, m.opt.Retain, payload)
+	m.acks <- ack{token: token, deadline: time.Now().Add(seconds(m.opt.Timeout))}
+	return nil
+}
+
+// collect 依序等待每則發布的確認, 逾時或失敗時計入 failed
+func (m *MQTT) collect() {
+	defer close(m.done)
+	for a := range m.acks {
+		if !a.token.WaitTimeout(time.Until(a.deadline)) || a.token.Error() != nil {
+			m.failed.Add(1)
+		}
+		<-m.inflight
+	}
+}
+
+// Stats 等待確認的發布太多而丟掉的事件數, 以及沒有得到確認的發布數量
+func (m *MQTT) Stats() (dropped, failed int) {
+	return int(m.dropped.Load()), int(m.failed.Load())
+}
+
+// Close 等待還沒確認的訊息後斷線
+func (m *MQTT) Close() error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.acks)
+	}
+	m.mu.Unlock()
+	<-m.done
+	m.client.Disconnect(uint(seconds(m.opt.Timeout) / time.Millisecond))
+	return nil
+}
@@ -0,0 +1,246 @@
+package event
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// published broker 收到的一則 PUBLISH
+type published struct {
+	topic   string
+	qos     byte
+	retain  bool
+	payload []byte
+}
+
+// fakeBroker 只實作 MQTT 3.1.1 發布端需要的封包: CONNECT, PUBLISH (回 PUBACK), PINGREQ, DISCONNECT.
+// ack 為 false 時不回 CONNACK, 模擬連線逾時; puback 為 false 時不確認發布
+type fakeBroker struct {
+	ln       net.Listener
+	ack      bool
+	puback   bool
+	mu       sync.Mutex
+	messages []published
+	conns    int
+}
+
+func newFakeBroker(t *testing.T, ack, puback bool) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, ack: ack, puback: puback}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns++
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *fakeBroker) URL() string { return "tcp://" + b.ln.Addr().String() }
+
+func (b *fakeBroker) received() []published {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]published{}, b.messages...)
+}
+
+func (b *fakeBroker) connections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conns
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		// 剩餘長度為 7 bit 一組的變長整數
+		length, shift := 0, 0
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			length |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			if b.ack {
+				conn.Write([]byte{0x20, 2, 0, 0})
+			}
+		case 3: // PUBLISH
+			msg := published{qos: header >> 1 & 3, retain: header&1 == 1}
+			n := int(binary.BigEndian.Uint16(body))
+			msg.topic = string(body[2 : 2+n])
+			rest := body[2+n:]
+			if msg.qos > 0 {
+				id := rest[:2]
+				rest = rest[2:]
+				if b.puback {
+					conn.Write([]byte{0x40, 2, id[0], id[1]})
+				}
+			}
+			msg.payload = append([]byte{}, rest...)
+			b.mu.Lock()
+			b.messages = append(b.messages, msg)
+			b.mu.Unlock()
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func TestMQTTTopic(t *testing.T) {
+	m := &MQTT{opt: MQTTOption{
+		Topic: "yolov8/{stream}/{label}",
+		Topics: map[string]string{
+			"gate/person": "alerts/gate",
+			"gate/*":      "gate/{label}",
+			"*/car":       "traffic/{stream}",
+		},
+	}}
+	cases := []struct{ stream, label, want string }{
+		{"gate", "person", "alerts/gate"}, // 串流/類別優先
+		{"gate", "car", "gate/car"},       // 串流/* 先於 */類別
+		{"lobby", "car", "traffic/lobby"},
+		{"lobby", "person", "yolov8/lobby/person"},
+	}
+	for _, c := range cases {
+		if got := m.Topic(c.stream, c.label); got != c.want {
+			t.Errorf("Topic(%q, %q) = %q, want %q", c.stream, c.label, got, c.want)
+		}
+	}
+}
+
+// 以 QoS 1 發布到各自的 topic, broker 回 PUBACK 後 Stats 沒有失敗
+func TestMQTTPublish(t *testing.T) {
+	broker := newFakeBroker(t, true, true)
+	opt := DefaultMQTTOption()
+	opt.Broker, opt.Timeout = broker.URL(), 2
+	opt.Topics = map[string]string{"gate/person": "alerts/gate"}
+	m, err := NewMQTT(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []Event{
+		{ID: "gate-1-0", Stream: "gate", Label: "person", TrackID: 3},
+		{ID: "lobby-1-0", Stream: "lobby", Label: "car"},
+	}
+	for _, ev := range events {
+		if err := m.Send(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+
+	msgs := broker.received()
+	if len(msgs) != len(events) {
+		t.Fatalf("%d messages, want %d", len(msgs), len(events))
+	}
+	topics := []string{"alerts/gate", "yolov8/lobby/car"}
+	for i, msg := range msgs {
+		if msg.topic != topics[i] || msg.qos != 1 || msg.retain {
+			t.Errorf("message %d topic %q qos %d retain %v, want %q qos 1", i, msg.topic, msg.qos, msg.retain, topics[i])
+		}
+		ev := Event{}
+		if err := json.Unmarshal(msg.payload, &ev); err != nil {
+			t.Fatalf("payload %s: %v", msg.payload, err)
+		}
+		if ev.ID != events[i].ID || ev.TrackID != events[i].TrackID {
+			t.Errorf("payload %+v, want %+v", ev, events[i])
+		}
+	}
+	if dropped, failed := m.Stats(); dropped != 0 || failed != 0 {
+		t.Errorf("%d publishes dropped, %d not acknowledged", dropped, failed)
+	}
+}
+
+// broker 不回 CONNACK 時, NewMQTT 逾時回傳錯誤並停止背景的重試
+func TestMQTTConnectTimeout(t *testing.T) {
+	broker := newFakeBroker(t, false, false)
+	opt := DefaultMQTTOption()
+	opt.Broker, opt.Timeout = broker.URL(), 0.2
+	if m, err := NewMQTT(opt); err == nil {
+		m.Close()
+		t.Fatal("NewMQTT succeeded without CONNACK")
+	}
+	n := broker.connections()
+	time.Sleep(time.Second)
+	if broker.connections() > n+1 {
+		t.Errorf("client kept reconnecting after the timeout: %d connections", broker.connections())
+	}
+}
+
+// broker 不回 PUBACK 時, 等待確認的發布最多 MaxInflight 則, 其餘丟掉; 逾時的計入 failed 並釋出名額
+func TestMQTTInflight(t *testing.T) {
+	broker := newFakeBroker(t, true, false)
+	opt := DefaultMQTTOption()
+	opt.Broker, opt.Timeout, opt.MaxInflight = broker.URL(), 0.3, 3
+	m, err := NewMQTT(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := 0
+	for i := 0; i < 5; i++ {
+		if m.Send(Event{ID: "a", Stream: "gate", Label: "person"}) != nil {
+			errs++
+		}
+	}
+	if dropped, _ := m.Stats(); dropped != 2 || errs != 2 {
+		t.Errorf("dropped %d with %d errors, want 2", dropped, errs)
+	}
+
+	waitMQTT(t, func() bool { _, failed := m.Stats(); return failed == 3 })
+	if err := m.Send(Event{ID: "b", Stream: "gate", Label: "person"}); err != nil {
+		t.Errorf("send after the acks timed out: %v", err)
+	}
+	m.Close()
+	if dropped, failed := m.Stats(); dropped != 2 || failed != 4 {
+		t.Errorf("dropped %d failed %d, want 2 and 4", dropped, failed)
+	}
+	if err := m.Send(Event{ID: "c"}); err == nil {
+		t.Error("send after Close succeeded")
+	}
+}
+
+func waitMQTT(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
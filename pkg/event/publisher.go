@@ -0,0 +1,146 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Config 事件推送的設定檔
+type Config struct {
+	Webhooks []WebhookOption `json:"webhooks"`
+	MQTT     []MQTTOption    `json:"mqtt"`
+	Classes  []string        `json:"classes"`  // 只送這些類別, 空白為全部
+	Rate     float64         `json:"rate"`     // 每路串流每秒最多幾筆, 0 為不限
+	Burst    int             `json:"burst"`    // 瞬間最多幾筆
+	Dedupe   float64         `json:"dedupe"`   // 同一條軌跡幾秒內只送一次, 0 為不去重
+	Snapshot bool            `json:"snapshot"` // 附上畫好結果的 JPEG
+}
+
+// LoadConfig 讀取 JSON 設定, 沒填的欄位使用預設值:
+// {"webhooks": [{"url": "http://...", "secret": "..."}], "mqtt": [{"broker": "tcp://localhost:1883"}], "dedupe": 30}
+func LoadConfig(filename string) (Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	raw := struct {
+		Config
+		Webhooks []json.RawMessage `json:"webhooks"`
+		MQTT     []json.RawMessage `json:"mqtt"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return Config{}, err
+	}
+	cfg := raw.Config
+	cfg.Webhooks, cfg.MQTT = nil, nil
+	for _, msg := range raw.Webhooks {
+		opt := DefaultWebhookOption()
+		if err := json.Unmarshal(msg, &opt); err != nil {
+			return cfg, err
+		}
+		cfg.Webhooks = append(cfg.Webhooks, opt)
+	}
+	for _, msg := range raw.MQTT {
+		opt := DefaultMQTTOption()
+		if err := json.Unmarshal(msg, &opt); err != nil {
+			return cfg, err
+		}
+		cfg.MQTT = append(cfg.MQTT, opt)
+	}
+	if len(cfg.Webhooks) == 0 && len(cfg.MQTT) == 0 {
+		return cfg, fmt.Errorf("no webhooks or mqtt in %s", filename)
+	}
+	return cfg, nil
+}
+
+// Publisher 過濾後把事件送到所有 sink
+type Publisher struct {
+	filter   *Filter
+	sinks    []Sink
+	snapshot bool
+	sent     atomic.Int64 // 多個 worker 同時呼叫 Send
+}
+
+func NewPublisher(filter *Filter, snapshot bool, sinks ...Sink) *Publisher {
+	return &Publisher{filter: filter, sinks: sinks, snapshot: snapshot}
+}
+
+// NewPublisherFromConfig 依設定連線所有 webhook 及 MQTT broker
+func NewPublisherFromConfig(cfg Config) (*Publisher, error) {
+	sinks := []Sink{}
+	closeAll := func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	}
+	for _, opt := range cfg.Webhooks {
+		w, err := NewWebhook(opt)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sinks = append(sinks, w)
+	}
+	for _, opt := range cfg.MQTT {
+		m, err := NewMQTT(opt)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sinks = append(sinks, m)
+	}
+	filter := NewFilter(FilterOption{
+		Classes: cfg.Classes,
+		Rate:    cfg.Rate,
+		Burst:   cfg.Burst,
+		Dedupe:  seconds(cfg.Dedupe),
+	})
+	return NewPublisher(filter, cfg.Snapshot, sinks...), nil
+}
+
+// Snapshot 事件是否需要附上 JPEG
+func (p *Publisher) Snapshot() bool { return p.snapshot }
+
+// Filter 回傳通過過濾的事件, 呼叫者可以只對這些事件準備快照
+func (p *Publisher) Filter(events []Event) []Event {
+	allowed := []Event{}
+	for _, ev := range events {
+		if ev.Time.IsZero() {
+			ev.Time = time.Now()
+		}
+		if p.filter == nil || p.filter.Allow(ev) {
+			allowed = append(allowed, ev)
+		}
+	}
+	return allowed
+}
+
+// Send 把已經過濾的事件送到所有 sink, 回傳第一個錯誤
+func (p *Publisher) Send(events []Event) error {
+	var first error
+	for _, ev := range events {
+		for _, sink := range p.sinks {
+			if err := sink.Send(ev); err != nil && first == nil {
+				first = err
+			}
+		}
+		p.sent.Add(1)
+	}
+	return first
+}
+
+// Sent 送出的事件數量
+func (p *Publisher) Sent() int { return int(p.sent.Load()) }
+
+func (p *Publisher) Close() error {
+	var first error
+	for _, sink := range p.sinks {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
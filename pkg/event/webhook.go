@@ -0,0 +1,236 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookOption HTTP webhook 的設定
+type WebhookOption struct {
+	URL       string            `json:"url"`
+	Secret    string            `json:"secret"`     // HMAC-SHA256 簽章的金鑰, 空白不簽章
+	Headers   map[string]string `json:"headers"`    // 額外的 header, 例如 Authorization
+	Retries   int               `json:"retries"`    // 失敗後重試幾次
+	Backoff   float64           `json:"backoff"`    // 第一次重試前等待的秒數, 之後加倍
+	BatchSize int               `json:"batch_size"` // 一次最多送幾筆
+	BatchWait float64           `json:"batch_wait"` // 湊批次最多等幾秒
+	Timeout   float64           `json:"timeout"`    // 單次請求的秒數上限
+	QueueSize int               `json:"queue_size"` // 等待送出的上限, 滿了丟掉新的事件
+	Drain     float64           `json:"drain"`      // Close 時最多等幾秒送完佇列, 之後中斷請求及重試並丟掉剩下的事件
+}
+
+func DefaultWebhookOption() WebhookOption {
+	return WebhookOption{
+		Retries:   3,
+		Backoff:   0.5,
+		BatchSize: 20,
+		BatchWait: 1,
+		Timeout:   5,
+		QueueSize: 1000,
+		Drain:     5,
+	}
+}
+
+func seconds(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+
+// Webhook 在背景湊批次以 POST {"events": [...]} 送出, 失敗時以指數退避重試.
+// 有 Secret 時 X-Signature 為 "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), X-Timestamp 為 Unix 秒
+type Webhook struct {
+	opt     WebhookOption
+	client  *http.Client
+	queue   chan Event
+	done    chan struct{}
+	once    sync.Once
+	ctx     context.Context // Close 等太久時取消, 中斷進行中的請求及重試的等待
+	cancel  context.CancelFunc
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+func NewWebhook(opt WebhookOption) (*Webhook, error) {
+	if opt.URL == "" {
+		return nil, errors.New("webhook needs a url")
+	}
+	def := DefaultWebhookOption()
+	if opt.BatchSize < 1 {
+		opt.BatchSize = def.BatchSize
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = def.Timeout
+	}
+	if opt.QueueSize < 1 {
+		opt.QueueSize = def.QueueSize
+	}
+	if opt.Backoff <= 0 {
+		opt.Backoff = def.Backoff
+	}
+	if opt.Drain <= 0 {
+		opt.Drain = def.Drain
+	}
+	w := &Webhook{
+		opt:    opt,
+		client: &http.Client{Timeout: seconds(opt.Timeout)},
+		queue:  make(chan Event, opt.QueueSize),
+		done:   make(chan struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	go w.run()
+	return w, nil
+}
+
+// Send 放進佇列, 佇列滿了時丟掉並回傳錯誤
+func (w *Webhook) Send(ev Event) error {
+	select {
+	case w.queue <- ev:
+		return nil
+	default:
+		w.dropped.Add(1)
+		return fmt.Errorf("webhook %s queue full", w.opt.URL)
+	}
+}
+
+// Stats 佇列滿了或 Close 時放棄而丟掉的事件數, 以及重試後仍失敗的批次數
+func (w *Webhook) Stats() (dropped, failed int) {
+	return int(w.dropped.Load()), int(w.failed.Load())
+}
+
+// Close 送完佇列中的事件後結束, 超過 Drain 秒時中斷並丟掉剩下的事件
+func (w *Webhook) Close() error {
+	w.once.Do(func() { close(w.queue) })
+	defer w.cancel()
+	timer := time.NewTimer(seconds(w.opt.Drain))
+	defer timer.Stop()
+	select {
+	case <-w.done:
+		return nil
+	case <-timer.C:
+	}
+	dropped := w.dropped.Load()
+	w.cancel()
+	<-w.done
+	return fmt.Errorf("webhook %s: gave up %d events on close", w.opt.URL, w.dropped.Load()-dropped)
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+	batch := make([]Event, 0, w.opt.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// Close 等太久時不再送, 送到一半被中斷的批次也算丟掉
+		err := context.Canceled
+		if w.ctx.Err() == nil {
+			err = w.deliver(batch)
+		}
+		switch {
+		case err == nil:
+		case w.ctx.Err() != nil:
+			w.dropped.Add(int64(len(batch)))
+		default:
+			w.failed.Add(1)
+			log.Println("webhook failed:", err)
+		}
+		batch = batch[:0]
+	}
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(seconds(w.opt.BatchWait))
+			}
+			batch = append(batch, ev)
+			if len(batch) >= w.opt.BatchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// Sign 以 secret 對 timestamp 及 body 簽章, 接收端以同樣的方式驗證
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver 送出一個批次, 連線失敗, 429 或 5xx 時重試, 其他 4xx 直接放棄
+func (w *Webhook) deliver(events []Event) error {
+	body, err := json.Marshal(map[string]any{"events": events})
+	if err != nil {
+		return err
+	}
+	backoff := seconds(w.opt.Backoff)
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.opt.Retries {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-w.ctx.Done():
+			timer.Stop()
+			return w.ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) post(body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(w.ctx, seconds(w.opt.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opt.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.opt.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.opt.Secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
+		req.Header.Set("X-Signature", Sign(w.opt.Secret, timestamp, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook %s: %s", w.opt.URL, resp.Status)
+	default:
+		return false, fmt.Errorf("webhook %s: %s", w.opt.URL, resp.Status)
+	}
+}
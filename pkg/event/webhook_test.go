@@ -0,0 +1,260 @@
+package event
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookServer 記錄收到的每個請求, 依序回傳 status 中的狀態碼, 用完後回 200
+type hookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   []int
+	requests []hookRequest
+}
+
+type hookRequest struct {
+	header http.Header
+	body   []byte
+	events []Event
+}
+
+func newHookServer(t *testing.T, status ...int) *hookServer {
+	h := &hookServer{status: status}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		batch := struct {
+			Events []Event `json:"events"`
+		}{}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			t.Errorf("body %s: %v", body, err)
+		}
+		h.mu.Lock()
+		h.requests = append(h.requests, hookRequest{header: r.Header.Clone(), body: body, events: batch.Events})
+		code := http.StatusOK
+		if len(h.status) > 0 {
+			code, h.status = h.status[0], h.status[1:]
+		}
+		h.mu.Unlock()
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *hookServer) received() []hookRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]hookRequest{}, h.requests...)
+}
+
+func testWebhook(t *testing.T, opt WebhookOption) *Webhook {
+	w, err := NewWebhook(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWebhookSignature(t *testing.T) {
+	srv := newHookServer(t)
+	opt := DefaultWebhookOption()
+	opt.URL, opt.Secret, opt.BatchSize = srv.URL, "s3cret", 1
+	opt.Headers = map[string]string{"Authorization": "Bearer token"}
+	w := testWebhook(t, opt)
+	if err := w.Send(Event{ID: "gate-1-0", Stream: "gate", Label: "person"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	reqs := srv.received()
+	if len(reqs) != 1 {
+		t.Fatalf("%d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	timestamp, err := strconv.ParseInt(req.header.Get("X-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Timestamp %q: %v", req.header.Get("X-Timestamp"), err)
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d < 0 || d > time.Minute {
+		t.Errorf("X-Timestamp %d is %v from now", timestamp, d)
+	}
+	// 接收端的驗證方式
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(req.header.Get("X-Timestamp") + "." + string(req.body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get("X-Signature"); got != want {
+		t.Errorf("X-Signature %s, want %s", got, want)
+	}
+	if got := Sign("s3cret", timestamp, req.body); got != want {
+		t.Errorf("Sign %s, want %s", got, want)
+	}
+	if Sign("other", timestamp, req.body) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization %q", got)
+	}
+	if len(req.events) != 1 || req.events[0].ID != "gate-1-0" {
+		t.Errorf("events %+v", req.events)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	srv := newHookServer(t)
+	opt := DefaultWebhookOption()
+	opt.URL, opt.BatchSize = srv.URL, 1
+	w := testWebhook(t, opt)
+	w.Send(Event{ID: "a"})
+	w.Close()
+	if reqs := srv.received(); len(reqs) != 1 || reqs[0].header.Get("X-Signature") != "" {
+		t.Errorf("unsigned webhook sent X-Signature")
+	}
+}
+
+// 滿 BatchSize 立刻送出, 不滿時等 BatchWait
+func TestWebhookBatch(t *testing.T) {
+	srv := newHookServer(t)
+	opt := DefaultWebhookOption()
+	opt.URL, opt.BatchSize, opt.BatchWait = srv.URL, 3, 0.1
+	w := testWebhook(t, opt)
+	defer w.Close()
+
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		w.Send(Event{ID: strconv.Itoa(i)})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+
+	reqs := srv.received()
+	sizes := []int{}
+	ids := ""
+	for _, req := range reqs {
+		sizes = append(sizes, len(req.events))
+		for _, ev := range req.events {
+			ids += ev.ID
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Fatalf("batch sizes %v, want [3 3 1]", sizes)
+	}
+	if ids != "0123456" {
+		t.Errorf("event order %s", ids)
+	}
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("last partial batch sent after %v, before BatchWait", elapsed)
+	}
+}
+
+// 429 及 5xx 以退避重試, 其他 4xx 不重試
+func TestWebhookRetry(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   []int
+		retries  int
+		requests int
+		failed   int
+	}{
+		{"ok", nil, 3, 1, 0},
+		{"5xx then ok", []int{503, 500}, 3, 3, 0},
+		{"429 then ok", []int{429}, 3, 2, 0},
+		{"5xx exhausted", []int{500, 502, 503, 504}, 2, 3, 1},
+		{"400", []int{400}, 3, 1, 1},
+		{"401", []int{401}, 3, 1, 1},
+		{"404", []int{404}, 3, 1, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := newHookServer(t, c.status...)
+			opt := DefaultWebhookOption()
+			opt.URL, opt.BatchSize, opt.Retries, opt.Backoff = srv.URL, 1, c.retries, 0.01
+			w := testWebhook(t, opt)
+			w.Send(Event{ID: "a"})
+			w.Close()
+			if n := len(srv.received()); n != c.requests {
+				t.Errorf("%d requests, want %d", n, c.requests)
+			}
+			if _, failed := w.Stats(); failed != c.failed {
+				t.Errorf("failed %d, want %d", failed, c.failed)
+			}
+		})
+	}
+}
+
+// 佇列滿了時丟掉新的事件並計入 Stats
+func TestWebhookQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer srv.Close()
+	opt := DefaultWebhookOption()
+	opt.URL, opt.BatchSize, opt.QueueSize, opt.Retries = srv.URL, 1, 2, 0
+	w := testWebhook(t, opt)
+
+	w.Send(Event{ID: "in flight"})
+	time.Sleep(50 * time.Millisecond)
+	errs := 0
+	for i := 0; i < 5; i++ {
+		if w.Send(Event{ID: strconv.Itoa(i)}) != nil {
+			errs++
+		}
+	}
+	close(block)
+	w.Close()
+	if dropped, _ := w.Stats(); dropped != 3 || errs != 3 {
+		t.Errorf("dropped %d with %d errors, want 3", dropped, errs)
+	}
+}
+
+// Close 最多等 Drain 秒, 之後中斷重試的等待及進行中的請求, 剩下的事件計入 dropped
+func TestWebhookCloseDrain(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"retry backoff", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }},
+		{"hanging request", func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body) // 讀完 body 後才會發現客戶端斷線
+			<-r.Context().Done()
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := httptest.NewServer(c.handler)
+			defer srv.Close()
+			opt := DefaultWebhookOption()
+			opt.URL, opt.BatchSize, opt.Retries, opt.Backoff, opt.Timeout, opt.Drain = srv.URL, 1, 5, 30, 30, 0.1
+			w := testWebhook(t, opt)
+			for i := 0; i < 3; i++ {
+				w.Send(Event{ID: strconv.Itoa(i)})
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			start := time.Now()
+			if err := w.Close(); err == nil {
+				t.Error("Close returned nil after giving up events")
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("Close took %v with a 0.1s drain", d)
+			}
+			if dropped, failed := w.Stats(); dropped != 3 || failed != 0 {
+				t.Errorf("dropped %d failed %d, want 3 dropped", dropped, failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 延遲直方圖的預設上界
+var DefaultBuckets = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// Histogram 可以並行寫入的延遲直方圖
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []int // 最後一格為超過所有上界的數量
+	count  int
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram 沒給上界時使用 DefaultBuckets
+func NewHistogram(bounds ...time.Duration) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	return &Histogram{bounds: bounds, counts: make([]int, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Since 記錄從 start 到現在的時間
+func (h *Histogram) Since(start time.Time) { h.Observe(time.Since(start)) }
+
+// Quantile 以所在格子內線性內插估計第 q 分位數
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quantile(q)
+}
+
+func (h *Histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	seen := 0
+	for i, n := range h.counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower, upper := h.min, h.max
+		if i > 0 && h.bounds[i-1] > lower {
+			lower = h.bounds[i-1]
+		}
+		if i < len(h.bounds) && h.bounds[i] < upper {
+			upper = h.bounds[i]
+		}
+		return lower + time.Duration(float64(upper-lower)*(rank-float64(seen))/float64(n))
+	}
+	return h.max
+}
+
+// Bucket 直方圖的一格, Le 為上界 (毫秒), 最後一格為 -1
+type Bucket struct {
+	Le    float64 `json:"le"`
+	Count int     `json:"count"`
+}
+
+// Snapshot 直方圖目前的統計, 時間單位為毫秒
+type Snapshot struct {
+	Count   int      `json:"count"`
+	Mean    float64  `json:"mean"`
+	Min     float64  `json:"min"`
+	Max     float64  `json:"max"`
+	P50     float64  `json:"p50"`
+	P95     float64  `json:"p95"`
+	P99     float64  `json:"p99"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+func (h *Histogram) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := Snapshot{
+		Count:   h.count,
+		Min:     ms(h.min),
+		Max:     ms(h.max),
+		P50:     ms(h.quantile(0.5)),
+		P95:     ms(h.quantile(0.95)),
+		P99:     ms(h.quantile(0.99)),
+		Buckets: make([]Bucket, 0, len(h.counts)),
+	}
+	if h.count > 0 {
+		s.Mean = ms(h.sum / time.Duration(h.count))
+	}
+	for i, n := range h.counts {
+		le := -1.0
+		if i < len(h.bounds) {
+			le = ms(h.bounds[i])
+		}
+		s.Buckets = append(s.Buckets, Bucket{Le: le, Count: n})
+	}
+	return s
+}
+
+func (h *Histogram) String() string {
+	s := h.Snapshot()
+	return fmt.Sprintf("n=%d mean=%.1fms p50=%.1fms p95=%.1fms p99=%.1fms max=%.1fms",
+		s.Count, s.Mean, s.P50, s.P95, s.P99, s.Max)
+}
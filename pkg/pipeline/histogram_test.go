@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+const ms1 = time.Millisecond
+
+// 分位數在所在的格子內線性內插, 格子的上下界以 min 及 max 收窄
+func TestHistogramQuantile(t *testing.T) {
+	cases := []struct {
+		name    string
+		observe []time.Duration
+		q       float64
+		want    time.Duration
+	}{
+		{"empty", nil, 0.5, 0},
+		{"one bucket p50", []time.Duration{12 * ms1, 14 * ms1, 16 * ms1, 18 * ms1}, 0.5, 15 * ms1},
+		{"one bucket p0", []time.Duration{12 * ms1, 14 * ms1, 16 * ms1, 18 * ms1}, 0, 12 * ms1},
+		{"one bucket p100", []time.Duration{12 * ms1, 14 * ms1, 16 * ms1, 18 * ms1}, 1, 18 * ms1},
+		{"first bucket from min", []time.Duration{5 * ms1, 15 * ms1, 25 * ms1, 35 * ms1}, 0.25, 10 * ms1},
+		{"middle bucket", []time.Duration{5 * ms1, 15 * ms1, 25 * ms1, 35 * ms1}, 0.5, 20 * ms1},
+		{"overflow bucket to max", []time.Duration{5 * ms1, 15 * ms1, 25 * ms1, 35 * ms1}, 0.9, 33 * ms1},
+		{"on a bound", []time.Duration{10 * ms1, 10 * ms1}, 0.5, 10 * ms1},
+	}
+	for _, c := range cases {
+		h := NewHistogram(10*ms1, 20*ms1, 30*ms1)
+		for _, d := range c.observe {
+			h.Observe(d)
+		}
+		got := h.Quantile(c.q)
+		if diff := got - c.want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s: Quantile(%v) = %v, want %v", c.name, c.q, got, c.want)
+		}
+	}
+}
+
+// 並行寫入時數量及各格的總和一致
+func TestHistogramConcurrent(t *testing.T) {
+	h := NewHistogram()
+	wg := sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				h.Observe(time.Duration(g*1000+i) * time.Microsecond)
+			}
+		}(g)
+	}
+	wg.Wait()
+	s := h.Snapshot()
+	total := 0
+	for _, b := range s.Buckets {
+		total += b.Count
+	}
+	if s.Count != 8000 || total != 8000 {
+		t.Errorf("count %d, buckets %d, want 8000", s.Count, total)
+	}
+	if s.Min != 0 || s.Max != 7.999 {
+		t.Errorf("min %v max %v", s.Min, s.Max)
+	}
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Queue 有上限的佇列, 即時來源可以設定滿了就丟掉最舊的元素, 只能有一個寫入者
+type Queue[T any] struct {
+	ch         chan T
+	dropOldest bool
+	drop       func(T) // 釋放被丟掉的元素
+	dropped    atomic.Int64
+}
+
+func NewQueue[T any](size int, dropOldest bool, drop func(T)) *Queue[T] {
+	if size < 1 {
+		size = 1
+	}
+	if drop == nil {
+		drop = func(T) {}
+	}
+	return &Queue[T]{ch: make(chan T, size), dropOldest: dropOldest, drop: drop}
+}
+
+// Push 放入 v: 佇列滿了時丟掉最舊的元素或等待空位. ctx 取消時回傳 false, v 已被釋放
+func (q *Queue[T]) Push(ctx context.Context, v T) bool {
+	if !q.dropOldest {
+		select {
+		case q.ch <- v:
+			return true
+		case <-ctx.Done():
+			q.drop(v)
+			return false
+		}
+	}
+	for {
+		if ctx.Err() != nil {
+			q.drop(v)
+			return false
+		}
+		select {
+		case q.ch <- v:
+			return true
+		default:
+		}
+		select {
+		case old := <-q.ch:
+			q.drop(old)
+			q.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (q *Queue[T]) C() <-chan T { return q.ch }
+
+// Close 寫入者結束時呼叫, 讀取者讀完剩下的元素後結束
+func (q *Queue[T]) Close() { close(q.ch) }
+
+// Dropped 因為佇列滿了被丟掉的數量
+func (q *Queue[T]) Dropped() int { return int(q.dropped.Load()) }
@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// 滿了時丟掉最舊的元素並以 drop 釋放, 留下最新的 size 個
+func TestQueueDropOldest(t *testing.T) {
+	dropped := []int{}
+	q := NewQueue(2, true, func(v int) { dropped = append(dropped, v) })
+	for i := 1; i <= 5; i++ {
+		if !q.Push(context.Background(), i) {
+			t.Fatalf("push %d failed", i)
+		}
+	}
+	q.Close()
+	got := []int{}
+	for v := range q.C() {
+		got = append(got, v)
+	}
+	if len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("queue holds %v, want [4 5]", got)
+	}
+	if len(dropped) != 3 || dropped[0] != 1 || dropped[1] != 2 || dropped[2] != 3 {
+		t.Errorf("dropped %v, want [1 2 3]", dropped)
+	}
+	if q.Dropped() != 3 {
+		t.Errorf("Dropped %d, want 3", q.Dropped())
+	}
+}
+
+// ctx 取消時 Push 回傳 false 並釋放 v, 不丟掉佇列中的元素
+func TestQueueCanceled(t *testing.T) {
+	for _, dropOldest := range []bool{false, true} {
+		dropped := []int{}
+		q := NewQueue(1, dropOldest, func(v int) { dropped = append(dropped, v) })
+		q.Push(context.Background(), 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if q.Push(ctx, 2) {
+			t.Errorf("dropOldest %v: push succeeded after cancel", dropOldest)
+		}
+		if len(dropped) != 1 || dropped[0] != 2 || q.Dropped() != 0 {
+			t.Errorf("dropOldest %v: dropped %v, Dropped %d", dropOldest, dropped, q.Dropped())
+		}
+		if v := <-q.C(); v != 1 {
+			t.Errorf("dropOldest %v: queue holds %d, want 1", dropOldest, v)
+		}
+	}
+}
+
+// 寫入者與讀取者並行: 每個元素不是被讀到就是被丟掉, 讀到的順序不變
+func TestQueueConcurrent(t *testing.T) {
+	const n = 10000
+	var mu sync.Mutex
+	dropped := 0
+	q := NewQueue(4, true, func(int) {
+		mu.Lock()
+		dropped++
+		mu.Unlock()
+	})
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Push(context.Background(), i)
+		}
+		q.Close()
+	}()
+	read, last := 0, -1
+	for v := range q.C() {
+		if v <= last {
+			t.Fatalf("read %d after %d", v, last)
+		}
+		read, last = read+1, v
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if read+dropped != n || dropped != q.Dropped() {
+		t.Errorf("read %d + dropped %d != %d, Dropped %d", read, dropped, n, q.Dropped())
+	}
+	if last != n-1 {
+		t.Errorf("last element %d, want %d", last, n-1)
+	}
+}
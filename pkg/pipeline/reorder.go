@@ -0,0 +1,36 @@
+package pipeline
+
+// Reorder 把並行處理後亂序的元素依序號 (從 0 開始連續) 排回原本的順序
+type Reorder[T any] struct {
+	next    int
+	pending map[int]T
+}
+
+func NewReorder[T any]() *Reorder[T] {
+	return &Reorder[T]{pending: map[int]T{}}
+}
+
+// Add 放入第 seq 個元素, 回傳目前可以依序輸出的元素
+func (r *Reorder[T]) Add(seq int, v T) []T {
+	r.pending[seq] = v
+	ready := []T{}
+	for {
+		v, ok := r.pending[r.next]
+		if !ok {
+			return ready
+		}
+		delete(r.pending, r.next)
+		ready = append(ready, v)
+		r.next++
+	}
+}
+
+// Rest 取出還在等前面序號的元素, 用於中途停止時釋放
+func (r *Reorder[T]) Rest() []T {
+	rest := make([]T, 0, len(r.pending))
+	for seq, v := range r.pending {
+		rest = append(rest, v)
+		delete(r.pending, seq)
+	}
+	return rest
+}
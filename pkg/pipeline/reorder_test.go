@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// 缺了某個序號時, 之後的元素都等它到了才一起輸出
+func TestReorder(t *testing.T) {
+	cases := []struct {
+		name  string
+		order []int
+		want  [][]int // 每次 Add 輸出的序號
+	}{
+		{"in order", []int{0, 1, 2}, [][]int{{0}, {1}, {2}}},
+		{"gap at start", []int{1, 2, 0, 3}, [][]int{{}, {}, {0, 1, 2}, {3}}},
+		{"gap in middle", []int{0, 2, 3, 1, 5, 4}, [][]int{{0}, {}, {}, {1, 2, 3}, {}, {4, 5}}},
+		{"reversed", []int{3, 2, 1, 0}, [][]int{{}, {}, {}, {0, 1, 2, 3}}},
+	}
+	for _, c := range cases {
+		r := NewReorder[int]()
+		for i, seq := range c.order {
+			got := r.Add(seq, seq)
+			if fmt.Sprint(got) != fmt.Sprint(c.want[i]) {
+				t.Errorf("%s: Add(%d) = %v, want %v", c.name, seq, got, c.want[i])
+			}
+		}
+		if rest := r.Rest(); len(rest) != 0 {
+			t.Errorf("%s: rest %v", c.name, rest)
+		}
+	}
+}
+
+// Rest 取出還在等的元素, 之後不再輸出
+func TestReorderRest(t *testing.T) {
+	r := NewReorder[int]()
+	r.Add(0, 0)
+	r.Add(2, 2)
+	r.Add(3, 3)
+	rest := r.Rest()
+	sort.Ints(rest)
+	if fmt.Sprint(rest) != "[2 3]" {
+		t.Errorf("rest %v, want [2 3]", rest)
+	}
+	if got := r.Add(1, 1); fmt.Sprint(got) != "[1]" {
+		t.Errorf("Add(1) after Rest = %v, want [1]", got)
+	}
+}
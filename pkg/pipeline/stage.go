@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pipeline 串起多個並行階段, 任一階段失敗時取消整條管線, 沒送出的元素以 drop 釋放
+type Pipeline[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	drop   func(T)
+	once   sync.Once
+	err    error
+}
+
+func New[T any](ctx context.Context, drop func(T)) *Pipeline[T] {
+	if drop == nil {
+		drop = func(T) {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Pipeline[T]{ctx: ctx, cancel: cancel, drop: drop}
+}
+
+func (p *Pipeline[T]) Context() context.Context { return p.ctx }
+
+// Fail 記錄第一個錯誤並停止管線
+func (p *Pipeline[T]) Fail(err error) {
+	p.once.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+// Err 第一個失敗的錯誤, 正常結束或只是被取消時為 nil
+func (p *Pipeline[T]) Err() error {
+	p.once.Do(func() {})
+	return p.err
+}
+
+// Stop 停止管線, 各階段讀完輸入後結束
+func (p *Pipeline[T]) Stop() { p.cancel() }
+
+// Stage 以 workers 個 goroutine 處理 in 的元素, fn 的 worker 為 goroutine 編號 (可以綁定各自的資源),
+// 每次處理時間記到 hist. 輸出 channel 大小為 size, in 關閉且處理完後關閉.
+// 停止後仍會讀完 in 並釋放元素, 讓上游不會卡住
+func (p *Pipeline[T]) Stage(workers, size int, in <-chan T, hist *Histogram, fn func(worker int, v T) error) <-chan T {
+	if workers < 1 {
+		workers = 1
+	}
+	out := make(chan T, size)
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(worker int) {
+			defer wg.Done()
+			for v := range in {
+				if p.ctx.Err() != nil {
+					p.drop(v)
+					continue
+				}
+				start := time.Now()
+				if err := fn(worker, v); err != nil {
+					p.drop(v)
+					p.Fail(err)
+					continue
+				}
+				if hist != nil {
+					hist.Since(start)
+				}
+				select {
+				case out <- v:
+				case <-p.ctx.Done():
+					p.drop(v)
+				}
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
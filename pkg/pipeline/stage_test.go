@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 某個階段失敗後整條管線取消: 上游不會卡住, 每個元素不是送到最後就是被 drop 釋放
+func TestStageDrainAfterFail(t *testing.T) {
+	const n = 200
+	failure := errors.New("boom")
+	cases := []struct {
+		name   string
+		failAt int // 第二個階段在這個元素失敗, -1 不失敗
+		err    error
+	}{
+		{"ok", -1, nil},
+		{"fail early", 3, failure},
+		{"fail late", 150, failure},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var dropped atomic.Int64
+			p := New(context.Background(), func(int) { dropped.Add(1) })
+			src := make(chan int) // 沒有緩衝, 沒人讀就會卡住
+			produced := make(chan struct{})
+			go func() {
+				defer close(produced)
+				defer close(src)
+				for i := 0; i < n; i++ {
+					src <- i
+				}
+			}()
+			first := p.Stage(4, 2, src, NewHistogram(), func(_ int, v int) error { return nil })
+			checked := p.Stage(2, 2, first, nil, func(_ int, v int) error {
+				if v == c.failAt {
+					return c.err
+				}
+				return nil
+			})
+			last := p.Stage(3, 0, checked, nil, func(int, int) error {
+				time.Sleep(100 * time.Microsecond)
+				return nil
+			})
+
+			received := 0
+			timeout := time.After(5 * time.Second)
+		loop:
+			for {
+				select {
+				case _, ok := <-last:
+					if !ok {
+						break loop
+					}
+					received++
+				case <-timeout:
+					t.Fatal("pipeline did not finish")
+				}
+			}
+			<-produced
+			if int64(received)+dropped.Load() != n {
+				t.Errorf("received %d + dropped %d != %d", received, dropped.Load(), n)
+			}
+			if !errors.Is(p.Err(), c.err) {
+				t.Errorf("Err %v, want %v", p.Err(), c.err)
+			}
+			if c.err == nil && received != n {
+				t.Errorf("received %d of %d", received, n)
+			}
+			if c.err != nil && p.Context().Err() == nil {
+				t.Error("context not canceled after Fail")
+			}
+		})
+	}
+}
+
+// Stop 只是取消, Err 仍為 nil; 只記錄第一個錯誤
+func TestPipelineErr(t *testing.T) {
+	p := New[int](context.Background(), nil)
+	p.Stop()
+	if p.Err() != nil {
+		t.Errorf("Err %v after Stop", p.Err())
+	}
+	first, second := errors.New("first"), errors.New("second")
+	p = New[int](context.Background(), nil)
+	p.Fail(first)
+	p.Fail(second)
+	if p.Err() != first {
+		t.Errorf("Err %v, want the first error", p.Err())
+	}
+}
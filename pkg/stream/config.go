@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Source 單一路影像來源的設定
+type Source struct {
+	ID        string  `json:"id"`
+	URL       string  `json:"url"`                 // rtsp://, http:// 網址, 攝影機編號或影片檔
+	Enabled   *bool   `json:"enabled,omitempty"`   // 預設啟用
+	Threshold float32 `json:"threshold,omitempty"` // 0 為使用全域門檻
+	Output    string  `json:"output,omitempty"`    // 畫好結果的影片, 空白不輸出
+}
+
+// Config 多路串流的設定
+type Config struct {
+	Sources    []Source `json:"streams"`
+	MinBackoff float64  `json:"min_backoff"` // 重新連線的等待秒數, 每次失敗加倍到 MaxBackoff
+	MaxBackoff float64  `json:"max_backoff"`
+}
+
+func (c Config) minBackoff() time.Duration { return time.Duration(c.MinBackoff * float64(time.Second)) }
+func (c Config) maxBackoff() time.Duration { return time.Duration(c.MaxBackoff * float64(time.Second)) }
+
+// LoadConfig 讀取 JSON 設定:
+// {"streams": [{"id": "gate", "url": "rtsp://...", "threshold": 0.4}], "min_backoff": 1, "max_backoff": 30}
+func LoadConfig(filename string) (Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{MinBackoff: 1, MaxBackoff: 30}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, err
+	}
+	if len(cfg.Sources) == 0 {
+		return cfg, fmt.Errorf("no streams in %s", filename)
+	}
+	ids := map[string]bool{}
+	for i := range cfg.Sources {
+		src := &cfg.Sources[i]
+		if src.URL == "" {
+			return cfg, fmt.Errorf("stream %d has no url", i)
+		}
+		if src.ID == "" {
+			src.ID = fmt.Sprintf("stream_%d", i)
+		}
+		if ids[src.ID] {
+			return cfg, fmt.Errorf("duplicate stream id %q", src.ID)
+		}
+		ids[src.ID] = true
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 1
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+	return cfg, nil
+}
@@ -0,0 +1,365 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// Frame 送去推論的一幀, Handler 回傳後 Image 會被釋放
+type Frame struct {
+	Stream    string
+	Seq       int       // 該串流的第幾幀
+	Time      time.Time // 讀到這一幀的時間
+	FPS       float64   // 來源的 FPS
+	Threshold float32
+	Image     gocv.Mat
+}
+
+// Handler 處理一幀, worker 為 session pool 中的編號. 同一路串流同時只會有一幀在處理, 所以會依序呼叫
+type Handler func(worker int, f Frame) error
+
+// Health 單一串流的狀態
+type Health struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Enabled    bool      `json:"enabled"`
+	Connected  bool      `json:"connected"`
+	Threshold  float32   `json:"threshold"`
+	CaptureFPS float64   `json:"capture_fps"`
+	FPS        float64   `json:"fps"` // 推論完成的 FPS
+	LastFrame  time.Time `json:"last_frame"`
+	Frames     int       `json:"frames"`
+	Processed  int       `json:"processed"`
+	Dropped    int       `json:"dropped"` // 推論來不及被新幀取代的數量
+	Errors     int       `json:"errors"`
+	Reconnects int       `json:"reconnects"`
+	Backoff    float64   `json:"backoff,omitempty"` // 最近一次重新連線前等待的秒數
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// rate 以指數移動平均估計 FPS
+type rate struct {
+	last time.Time
+	fps  float64
+}
+
+func (r *rate) tick(now time.Time) {
+	if !r.last.IsZero() {
+		if dt := now.Sub(r.last).Seconds(); dt > 0 {
+			if r.fps == 0 {
+				r.fps = 1 / dt
+			} else {
+				r.fps = 0.9*r.fps + 0.1/dt
+			}
+		}
+	}
+	r.last = now
+}
+
+type stream struct {
+	src       Source
+	enabled   bool
+	threshold float32
+	wake      chan struct{}
+
+	pending *Frame // 只保留最新的一幀
+	busy    bool   // 是否有一幀正在推論
+
+	health  Health
+	capture rate
+	process rate
+}
+
+// Manager 管理多路串流: 各自讀取並在失敗時以指數退避重新連線,
+// 推論時輪流從有新幀的串流取出, 讓所有串流公平地共用 session pool
+type Manager struct {
+	cfg       Config
+	threshold float32 // 串流沒設定時的門檻
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	streams []*stream
+	byID    map[string]*stream
+	cursor  int // 下一個輪到的串流
+}
+
+func NewManager(cfg Config, threshold float32) *Manager {
+	m := &Manager{cfg: cfg, threshold: threshold, byID: map[string]*stream{}}
+	m.cond = sync.NewCond(&m.mu)
+	for _, src := range cfg.Sources {
+		s := &stream{
+			src:       src,
+			enabled:   src.Enabled == nil || *src.Enabled,
+			threshold: src.Threshold,
+			wake:      make(chan struct{}, 1),
+		}
+		s.health.ID, s.health.URL = src.ID, src.URL
+		m.streams = append(m.streams, s)
+		m.byID[src.ID] = s
+	}
+	return m
+}
+
+func (m *Manager) Sources() []Source { return m.cfg.Sources }
+
+// SetEnabled 啟用或停用串流, 停用時會斷線並丟掉還沒推論的幀
+func (m *Manager) SetEnabled(id string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.byID[id]
+	if !ok {
+		return fmt.Errorf("unknown stream %q", id)
+	}
+	s.enabled = enabled
+	if !enabled && s.pending != nil {
+		s.pending.Image.Close()
+		s.pending = nil
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetThreshold 設定串流的門檻, 0 為使用全域門檻
+func (m *Manager) SetThreshold(id string, threshold float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.byID[id]
+	if !ok {
+		return fmt.Errorf("unknown stream %q", id)
+	}
+	s.threshold = threshold
+	return nil
+}
+
+// Health 所有串流目前的狀態
+func (m *Manager) Health() []Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	health := make([]Health, 0, len(m.streams))
+	for _, s := range m.streams {
+		h := s.health
+		h.Enabled = s.enabled
+		h.Threshold = m.thresholdOf(s)
+		h.CaptureFPS, h.FPS = s.capture.fps, s.process.fps
+		health = append(health, h)
+	}
+	return health
+}
+
+func (m *Manager) thresholdOf(s *stream) float32 {
+	if s.threshold > 0 {
+		return s.threshold
+	}
+	return m.threshold
+}
+
+// Run 啟動每路串流的讀取以及 workers 個推論 goroutine, ctx 取消後等全部結束才回傳
+func (m *Manager) Run(ctx context.Context, workers int, handle Handler) {
+	wg := sync.WaitGroup{}
+	for _, s := range m.streams {
+		wg.Add(1)
+		go func(s *stream) {
+			defer wg.Done()
+			m.runCapture(ctx, s)
+		}(s)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				s, f, ok := m.next(ctx)
+				if !ok {
+					return
+				}
+				err := handle(worker, *f)
+				f.Image.Close()
+				m.done(s, err)
+			}
+		}(w)
+	}
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		m.cond.Broadcast()
+		m.mu.Unlock()
+	}()
+	wg.Wait()
+
+	for _, s := range m.streams {
+		if s.pending != nil {
+			s.pending.Image.Close()
+			s.pending = nil
+		}
+	}
+}
+
+// next 從上次之後的串流開始, 找出第一個有新幀且沒在推論的串流
+func (m *Manager) next(ctx context.Context) (*stream, *Frame, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, false
+		}
+		n := len(m.streams)
+		for k := 0; k < n; k++ {
+			i := (m.cursor + k) % n
+			s := m.streams[i]
+			if s.pending == nil || s.busy {
+				continue
+			}
+			f := s.pending
+			s.pending, s.busy = nil, true
+			m.cursor = (i + 1) % n
+			return s, f, true
+		}
+		m.cond.Wait()
+	}
+}
+
+func (m *Manager) done(s *stream, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.busy = false
+	s.health.Processed++
+	s.process.tick(time.Now())
+	if err != nil {
+		s.health.Errors++
+		s.health.LastError = err.Error()
+	}
+	m.cond.Broadcast()
+}
+
+func (m *Manager) push(s *stream, f Frame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !s.enabled {
+		f.Image.Close()
+		return
+	}
+	if s.pending != nil {
+		s.pending.Image.Close()
+		s.health.Dropped++
+	}
+	f.Threshold = m.thresholdOf(s)
+	s.pending = &f
+	s.health.Frames++
+	s.health.LastFrame = f.Time
+	s.capture.tick(f.Time)
+	m.cond.Broadcast()
+}
+
+func (m *Manager) isEnabled(s *stream) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return s.enabled
+}
+
+func (m *Manager) setConnected(s *stream, connected bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.health.Connected = connected
+}
+
+// retry 記錄斷線的原因, 接著會等待 backoff 後重新連線
+func (m *Manager) retry(s *stream, err error, backoff time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.health.Connected = false
+	s.health.Errors++
+	s.health.Reconnects++
+	s.health.LastError = err.Error()
+	s.health.Backoff = backoff.Seconds()
+}
+
+var errDisabled = errors.New("stream disabled")
+
+// runCapture 連線並讀取, 失敗時等待 backoff 後重新連線, 停用時斷線等到再次啟用
+func (m *Manager) runCapture(ctx context.Context, s *stream) {
+	backoff := m.cfg.minBackoff()
+	seq := 0
+	for ctx.Err() == nil {
+		if !m.isEnabled(s) {
+			select {
+			case <-s.wake:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		vc, err := gocv.OpenVideoCapture(s.src.URL)
+		if err == nil && !vc.IsOpened() {
+			vc.Close()
+			err = fmt.Errorf("cannot open %s", s.src.URL)
+		}
+		if err == nil {
+			m.setConnected(s, true)
+			err = m.read(ctx, s, vc, &seq, &backoff)
+			vc.Close()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err == errDisabled {
+			m.setConnected(s, false)
+			continue
+		}
+		m.retry(s, err, backoff)
+		sleep(ctx, backoff)
+		backoff *= 2
+		if limit := m.cfg.maxBackoff(); backoff > limit {
+			backoff = limit
+		}
+	}
+	m.setConnected(s, false)
+}
+
+// read 讀到失敗或停用為止, 成功讀到幀時把 backoff 重設. 影片檔依原本的 FPS 讀取, 模擬即時來源
+func (m *Manager) read(ctx context.Context, s *stream, vc *gocv.VideoCapture, seq *int, backoff *time.Duration) error {
+	fps := vc.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		fps = 30
+	}
+	paced := !utils.IsLive(s.src.URL)
+	next := time.Now()
+	for ctx.Err() == nil {
+		if !m.isEnabled(s) {
+			return errDisabled
+		}
+		img := gocv.NewMat()
+		if !vc.Read(&img) || img.Empty() {
+			img.Close()
+			return fmt.Errorf("read %s failed", s.src.URL)
+		}
+		*backoff = m.cfg.minBackoff()
+		m.push(s, Frame{Stream: s.src.ID, Seq: *seq, Time: time.Now(), FPS: fps, Image: img})
+		*seq++
+		if paced {
+			next = next.Add(time.Duration(float64(time.Second) / fps))
+			sleep(ctx, time.Until(next))
+		}
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
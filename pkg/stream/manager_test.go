@@ -0,0 +1,255 @@
+package stream
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// writeClip 在 dir 寫一段 frames 幀的 MJPG 影片, 環境沒有編碼器時跳過測試
+func writeClip(t *testing.T, dir, name string, frames int, fps float64) string {
+	t.Helper()
+	file := filepath.Join(dir, name+".avi")
+	vw, err := gocv.VideoWriterFile(file, "MJPG", fps, 64, 48, true)
+	if err != nil || !vw.IsOpened() {
+		t.Skipf("cannot write %s: %v", file, err)
+	}
+	defer vw.Close()
+	for i := 0; i < frames; i++ {
+		img := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(i*8%256), 128, 64, 0), 48, 64, gocv.MatTypeCV8UC3)
+		err := vw.Write(img)
+		img.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file
+}
+
+// recorder 記錄 Handler 收到的幀
+type recorder struct {
+	mu     sync.Mutex
+	frames []Frame
+}
+
+func (r *recorder) handle(worker int, f Frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f.Image = gocv.Mat{} // Handler 回傳後會被釋放
+	r.frames = append(r.frames, f)
+	return nil
+}
+
+func (r *recorder) snapshot() []Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Frame{}, r.frames...)
+}
+
+func (r *recorder) count(id string) int {
+	n := 0
+	for _, f := range r.snapshot() {
+		if f.Stream == id {
+			n++
+		}
+	}
+	return n
+}
+
+// waitFor 每 5ms 檢查一次, 直到 cond 成立或逾時
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// allPending 每路啟用的串流都有一幀等著推論
+func allPending(m *Manager) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.streams {
+		if s.enabled && s.pending == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func healthOf(m *Manager, id string) Health {
+	for _, h := range m.Health() {
+		if h.ID == id {
+			return h
+		}
+	}
+	return Health{}
+}
+
+// 三路影片共用一個 worker: 結果帶著串流 ID, 輪流取出, 停用的串流不再送出
+func TestManagerRun(t *testing.T) {
+	dir := t.TempDir()
+	ids := []string{"a", "b", "c"}
+	cfg := Config{MinBackoff: 0.05, MaxBackoff: 0.05}
+	for _, id := range ids {
+		cfg.Sources = append(cfg.Sources, Source{ID: id, URL: writeClip(t, dir, id, 90, 30)})
+	}
+	m := NewManager(cfg, 0.25)
+
+	// 每次等三路都有新幀才放行一幀, 輪流的順序不受啟動及執行速度影響
+	rec := &recorder{}
+	gate := make(chan struct{})
+	handle := func(worker int, f Frame) error {
+		<-gate
+		return rec.handle(worker, f)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		m.Run(ctx, 1, handle)
+		close(finished)
+	}()
+	released := false
+	defer func() {
+		if !released {
+			close(gate)
+		}
+		cancel()
+		<-finished
+	}()
+
+	for len(rec.snapshot()) < 30 {
+		waitFor(t, 5*time.Second, "a frame from every stream", func() bool { return allPending(m) })
+		gate <- struct{}{}
+	}
+	close(gate)
+	released = true
+	frames := rec.snapshot()[:30]
+
+	seq := map[string]int{}
+	for i, f := range frames {
+		if _, ok := m.byID[f.Stream]; !ok {
+			t.Fatalf("frame %d from unknown stream %q", i, f.Stream)
+		}
+		if last, ok := seq[f.Stream]; ok && f.Seq <= last {
+			t.Errorf("stream %s seq %d after %d", f.Stream, f.Seq, last)
+		}
+		seq[f.Stream] = f.Seq
+		if f.Threshold != 0.25 {
+			t.Errorf("stream %s threshold %v, want the global 0.25", f.Stream, f.Threshold)
+		}
+	}
+	for i := 3; i < len(frames); i++ {
+		if frames[i].Stream != frames[i-3].Stream || frames[i].Stream == frames[i-1].Stream {
+			order := []string{}
+			for _, f := range frames {
+				order = append(order, f.Stream)
+			}
+			t.Fatalf("not round-robin: %s", strings.Join(order, ""))
+		}
+	}
+
+	if err := m.SetEnabled("b", false); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // 已經取出的那一幀仍會完成
+	b, a := rec.count("b"), rec.count("a")
+	time.Sleep(300 * time.Millisecond)
+	if n := rec.count("b"); n != b {
+		t.Errorf("disabled stream b delivered %d more frames", n-b)
+	}
+	if n := rec.count("a"); n <= a {
+		t.Errorf("stream a stopped after b was disabled")
+	}
+	if h := healthOf(m, "b"); h.Enabled {
+		t.Errorf("health of b still enabled")
+	}
+	if err := m.SetEnabled("x", false); err == nil {
+		t.Errorf("SetEnabled on an unknown stream should fail")
+	}
+}
+
+// 影片讀完視為斷線, 等待 backoff 後重新開啟, 成功讀到幀時 backoff 重設
+func TestManagerReconnectAfterEOF(t *testing.T) {
+	cfg := Config{
+		Sources:    []Source{{ID: "clip", URL: writeClip(t, t.TempDir(), "clip", 5, 30)}},
+		MinBackoff: 0.02,
+		MaxBackoff: 1,
+	}
+	m := NewManager(cfg, 0.25)
+	rec := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	finished := make(chan struct{})
+	go func() {
+		m.Run(ctx, 1, rec.handle)
+		close(finished)
+	}()
+
+	waitFor(t, 5*time.Second, "3 reconnects", func() bool { return healthOf(m, "clip").Reconnects >= 3 })
+	cancel()
+	<-finished
+
+	h := healthOf(m, "clip")
+	if h.Backoff != 0.02 {
+		t.Errorf("backoff %v after reading frames, want the min 0.02", h.Backoff)
+	}
+	if !strings.Contains(h.LastError, "read") {
+		t.Errorf("last error %q", h.LastError)
+	}
+	if h.Frames < 5*h.Reconnects {
+		t.Errorf("%d frames for %d reconnects, the clip should be read again each time", h.Frames, h.Reconnects)
+	}
+	if len(rec.snapshot()) == 0 {
+		t.Errorf("no frames delivered")
+	}
+}
+
+// 打不開的來源, 每次失敗 backoff 加倍直到 MaxBackoff
+func TestManagerBackoff(t *testing.T) {
+	cfg := Config{
+		Sources:    []Source{{ID: "missing", URL: filepath.Join(t.TempDir(), "missing.avi")}},
+		MinBackoff: 0.05,
+		MaxBackoff: 0.2,
+	}
+	m := NewManager(cfg, 0.25)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	finished := make(chan struct{})
+	go func() {
+		m.Run(ctx, 1, func(int, Frame) error { return nil })
+		close(finished)
+	}()
+
+	backoffs := []float64{}
+	waitFor(t, 5*time.Second, "5 reconnects", func() bool {
+		h := healthOf(m, "missing")
+		if h.Backoff > 0 && (len(backoffs) == 0 || backoffs[len(backoffs)-1] != h.Backoff) {
+			backoffs = append(backoffs, h.Backoff)
+		}
+		return h.Reconnects >= 5
+	})
+	cancel()
+	<-finished
+
+	want := []float64{0.05, 0.1, 0.2}
+	if len(backoffs) != len(want) {
+		t.Fatalf("backoffs %v, want %v", backoffs, want)
+	}
+	for i := range want {
+		if backoffs[i] != want[i] {
+			t.Fatalf("backoffs %v, want %v", backoffs, want)
+		}
+	}
+	if h := healthOf(m, "missing"); h.Connected || h.Frames != 0 {
+		t.Errorf("health %+v", h)
+	}
+}
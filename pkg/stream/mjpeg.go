@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// MJPEGOption 預覽的 JPEG 品質及 FPS 上限
+type MJPEGOption struct {
+	Quality int     // 0 ~ 100
+	FPS     float64 // 有人觀看時每路最多每秒編碼幾張, 沒人看時每秒一張 (給 snapshot 用)
+}
+
+func DefaultMJPEGOption() MJPEGOption {
+	return MJPEGOption{Quality: 80, FPS: 10}
+}
+
+type feed struct {
+	jpeg    []byte
+	at      time.Time
+	viewers int
+	update  chan struct{} // 有新的一張時關閉並換新
+}
+
+// MJPEGServer 以 multipart/x-mixed-replace 提供每路串流畫好結果的即時預覽:
+// / 列出所有串流, /stream/<id> 為 MJPEG, /snapshot/<id> 為最新的一張 JPEG
+type MJPEGServer struct {
+	opt   MJPEGOption
+	mu    sync.Mutex
+	feeds map[string]*feed
+}
+
+func NewMJPEGServer(opt MJPEGOption) *MJPEGServer {
+	if opt.Quality <= 0 || opt.Quality > 100 {
+		opt.Quality = 80
+	}
+	if opt.FPS <= 0 {
+		opt.FPS = 10
+	}
+	return &MJPEGServer{opt: opt, feeds: map[string]*feed{}}
+}
+
+func (s *MJPEGServer) feed(id string) *feed {
+	f, ok := s.feeds[id]
+	if !ok {
+		f = &feed{update: make(chan struct{})}
+		s.feeds[id] = f
+	}
+	return f
+}
+
+// Publish 送出串流 id 畫好的一幀, 沒到 FPS 上限的間隔時直接略過不編碼
+func (s *MJPEGServer) Publish(id string, img gocv.Mat) error {
+	s.mu.Lock()
+	f := s.feed(id)
+	interval := time.Second
+	if f.viewers > 0 {
+		interval = time.Duration(float64(time.Second) / s.opt.FPS)
+	}
+	due := time.Since(f.at) >= interval
+	s.mu.Unlock()
+	if !due || img.Empty() {
+		return nil
+	}
+
+	buf, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, img, []int{gocv.IMWriteJpegQuality, s.opt.Quality})
+	if err != nil {
+		return err
+	}
+	jpeg := append([]byte{}, buf.GetBytes()...)
+	buf.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.jpeg, f.at = jpeg, time.Now()
+	close(f.update)
+	f.update = make(chan struct{})
+	return nil
+}
+
+func (s *MJPEGServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		s.serveIndex(w)
+	case strings.HasPrefix(r.URL.Path, "/stream/"):
+		s.serveStream(w, r, strings.TrimPrefix(r.URL.Path, "/stream/"))
+	case strings.HasPrefix(r.URL.Path, "/snapshot/"):
+		s.serveSnapshot(w, strings.TrimPrefix(r.URL.Path, "/snapshot/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *MJPEGServer) serveIndex(w http.ResponseWriter) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.feeds))
+	for id := range s.feeds {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<!DOCTYPE html><html><head><title>preview</title></head><body>\n")
+	for _, id := range ids {
+		name, path := html.EscapeString(id), url.PathEscape(id)
+		fmt.Fprintf(w, "<figure style=\"display:inline-block\"><img src=\"/stream/%s\" width=\"640\"><figcaption>%s</figcaption></figure>\n", path, name)
+	}
+	fmt.Fprint(w, "</body></html>\n")
+}
+
+func (s *MJPEGServer) serveSnapshot(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	var jpeg []byte
+	if f, ok := s.feeds[id]; ok {
+		jpeg = f.jpeg
+	}
+	s.mu.Unlock()
+	if jpeg == nil {
+		http.Error(w, "no frame yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(jpeg)
+}
+
+func (s *MJPEGServer) serveStream(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	if _, ok := s.feeds[id]; !ok {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	f := s.feed(id)
+	f.viewers++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		f.viewers--
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		s.mu.Lock()
+		jpeg, update := f.jpeg, f.update
+		s.mu.Unlock()
+		if jpeg != nil {
+			_, err := fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(jpeg))
+			if err == nil {
+				_, err = w.Write(jpeg)
+			}
+			if err == nil {
+				_, err = w.Write([]byte("\r\n"))
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		select {
+		case <-update:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// ListenAndServe 在 addr 提供預覽, ctx 取消時關閉 (觀看中的連線不會自己結束, 所以直接 Close)
+func (s *MJPEGServer) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
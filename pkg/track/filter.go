@@ -0,0 +1,109 @@
+package track
+
+import "math"
+
+// Filter 一維的時間序列濾波器
+type Filter interface {
+	// Filter 輸入時間 t (秒) 的量測值, 回傳濾波後的值
+	Filter(x, t float64) float64
+	// Velocity 濾波後的速度 (每秒)
+	Velocity() float64
+	// Reset 清除狀態, 下一個量測值重新初始化
+	Reset()
+}
+
+// OneEuro One-Euro 濾波器: 速度慢時截止頻率低 (去抖動), 速度快時截止頻率高 (低延遲)
+type OneEuro struct {
+	MinCutoff float64 // 最低截止頻率 (Hz), 越小越平滑
+	Beta      float64 // 截止頻率隨速度增加的比例, 越大延遲越低
+	DCutoff   float64 // 速度的截止頻率 (Hz)
+
+	x, dx       float64
+	lastT       float64
+	initialized bool
+}
+
+func NewOneEuro(minCutoff, beta float64) *OneEuro {
+	return &OneEuro{MinCutoff: minCutoff, Beta: beta, DCutoff: 1}
+}
+
+func smoothingFactor(cutoff, dt float64) float64 {
+	r := 2 * math.Pi * cutoff * dt
+	return r / (r + 1)
+}
+
+func (f *OneEuro) Filter(x, t float64) float64 {
+	if !f.initialized {
+		f.x, f.dx, f.lastT, f.initialized = x, 0, t, true
+		return x
+	}
+	dt := t - f.lastT
+	if dt <= 0 {
+		return f.x
+	}
+	f.lastT = t
+
+	dx := (x - f.x) / dt
+	f.dx += smoothingFactor(f.DCutoff, dt) * (dx - f.dx)
+	cutoff := f.MinCutoff + f.Beta*math.Abs(f.dx)
+	f.x += smoothingFactor(cutoff, dt) * (x - f.x)
+	return f.x
+}
+
+func (f *OneEuro) Velocity() float64 { return f.dx }
+
+func (f *OneEuro) Reset() { f.initialized = false }
+
+// Kalman 等速模型的一維卡爾曼濾波器
+type Kalman struct {
+	Q float64 // 過程雜訊, 越大越相信量測
+	R float64 // 量測雜訊, 越大越平滑
+
+	x, v        float64
+	p           [2][2]float64
+	lastT       float64
+	initialized bool
+}
+
+func NewKalman(q, r float64) *Kalman {
+	return &Kalman{Q: q, R: r}
+}
+
+func (f *Kalman) Filter(z, t float64) float64 {
+	if !f.initialized {
+		f.x, f.v, f.lastT, f.initialized = z, 0, t, true
+		f.p = [2][2]float64{{f.R, 0}, {0, f.R}}
+		return z
+	}
+	dt := t - f.lastT
+	if dt <= 0 {
+		return f.x
+	}
+	f.lastT = t
+
+	// 預測: x = x + v*dt, P = F P F' + Q
+	f.x += f.v * dt
+	p := f.p
+	f.p[0][0] = p[0][0] + dt*(p[1][0]+p[0][1]) + dt*dt*p[1][1] + f.Q*dt*dt*dt/3
+	f.p[0][1] = p[0][1] + dt*p[1][1] + f.Q*dt*dt/2
+	f.p[1][0] = p[1][0] + dt*p[1][1] + f.Q*dt*dt/2
+	f.p[1][1] = p[1][1] + f.Q*dt
+
+	// 更新
+	s := f.p[0][0] + f.R
+	k0 := f.p[0][0] / s
+	k1 := f.p[1][0] / s
+	y := z - f.x
+	f.x += k0 * y
+	f.v += k1 * y
+	p = f.p
+	f.p[0][0] = (1 - k0) * p[0][0]
+	f.p[0][1] = (1 - k0) * p[0][1]
+	f.p[1][0] = p[1][0] - k1*p[0][0]
+	f.p[1][1] = p[1][1] - k1*p[0][1]
+	return f.x
+}
+
+func (f *Kalman) Velocity() float64 { return f.v }
+
+func (f *Kalman) Reset() { f.initialized = false }
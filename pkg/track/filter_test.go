@@ -0,0 +1,87 @@
+package track
+
+import (
+	"math"
+	"testing"
+)
+
+func filters() map[string]func() Filter {
+	return map[string]func() Filter{
+		"one euro": func() Filter { return NewOneEuro(1, 0.05) },
+		"kalman":   func() Filter { return NewKalman(10, 1) },
+	}
+}
+
+// 30 fps 的量測: 固定值收斂到該值, 等速移動時落後有限, 卡爾曼的速度收斂到實際速度.
+// One-Euro 的速度是對濾波後的值微分再平滑, 只用來調整截止頻率, 等速時會偏大
+func TestFilterConverge(t *testing.T) {
+	for name, newFilter := range filters() {
+		f := newFilter()
+		f.Filter(0, 0)
+		x := 0.0
+		for i := 1; i <= 90; i++ {
+			x = f.Filter(10, float64(i)/30)
+		}
+		if math.Abs(x-10) > 1e-2 {
+			t.Errorf("%s: constant 10 filtered to %v", name, x)
+		}
+
+		f = newFilter()
+		for i := 0; i <= 300; i++ {
+			ts := float64(i) / 30
+			x = f.Filter(5*ts, ts)
+		}
+		if v := f.Velocity(); v <= 0 || name == "kalman" && math.Abs(v-5) > 0.1 {
+			t.Errorf("%s: velocity %v on a 5/s ramp", name, v)
+		}
+		if lag := 5*10.0 - x; math.Abs(lag) > 1 {
+			t.Errorf("%s: %v behind a 5/s ramp", name, lag)
+		}
+	}
+}
+
+// 在 0 附近 ±1 抖動時, 輸出的抖動明顯變小
+func TestFilterJitter(t *testing.T) {
+	for name, newFilter := range filters() {
+		f := newFilter()
+		maxAbs := 0.0
+		for i := 0; i < 120; i++ {
+			z := 1.0
+			if i%2 == 1 {
+				z = -1
+			}
+			x := f.Filter(z, float64(i)/30)
+			if i >= 60 {
+				maxAbs = math.Max(maxAbs, math.Abs(x))
+			}
+		}
+		if maxAbs > 0.5 {
+			t.Errorf("%s: jitter ±1 filtered to ±%v", name, maxAbs)
+		}
+	}
+}
+
+// 關鍵點消失時 Reset, 重新出現的第一個量測值直接輸出, 不從舊的位置慢慢移過去; 時間沒前進時沿用上一個值
+func TestFilterReset(t *testing.T) {
+	for name, newFilter := range filters() {
+		f := newFilter()
+		for i := 0; i < 30; i++ {
+			f.Filter(float64(i), float64(i)/30)
+		}
+		last := f.Filter(100, 29.0/30)
+		if last == 100 {
+			t.Errorf("%s: measurement at the same time replaced the state", name)
+		}
+
+		f.Reset()
+		if x := f.Filter(500, 2); x != 500 {
+			t.Errorf("%s: first value after Reset %v, want 500", name, x)
+		}
+		if v := f.Velocity(); v != 0 {
+			t.Errorf("%s: velocity %v after Reset", name, v)
+		}
+		if x := f.Filter(500, 2+1.0/30); math.Abs(x-500) > 1e-9 {
+			t.Errorf("%s: steady value %v after Reset, want 500", name, x)
+		}
+	}
+}
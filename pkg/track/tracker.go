@@ -0,0 +1,124 @@
+package track
+
+import (
+	"image"
+	"sort"
+)
+
+// Option 追蹤器的設定
+type Option struct {
+	IoUThresh float32 // 偵測框與軌跡配對的最低 IoU
+	MaxAge    int     // 軌跡連續幾次沒配對到就刪除
+}
+
+func DefaultOption() Option {
+	return Option{
+		IoUThresh: 0.3,
+		MaxAge:    30,
+	}
+}
+
+// Track 單一目標的軌跡
+type Track struct {
+	ID      int
+	ClassID int
+	Box     image.Rectangle
+	Hits    int // 配對到的次數
+	Missed  int // 連續沒配對到的次數
+}
+
+// Tracker 以 IoU 貪婪配對偵測框的多目標追蹤器, 每個目標給一個遞增的 ID
+type Tracker struct {
+	opt    Option
+	tracks []*Track
+	lost   []int
+	nextID int
+}
+
+func New(opt Option) *Tracker {
+	return &Tracker{opt: opt, nextID: 1}
+}
+
+// Update 以這一幀的偵測框更新軌跡, 回傳每個偵測框的軌跡 ID.
+// classIds 為 nil 時不分類別配對
+func (t *Tracker) Update(boxes []image.Rectangle, classIds []int) []int {
+	type pair struct {
+		track, det int
+		iou        float32
+	}
+	pairs := []pair{}
+	for i, tr := range t.tracks {
+		for j, box := range boxes {
+			if classIds != nil && classIds[j] != tr.ClassID {
+				continue
+			}
+			if v := iou(tr.Box, box); v >= t.opt.IoUThresh {
+				pairs = append(pairs, pair{i, j, v})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].iou > pairs[b].iou })
+
+	ids := make([]int, len(boxes))
+	matched := make([]bool, len(t.tracks))
+	for _, p := range pairs {
+		if matched[p.track] || ids[p.det] != 0 {
+			continue
+		}
+		matched[p.track] = true
+		tr := t.tracks[p.track]
+		tr.Box = boxes[p.det]
+		tr.Hits++
+		tr.Missed = 0
+		ids[p.det] = tr.ID
+	}
+
+	t.lost = t.lost[:0]
+	alive := t.tracks[:0]
+	for i, tr := range t.tracks {
+		if !matched[i] {
+			tr.Missed++
+			if tr.Missed > t.opt.MaxAge {
+				t.lost = append(t.lost, tr.ID)
+				continue
+			}
+		}
+		alive = append(alive, tr)
+	}
+	t.tracks = alive
+
+	for j, box := range boxes {
+		if ids[j] != 0 {
+			continue
+		}
+		tr := &Track{ID: t.nextID, Box: box, Hits: 1}
+		if classIds != nil {
+			tr.ClassID = classIds[j]
+		}
+		t.nextID++
+		t.tracks = append(t.tracks, tr)
+		ids[j] = tr.ID
+	}
+	return ids
+}
+
+// Tracks 目前存活的軌跡
+func (t *Tracker) Tracks() []*Track { return t.tracks }
+
+func (t *Tracker) Option() Option { return t.opt }
+
+// Lost 上一次 Update 刪除的軌跡 ID
+func (t *Tracker) Lost() []int { return t.lost }
+
+func iou(a, b image.Rectangle) float32 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	interArea := inter.Dx() * inter.Dy()
+	unionArea := a.Dx()*a.Dy() + b.Dx()*b.Dy() - interArea
+	if unionArea <= 0 {
+		return 0
+	}
+	return float32(interArea) / float32(unionArea)
+}
@@ -0,0 +1,65 @@
+package track
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+// box 寬 100 高 100, 左上角在 (x, 0)
+func box(x int) image.Rectangle { return image.Rect(x, 0, x+100, 100) }
+
+// 依 IoU 由高到低貪婪配對, 每條軌跡及每個偵測框最多配對一次
+func TestTrackerMatch(t *testing.T) {
+	cases := []struct {
+		name    string
+		first   []image.Rectangle
+		second  []image.Rectangle
+		classes [2][]int
+		want    string // 第二幀的 ID
+	}{
+		{"moved slightly", []image.Rectangle{box(0), box(300)}, []image.Rectangle{box(310), box(10)}, [2][]int{}, "[2 1]"},
+		{"highest IoU wins", []image.Rectangle{box(0), box(50)}, []image.Rectangle{box(45)}, [2][]int{}, "[2]"},
+		{"crossing boxes", []image.Rectangle{box(0), box(50)}, []image.Rectangle{box(10), box(45)}, [2][]int{}, "[1 2]"},
+		{"below IoU threshold", []image.Rectangle{box(0)}, []image.Rectangle{box(70)}, [2][]int{}, "[2]"},
+		{"same class", []image.Rectangle{box(0)}, []image.Rectangle{box(5)}, [2][]int{{3}, {3}}, "[1]"},
+		{"other class", []image.Rectangle{box(0)}, []image.Rectangle{box(5)}, [2][]int{{3}, {4}}, "[2]"},
+	}
+	for _, c := range cases {
+		tr := New(DefaultOption())
+		tr.Update(c.first, c.classes[0])
+		if got := fmt.Sprint(tr.Update(c.second, c.classes[1])); got != c.want {
+			t.Errorf("%s: ids %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+// 連續 MaxAge 次沒配對到仍保留, 超過時刪除並出現在 Lost, ID 不重複使用
+func TestTrackerExpire(t *testing.T) {
+	tr := New(Option{IoUThresh: 0.3, MaxAge: 2})
+	tr.Update([]image.Rectangle{box(0), box(300)}, nil)
+	for i := 1; i <= 2; i++ {
+		tr.Update([]image.Rectangle{box(300)}, nil)
+		if len(tr.Tracks()) != 2 || len(tr.Lost()) != 0 {
+			t.Fatalf("miss %d: %d tracks, lost %v", i, len(tr.Tracks()), tr.Lost())
+		}
+		if missed := tr.Tracks()[0].Missed; missed != i {
+			t.Errorf("miss %d: Missed %d", i, missed)
+		}
+	}
+	tr.Update([]image.Rectangle{box(300)}, nil)
+	if fmt.Sprint(tr.Lost()) != "[1]" || len(tr.Tracks()) != 1 || tr.Tracks()[0].ID != 2 {
+		t.Fatalf("after 3 misses: lost %v, %d tracks", tr.Lost(), len(tr.Tracks()))
+	}
+	if hits := tr.Tracks()[0].Hits; hits != 4 {
+		t.Errorf("track 2 hits %d, want 4", hits)
+	}
+
+	// 回到原來的位置也是新的軌跡
+	if ids := tr.Update([]image.Rectangle{box(0), box(300)}, nil); fmt.Sprint(ids) != "[3 2]" {
+		t.Errorf("ids %v, want [3 2]", ids)
+	}
+	if len(tr.Lost()) != 0 {
+		t.Errorf("lost %v, want none", tr.Lost())
+	}
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// ClipOption 事件片段錄影的設定
+type ClipOption struct {
+	Dir       string  // 片段及 JSON 的輸出資料夾
+	Ext       string  // 片段的副檔名, .mp4 或 .avi
+	PreRoll   float64 // 事件前保留的秒數
+	PostRoll  float64 // 最後一次事件後繼續錄的秒數
+	MaxClips  int     // 最多保留幾個片段, 0 為不限
+	MaxBytes  int64   // 片段總大小上限, 0 為不限
+	Quality   int     // 事件前的緩衝以 JPEG 保存的品質, 1080p 每幀約 0.2 ~ 0.5 MB 而不是 6 MB
+	RingBytes int64   // 緩衝的大小上限, 超過時丟掉最舊的幀, 0 為不限
+}
+
+func DefaultClipOption() ClipOption {
+	return ClipOption{
+		Dir:       "clips",
+		Ext:       ".mp4",
+		PreRoll:   5,
+		PostRoll:  5,
+		Quality:   90,
+		RingBytes: 64 << 20,
+	}
+}
+
+// ClipEvent 觸發錄影的事件
+type ClipEvent struct {
+	Time       float64 `json:"time"`
+	Frame      int     `json:"frame"`
+	Type       string  `json:"type"`
+	Name       string  `json:"name,omitempty"`
+	Detections any     `json:"detections,omitempty"`
+}
+
+// ClipSidecar 與片段同名的 JSON
+type ClipSidecar struct {
+	Video      string      `json:"video"`
+	Start      float64     `json:"start"` // 片段開始及結束在影片中的秒數
+	End        float64     `json:"end"`
+	StartFrame int         `json:"start_frame"`
+	Frames     int         `json:"frames"`
+	Events     []ClipEvent `json:"events"`
+}
+
+type clipFrame struct {
+	jpeg  []byte
+	t     float64
+	index int
+}
+
+// ClipRecorder 以環形緩衝保留最近 PreRoll 秒的幀 (JPEG), 事件發生時連同之後 PostRoll 秒寫成片段
+type ClipRecorder struct {
+	opt   ClipOption
+	fps   float64
+	ring  []clipFrame
+	bytes int64             // 緩衝中 JPEG 的總大小
+	vw    *gocv.VideoWriter // 錄影中但還沒有幀時為 nil
+	on    bool
+	until float64 // 錄到這個時間為止
+	clip  ClipSidecar
+	saved []string
+}
+
+func NewClipRecorder(opt ClipOption, fps float64) (*ClipRecorder, error) {
+	if err := os.MkdirAll(opt.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if opt.Ext == "" {
+		opt.Ext = ".mp4"
+	}
+	if opt.Quality <= 0 || opt.Quality > 100 {
+		opt.Quality = 90
+	}
+	return &ClipRecorder{opt: opt, fps: fps}, nil
+}
+
+// Recording 目前是否正在寫片段
+func (r *ClipRecorder) Recording() bool { return r.on }
+
+// Saved 已完成的片段
+func (r *ClipRecorder) Saved() []string { return r.saved }
+
+// Trigger 在時間 t 發生事件: 沒在錄影時以緩衝的幀開始新片段, 否則延長錄影時間.
+// 應在 Push 同一幀之前呼叫
+func (r *ClipRecorder) Trigger(events ...ClipEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if !r.on {
+		if err := r.start(events[0]); err != nil {
+			return err
+		}
+	}
+	for _, ev := range events {
+		r.clip.Events = append(r.clip.Events, ev)
+		if ev.Time+r.opt.PostRoll > r.until {
+			r.until = ev.Time + r.opt.PostRoll
+		}
+	}
+	return nil
+}
+
+func (r *ClipRecorder) start(ev ClipEvent) error {
+	name := fmt.Sprintf("clip_%s_%06d", time.Now().Format("20060102_150405"), ev.Frame)
+	if ev.Type != "" {
+		name += "_" + strings.ReplaceAll(ev.Type, " ", "_")
+	}
+	file := filepath.Join(r.opt.Dir, name+r.opt.Ext)
+
+	r.clip = ClipSidecar{Video: file, Start: ev.Time, StartFrame: ev.Frame, Events: []ClipEvent{}}
+	if len(r.ring) > 0 {
+		r.clip.Start, r.clip.StartFrame = r.ring[0].t, r.ring[0].index
+	}
+	r.on = true
+	ring := r.ring
+	r.ring, r.bytes = r.ring[:0], 0
+	for _, f := range ring {
+		img, err := gocv.IMDecode(f.jpeg, gocv.IMReadColor)
+		if err != nil {
+			return err
+		}
+		err = r.write(img, f.t)
+		img.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write 寫入片段, 第一幀時以它的大小開檔
+func (r *ClipRecorder) write(img gocv.Mat, t float64) error {
+	if r.vw == nil {
+		vw, err := gocv.VideoWriterFile(r.clip.Video, VideoCodec(r.clip.Video), r.fps, img.Cols(), img.Rows(), true)
+		if err != nil {
+			return err
+		}
+		r.vw = vw
+	}
+	r.clip.End = t
+	r.clip.Frames++
+	return r.vw.Write(img)
+}
+
+// Push 送入時間 t 的第 index 幀: 錄影中直接寫入片段, 否則放進緩衝
+func (r *ClipRecorder) Push(img gocv.Mat, t float64, index int) error {
+	if r.on {
+		if err := r.write(img, t); err != nil {
+			return err
+		}
+		if t >= r.until {
+			return r.finish()
+		}
+		return nil
+	}
+
+	buf, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, img, []int{gocv.IMWriteJpegQuality, r.opt.Quality})
+	if err != nil {
+		return err
+	}
+	jpeg := append([]byte{}, buf.GetBytes()...)
+	buf.Close()
+	r.ring = append(r.ring, clipFrame{jpeg: jpeg, t: t, index: index})
+	r.bytes += int64(len(jpeg))
+
+	drop := 0
+	for drop < len(r.ring)-1 &&
+		(t-r.ring[drop].t > r.opt.PreRoll || (r.opt.RingBytes > 0 && r.bytes > r.opt.RingBytes)) {
+		r.bytes -= int64(len(r.ring[drop].jpeg))
+		drop++
+	}
+	r.ring = r.ring[drop:]
+	return nil
+}
+
+// finish 關閉片段, 寫出 JSON 並依數量及大小刪除舊的片段
+func (r *ClipRecorder) finish() error {
+	if r.vw != nil {
+		r.vw.Close()
+	}
+	r.vw, r.on = nil, false
+	b, err := json.MarshalIndent(r.clip, "", "  ")
+	if err != nil {
+		return err
+	}
+	sidecar := strings.TrimSuffix(r.clip.Video, filepath.Ext(r.clip.Video)) + ".json"
+	if err := os.WriteFile(sidecar, b, 0644); err != nil {
+		return err
+	}
+	r.saved = append(r.saved, r.clip.Video)
+	return r.retain()
+}
+
+// retain 從最舊的片段開始刪除, 直到數量及總大小都在限制內
+func (r *ClipRecorder) retain() error {
+	if r.opt.MaxClips <= 0 && r.opt.MaxBytes <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(r.opt.Dir, "clip_*"+r.opt.Ext))
+	if err != nil {
+		return err
+	}
+	type clip struct {
+		file string
+		size int64
+		mod  time.Time
+	}
+	clips := []clip{}
+	total := int64(0)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		clips = append(clips, clip{file: file, size: info.Size(), mod: info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(clips, func(i, j int) bool { return clips[i].mod.Before(clips[j].mod) })
+
+	for len(clips) > 1 &&
+		((r.opt.MaxClips > 0 && len(clips) > r.opt.MaxClips) || (r.opt.MaxBytes > 0 && total > r.opt.MaxBytes)) {
+		old := clips[0]
+		if err := os.Remove(old.file); err != nil {
+			return err
+		}
+		os.Remove(strings.TrimSuffix(old.file, filepath.Ext(old.file)) + ".json")
+		total -= old.size
+		clips = clips[1:]
+	}
+	return nil
+}
+
+// Close 結束錄影中的片段並釋放緩衝
+func (r *ClipRecorder) Close() error {
+	r.ring, r.bytes = nil, 0
+	if r.on {
+		return r.finish()
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// ParseHexColor 解析 #RRGGBB 格式的顏色
+func ParseHexColor(s string) (color.RGBA, error) {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expect #RRGGBB", s)
+	}
+	return color.RGBA{r, g, b, 255}, nil
+}
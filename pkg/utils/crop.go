@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"image"
+	"math"
+)
+
+// CropRect 將框向外擴張 padding 比例, square 時以長邊補成正方形, 最後裁在圖片範圍內
+func CropRect(rect image.Rectangle, padding float64, square bool, imageWidth, imageHeight int) image.Rectangle {
+	cx := float64(rect.Min.X+rect.Max.X) / 2
+	cy := float64(rect.Min.Y+rect.Max.Y) / 2
+	w := float64(rect.Dx()) * (1 + padding*2)
+	h := float64(rect.Dy()) * (1 + padding*2)
+	if square {
+		w = math.Max(w, h)
+		h = w
+	}
+	return image.Rect(
+		NormalizePoint(cx-w/2, imageWidth),
+		NormalizePoint(cy-h/2, imageHeight),
+		NormalizePoint(cx+w/2, imageWidth),
+		NormalizePoint(cy+h/2, imageHeight),
+	)
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// FlowOption 關鍵幀之間以光流傳播偵測框的設定
+type FlowOption struct {
+	Interval   int     // 每幾幀跑一次偵測, 其餘幀以光流傳播
+	MaxCorners int     // 每個框取的特徵點數量上限
+	MinPoints  int     // 追蹤成功的特徵點少於此值時視為光流不可靠
+	MaxError   float32 // 特徵點的追蹤誤差上限
+	Decay      float32 // 每傳播一幀分數乘上的比例
+	MinScore   float32 // 傳播後分數低於此值時提早重新偵測
+}
+
+func DefaultFlowOption() FlowOption {
+	return FlowOption{
+		Interval:   5,
+		MaxCorners: 30,
+		MinPoints:  5,
+		MaxError:   20,
+		Decay:      0.95,
+		MinScore:   0.2,
+	}
+}
+
+// BoxFlow 以 CalcOpticalFlowPyrLK 追蹤框內的特徵點, 把上一幀的框移到目前這一幀
+type BoxFlow struct {
+	opt  FlowOption
+	prev gocv.Mat // 上一幀的灰階圖
+
+	propagated int
+	failed     int
+}
+
+func NewBoxFlow(opt FlowOption) *BoxFlow {
+	return &BoxFlow{opt: opt, prev: gocv.NewMat()}
+}
+
+func (f *BoxFlow) gray(img gocv.Mat) gocv.Mat {
+	gray := gocv.NewMat()
+	gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+	return gray
+}
+
+func (f *BoxFlow) Option() FlowOption { return f.opt }
+
+// Stats 回傳傳播成功及光流不可靠的幀數
+func (f *BoxFlow) Stats() (propagated, failed int) { return f.propagated, f.failed }
+
+// Keyframe 記住偵測過的這一幀, 作為下一次傳播的起點
+func (f *BoxFlow) Keyframe(img gocv.Mat) {
+	f.prev.Close()
+	f.prev = f.gray(img)
+}
+
+// Propagate 把上一幀的框移到 img, 以特徵點位移的中位數平移, 以到中心距離比例的中位數縮放.
+// 小於 8 像素的框取不到可靠的特徵點, 留在原處沿用 (分數由呼叫端遞減).
+// 其他任一框的光流不可靠時 ok 為 false, 應該重新偵測
+func (f *BoxFlow) Propagate(img gocv.Mat, boxes []image.Rectangle) (moved []image.Rectangle, ok bool) {
+	next := f.gray(img)
+	defer func() {
+		f.prev.Close()
+		f.prev = next
+		if ok {
+			f.propagated++
+		} else {
+			f.failed++
+		}
+	}()
+	if f.prev.Empty() || len(boxes) == 0 {
+		return boxes, len(boxes) == 0
+	}
+
+	// 收集每個框內的特徵點
+	type feature struct {
+		box  int
+		x, y float32
+	}
+	features := []feature{}
+	small := make([]bool, len(boxes))
+	bounds := image.Rect(0, 0, f.prev.Cols(), f.prev.Rows())
+	for i, box := range boxes {
+		box = box.Intersect(bounds)
+		if box.Dx() < 8 || box.Dy() < 8 {
+			small[i] = true
+			continue
+		}
+		region := f.prev.Region(box)
+		corners := gocv.NewMat()
+		gocv.GoodFeaturesToTrack(region, &corners, f.opt.MaxCorners, 0.01, 3)
+		for k := 0; k < corners.Rows(); k++ {
+			features = append(features, feature{
+				box: i,
+				x:   corners.GetFloatAt(k, 0) + float32(box.Min.X),
+				y:   corners.GetFloatAt(k, 1) + float32(box.Min.Y),
+			})
+		}
+		corners.Close()
+		region.Close()
+	}
+	if len(features) == 0 {
+		for _, s := range small {
+			if !s {
+				return boxes, false
+			}
+		}
+		return boxes, true
+	}
+
+	prevPts := gocv.NewMatWithSize(len(features), 1, gocv.MatTypeCV32FC2)
+	defer prevPts.Close()
+	for k, ft := range features {
+		prevPts.SetFloatAt(k, 0, ft.x)
+		prevPts.SetFloatAt(k, 1, ft.y)
+	}
+	nextPts := gocv.NewMat()
+	defer nextPts.Close()
+	status := gocv.NewMat()
+	defer status.Close()
+	errs := gocv.NewMat()
+	defer errs.Close()
+	gocv.CalcOpticalFlowPyrLK(f.prev, next, prevPts, nextPts, &status, &errs)
+
+	dxs := make([][]float64, len(boxes))
+	dys := make([][]float64, len(boxes))
+	tracked := make([][][4]float64, len(boxes)) // 每個點的 (前 x, 前 y, 後 x, 後 y)
+	for k, ft := range features {
+		if status.GetUCharAt(k, 0) == 0 || errs.GetFloatAt(k, 0) > f.opt.MaxError {
+			continue
+		}
+		nx, ny := float64(nextPts.GetFloatAt(k, 0)), float64(nextPts.GetFloatAt(k, 1))
+		dxs[ft.box] = append(dxs[ft.box], nx-float64(ft.x))
+		dys[ft.box] = append(dys[ft.box], ny-float64(ft.y))
+		tracked[ft.box] = append(tracked[ft.box], [4]float64{float64(ft.x), float64(ft.y), nx, ny})
+	}
+
+	moved = make([]image.Rectangle, len(boxes))
+	ok = true
+	for i, box := range boxes {
+		if small[i] {
+			moved[i] = box
+			continue
+		}
+		if len(dxs[i]) < f.opt.MinPoints {
+			moved[i] = box
+			ok = false
+			continue
+		}
+		dx, dy := median(dxs[i]), median(dys[i])
+
+		// 縮放: 特徵點到中心的距離在前後兩幀的比例
+		cx0, cy0, cx1, cy1 := 0.0, 0.0, 0.0, 0.0
+		for _, p := range tracked[i] {
+			cx0, cy0, cx1, cy1 = cx0+p[0], cy0+p[1], cx1+p[2], cy1+p[3]
+		}
+		n := float64(len(tracked[i]))
+		cx0, cy0, cx1, cy1 = cx0/n, cy0/n, cx1/n, cy1/n
+		ratios := []float64{}
+		for _, p := range tracked[i] {
+			d0 := math.Hypot(p[0]-cx0, p[1]-cy0)
+			d1 := math.Hypot(p[2]-cx1, p[3]-cy1)
+			if d0 > 1 {
+				ratios = append(ratios, d1/d0)
+			}
+		}
+		scale := 1.0
+		if len(ratios) > 0 {
+			scale = math.Max(0.8, math.Min(1.25, median(ratios)))
+		}
+
+		w, h := float64(box.Dx())*scale, float64(box.Dy())*scale
+		cx := float64(box.Min.X+box.Max.X)/2 + dx
+		cy := float64(box.Min.Y+box.Max.Y)/2 + dy
+		moved[i] = image.Rect(
+			NormalizePoint(cx-w/2, img.Cols()),
+			NormalizePoint(cy-h/2, img.Rows()),
+			NormalizePoint(cx+w/2, img.Cols()),
+			NormalizePoint(cy+h/2, img.Rows()),
+		)
+		if moved[i].Empty() {
+			ok = false
+		}
+	}
+	return moved, ok
+}
+
+func (f *BoxFlow) Close() { f.prev.Close() }
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"sync"
+
+	"go-onnxruntime-example/pkg/gocv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Font 以 TrueType/OpenType 字型畫文字, 可顯示 Hershey 字型不支援的中文.
+// opentype 的 Face 不能同時使用, 多個 session 共用時以 mu 保護
+type Font struct {
+	mu   sync.Mutex
+	face font.Face
+}
+
+// LoadFont 讀取 TTF/OTF 字型檔 (TTC 取第一個字型), size 為像素大小
+func LoadFont(filename string, size float64) (*Font, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f *opentype.Font
+	if collection, err := opentype.ParseCollection(b); err == nil && collection.NumFonts() > 0 {
+		f, err = collection.Font(0)
+		if err != nil {
+			return nil, err
+		}
+	} else if f, err = opentype.Parse(b); err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Font{face: face}, nil
+}
+
+// TextSize 回傳文字寬度, 基線以上的高度 (ascent) 及基線以下的高度 (descent)
+func (f *Font) TextSize(text string) (width, ascent, descent int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.textSize(text)
+}
+
+func (f *Font) textSize(text string) (width, ascent, descent int) {
+	metrics := f.face.Metrics()
+	return font.MeasureString(f.face, text).Ceil(), metrics.Ascent.Ceil(), metrics.Descent.Ceil()
+}
+
+// PutText 在 org (基線左端) 畫文字, 以字形的覆蓋率和底圖做 alpha 合成
+func (f *Font) PutText(img *gocv.Mat, text string, org image.Point, _color color.RGBA) {
+	// 只有量測及畫遮罩用到 face, 與底圖的合成不需要鎖
+	f.mu.Lock()
+	width, ascent, descent := f.textSize(text)
+	rect := image.Rect(org.X, org.Y-ascent, org.X+width, org.Y+descent)
+	clip := rect.Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if clip.Empty() {
+		f.mu.Unlock()
+		return
+	}
+
+	// 先把文字畫成覆蓋率遮罩
+	coverage := image.NewAlpha(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	drawer := font.Drawer{
+		Dst:  coverage,
+		Src:  image.Opaque,
+		Face: f.face,
+		Dot:  fixed.P(0, ascent),
+	}
+	drawer.DrawString(text)
+	f.mu.Unlock()
+
+	roi := img.Region(clip)
+	defer roi.Close()
+	patch := roi.Clone()
+	defer patch.Close()
+	data, err := patch.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	channels := patch.Channels()
+	bgr := [3]int{int(_color.B), int(_color.G), int(_color.R)}
+	for y := 0; y < clip.Dy(); y++ {
+		for x := 0; x < clip.Dx(); x++ {
+			a := int(coverage.AlphaAt(clip.Min.X-rect.Min.X+x, clip.Min.Y-rect.Min.Y+y).A)
+			if a == 0 {
+				continue
+			}
+			i := (y*clip.Dx() + x) * channels
+			for c := 0; c < channels && c < 3; c++ {
+				data[i+c] = uint8((int(data[i+c])*(255-a) + bgr[c]*a) / 255)
+			}
+		}
+	}
+	patch.CopyTo(&roi)
+}
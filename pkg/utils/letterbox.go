@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// Letterbox 等比例縮放到 size 之內並置中, 其餘部分補灰邊,
+// 回傳縮放比例及左上角的補邊量, 原圖座標 = (letterbox 座標 - pad) / scale
+func Letterbox(img gocv.Mat, size image.Point) (gocv.Mat, float64, image.Point) {
+	scale := math.Min(
+		float64(size.X)/float64(img.Cols()),
+		float64(size.Y)/float64(img.Rows()),
+	)
+	w := int(math.Round(float64(img.Cols()) * scale))
+	h := int(math.Round(float64(img.Rows()) * scale))
+
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(img, &resized, image.Pt(w, h), 0, 0, gocv.InterpolationLinear)
+
+	left := (size.X - w) / 2
+	top := (size.Y - h) / 2
+	dst := gocv.NewMat()
+	gocv.CopyMakeBorder(resized, &dst, top, size.Y-h-top, left, size.X-w-left, gocv.BorderConstant, color.RGBA{114, 114, 114, 0})
+	return dst, scale, image.Pt(left, top)
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"image"
+	"math/bits"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// Polygon 帶有孔洞的多邊形
+type Polygon struct {
+	Outer []image.Point   `json:"outer"`
+	Holes [][]image.Point `json:"holes,omitempty"`
+}
+
+// LargestContour 找出二值遮罩中面積最大的外輪廓, 座標加上 offset
+func LargestContour(mask gocv.Mat, offset image.Point) []image.Point {
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	maxAreaIdx := -1
+	maxArea := -1.0
+	for i := 0; i < contours.Size(); i++ { // 找出最大面積
+		area := gocv.ContourArea(contours.At(i))
+		if area > maxArea {
+			maxAreaIdx = i
+			maxArea = area
+		}
+	}
+
+	pts := []image.Point{}
+	if maxAreaIdx >= 0 {
+		pts = contours.At(maxAreaIdx).ToPoints()
+	}
+	for i := range pts {
+		pts[i] = pts[i].Add(offset)
+	}
+	return pts
+}
+
+// ContourPolygons 以 RetrievalCComp 取出二值遮罩的所有外輪廓及其孔洞, 座標加上 offset
+func ContourPolygons(mask gocv.Mat, offset image.Point) []Polygon {
+	hierarchy := gocv.NewMat()
+	defer hierarchy.Close()
+	contours := gocv.FindContoursWithParams(mask, &hierarchy, gocv.RetrievalCComp, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	toPoints := func(i int) []image.Point {
+		pts := contours.At(i).ToPoints()
+		for k := range pts {
+			pts[k] = pts[k].Add(offset)
+		}
+		return pts
+	}
+
+	polygons := []Polygon{}
+	for i := 0; i < contours.Size(); i++ {
+		// hierarchy: [next, previous, first child, parent]
+		h := hierarchy.GetVeciAt(0, i)
+		if h[3] >= 0 {
+			continue
+		}
+		polygon := Polygon{Outer: toPoints(i)}
+		for child := int(h[2]); child >= 0; child = int(hierarchy.GetVeciAt(0, child)[0]) {
+			polygon.Holes = append(polygon.Holes, toPoints(child))
+		}
+		polygons = append(polygons, polygon)
+	}
+	return polygons
+}
+
+// Bitmask 以位元儲存的二值遮罩, 只保存 Rect 範圍內的像素
+type Bitmask struct {
+	Rect image.Rectangle // 遮罩在原圖上的範圍
+	bits []uint64
+}
+
+// NewBitmask 由二值遮罩 (非零為前景) 建立 Bitmask, offset 為遮罩左上角在原圖上的位置
+func NewBitmask(mask gocv.Mat, offset image.Point) *Bitmask {
+	w, h := mask.Cols(), mask.Rows()
+	bm := &Bitmask{
+		Rect: image.Rect(0, 0, w, h).Add(offset),
+		bits: make([]uint64, (w*h+63)/64),
+	}
+
+	src := mask
+	if mask.Type() != gocv.MatTypeCV8UC1 || !mask.IsContinuous() {
+		src = gocv.NewMat()
+		defer src.Close()
+		mask.ConvertTo(&src, gocv.MatTypeCV8UC1)
+	}
+	data := src.ToBytes()
+	for i, v := range data {
+		if v != 0 {
+			bm.bits[i/64] |= 1 << (i % 64)
+		}
+	}
+	return bm
+}
+
+// At 回傳原圖座標 (x, y) 是否為前景
+func (bm *Bitmask) At(x, y int) bool {
+	if !image.Pt(x, y).In(bm.Rect) {
+		return false
+	}
+	i := (y-bm.Rect.Min.Y)*bm.Rect.Dx() + (x - bm.Rect.Min.X)
+	return bm.bits[i/64]&(1<<(i%64)) != 0
+}
+
+// Area 前景像素數量
+func (bm *Bitmask) Area() int {
+	area := 0
+	for _, v := range bm.bits {
+		area += bits.OnesCount64(v)
+	}
+	return area
+}
+
+// Mat 轉成 Rect 大小的 CV8UC1 遮罩 (前景為 255)
+func (bm *Bitmask) Mat() gocv.Mat {
+	w, h := bm.Rect.Dx(), bm.Rect.Dy()
+	buf := make([]byte, w*h)
+	for i := range buf {
+		if bm.bits[i/64]&(1<<(i%64)) != 0 {
+			buf[i] = 255
+		}
+	}
+	return bytesToMask(h, w, buf)
+}
+
+// bytesToMask 在 Go 填好像素後一次建立 Mat, 避免逐像素呼叫 cgo
+func bytesToMask(rows, cols int, buf []byte) gocv.Mat {
+	if len(buf) == 0 {
+		return gocv.Zeros(rows, cols, gocv.MatTypeCV8UC1)
+	}
+	mat, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8UC1, buf)
+	if err != nil {
+		return gocv.Zeros(rows, cols, gocv.MatTypeCV8UC1)
+	}
+	return mat
+}
+
+// MergeBitmasks 取多個遮罩的聯集
+func MergeBitmasks(masks []*Bitmask) *Bitmask {
+	rect := image.Rectangle{}
+	for _, m := range masks {
+		rect = rect.Union(m.Rect)
+	}
+	merged := &Bitmask{
+		Rect: rect,
+		bits: make([]uint64, (rect.Dx()*rect.Dy()+63)/64),
+	}
+	for _, m := range masks {
+		for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+			for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+				if m.At(x, y) {
+					i := (y-rect.Min.Y)*rect.Dx() + (x - rect.Min.X)
+					merged.bits[i/64] |= 1 << (i % 64)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// ToMat 轉成原圖大小的 CV8UC1 遮罩 (前景為 255)
+func (bm *Bitmask) ToMat(imageWidth, imageHeight int) gocv.Mat {
+	buf := make([]byte, imageWidth*imageHeight)
+	rect := bm.Rect.Intersect(image.Rect(0, 0, imageWidth, imageHeight))
+	w := bm.Rect.Dx()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := (y - bm.Rect.Min.Y) * w
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := row + x - bm.Rect.Min.X
+			if bm.bits[i/64]&(1<<(i%64)) != 0 {
+				buf[y*imageWidth+x] = 255
+			}
+		}
+	}
+	return bytesToMask(imageHeight, imageWidth, buf)
+}
+
+// RLE COCO 格式的 run-length encoding (column-major, 從背景開始計數)
+type RLE struct {
+	Size   [2]int `json:"size"` // [height, width]
+	Counts []int  `json:"counts"`
+}
+
+// RLE 以原圖大小編碼成 COCO 的 RLE
+func (bm *Bitmask) RLE(imageWidth, imageHeight int) RLE {
+	rle := RLE{Size: [2]int{imageHeight, imageWidth}, Counts: []int{}}
+	current := false
+	run := 0
+	for x := 0; x < imageWidth; x++ {
+		for y := 0; y < imageHeight; y++ {
+			if bm.At(x, y) != current {
+				rle.Counts = append(rle.Counts, run)
+				current = !current
+				run = 0
+			}
+			run++
+		}
+	}
+	rle.Counts = append(rle.Counts, run)
+	return rle
+}
+
+// String 以 pycocotools 的壓縮字串格式輸出 counts
+func (rle RLE) String() string {
+	s := []byte{}
+	for i, count := range rle.Counts {
+		x := count
+		if i > 2 {
+			x -= rle.Counts[i-2]
+		}
+		for more := true; more; {
+			c := x & 0x1f
+			x >>= 5
+			if c&0x10 != 0 {
+				more = x != -1
+			} else {
+				more = x != 0
+			}
+			if more {
+				c |= 0x20
+			}
+			s = append(s, byte(c+48))
+		}
+	}
+	return string(s)
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// IoU 計算兩個框的交集比聯集
+func IoU(a, b image.Rectangle) float32 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	interArea := inter.Dx() * inter.Dy()
+	unionArea := a.Dx()*a.Dy() + b.Dx()*b.Dy() - interArea
+	if unionArea <= 0 {
+		return 0
+	}
+	return float32(interArea) / float32(unionArea)
+}
+
+// IoS 計算兩個框的交集比較小框的面積, 用於切片接縫被截斷的框
+func IoS(a, b image.Rectangle) float32 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	smaller := a.Dx() * a.Dy()
+	if area := b.Dx() * b.Dy(); area < smaller {
+		smaller = area
+	}
+	if smaller <= 0 {
+		return 0
+	}
+	return float32(inter.Dx()*inter.Dy()) / float32(smaller)
+}
+
+type wbfCluster struct {
+	classId int
+	box     [4]float32
+	boxes   []image.Rectangle
+	scores  []float32
+}
+
+func (c *wbfCluster) fuse() {
+	var sum float32
+	c.box = [4]float32{}
+	for i, b := range c.boxes {
+		s := c.scores[i]
+		sum += s
+		c.box[0] += float32(b.Min.X) * s
+		c.box[1] += float32(b.Min.Y) * s
+		c.box[2] += float32(b.Max.X) * s
+		c.box[3] += float32(b.Max.Y) * s
+	}
+	for i := range c.box {
+		c.box[i] /= sum
+	}
+}
+
+func (c *wbfCluster) rect() image.Rectangle {
+	return image.Rect(
+		int(math.Round(float64(c.box[0]))),
+		int(math.Round(float64(c.box[1]))),
+		int(math.Round(float64(c.box[2]))),
+		int(math.Round(float64(c.box[3]))),
+	)
+}
+
+// WeightedBoxesFusion 加權框融合 (WBF)
+// 同類別且 IoU 超過門檻的框會依分數加權平均成一個框,
+// 分數取平均後再乘上 min(框數, passes) / passes, 只在少數幾次推論出現的框會被降分
+func WeightedBoxesFusion(
+	boxes []image.Rectangle,
+	scores []float32,
+	classIds []int,
+	iouThresh float32,
+	passes int,
+) ([]image.Rectangle, []float32, []int) {
+	if passes <= 0 {
+		passes = 1
+	}
+
+	order := make([]int, len(boxes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	clusters := []*wbfCluster{}
+	for _, idx := range order {
+		var best *wbfCluster
+		bestIoU := iouThresh
+		for _, c := range clusters {
+			if c.classId != classIds[idx] {
+				continue
+			}
+			if iou := IoU(c.rect(), boxes[idx]); iou > bestIoU {
+				best, bestIoU = c, iou
+			}
+		}
+		if best == nil {
+			best = &wbfCluster{classId: classIds[idx]}
+			clusters = append(clusters, best)
+		}
+		best.boxes = append(best.boxes, boxes[idx])
+		best.scores = append(best.scores, scores[idx])
+		best.fuse()
+	}
+
+	fusedBoxes := make([]image.Rectangle, 0, len(clusters))
+	fusedScores := make([]float32, 0, len(clusters))
+	fusedIds := make([]int, 0, len(clusters))
+	for _, c := range clusters {
+		var sum float32
+		for _, s := range c.scores {
+			sum += s
+		}
+		n := len(c.scores)
+		if n > passes {
+			n = passes
+		}
+		fusedBoxes = append(fusedBoxes, c.rect())
+		fusedScores = append(fusedScores, sum/float32(len(c.scores))*float32(n)/float32(passes))
+		fusedIds = append(fusedIds, c.classId)
+	}
+	return fusedBoxes, fusedScores, fusedIds
+}
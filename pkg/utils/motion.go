@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"image"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// MotionOption 動態閘門的設定
+type MotionOption struct {
+	Method    string  // 背景相減的方法: mog2 或 knn
+	Threshold float64 // 前景像素比例低於此值時跳過推論
+	ROI       bool    // 只在動態區域推論
+	MinArea   int     // 動態區域的最小面積 (原圖像素)
+	Padding   float64 // 動態區域向外擴張的比例
+	Scale     float64 // 背景相減前縮小的比例, 節省 CPU
+	Refresh   int     // 最多連續幾幀沒有整張推論, 到了就強制整張推論一次, 清掉沿用的舊結果; 0 為不強制
+}
+
+func DefaultMotionOption() MotionOption {
+	return MotionOption{
+		Method:    "mog2",
+		Threshold: 0.002,
+		MinArea:   400,
+		Padding:   0.2,
+		Scale:     0.5,
+		Refresh:   30,
+	}
+}
+
+// MotionGate 以背景相減判斷畫面是否有變化, 沒有變化時跳過推論
+type MotionGate struct {
+	opt       MotionOption
+	mog2      *gocv.BackgroundSubtractorMOG2
+	knn       *gocv.BackgroundSubtractorKNN
+	kernel    gocv.Mat
+	frames    int
+	skipped   int
+	sinceFull int // 距離上一次整張推論的幀數
+}
+
+func NewMotionGate(opt MotionOption) *MotionGate {
+	g := &MotionGate{
+		opt:    opt,
+		kernel: gocv.GetStructuringElement(gocv.MorphEllipse, image.Pt(3, 3)),
+	}
+	if opt.Method == "knn" {
+		knn := gocv.NewBackgroundSubtractorKNNWithParams(500, 400, true)
+		g.knn = &knn
+	} else {
+		mog2 := gocv.NewBackgroundSubtractorMOG2WithParams(500, 16, true)
+		g.mog2 = &mog2
+	}
+	return g
+}
+
+// Detect 更新背景模型, 回傳前景比例, 是否需要推論, 以及 ROI 模式下的動態區域 (原圖座標).
+// 連續 Refresh 幀沒有整張推論時, 不論有沒有變化都回傳整張推論
+func (g *MotionGate) Detect(img gocv.Mat) (ratio float64, run bool, rois []image.Rectangle) {
+	g.frames++
+	ratio, run, rois = g.detect(img)
+	if (!run || rois != nil) && g.opt.Refresh > 0 && g.sinceFull >= g.opt.Refresh {
+		run, rois = true, nil
+	}
+	if !run {
+		g.skipped++
+	}
+	if run && rois == nil {
+		g.sinceFull = 0
+	} else {
+		g.sinceFull++
+	}
+	return ratio, run, rois
+}
+
+func (g *MotionGate) detect(img gocv.Mat) (ratio float64, run bool, rois []image.Rectangle) {
+	scale := g.opt.Scale
+	if scale <= 0 || scale > 1 {
+		scale = 1
+	}
+
+	small := img
+	if scale < 1 {
+		small = gocv.NewMat()
+		defer small.Close()
+		gocv.Resize(img, &small, image.Point{}, scale, scale, gocv.InterpolationArea)
+	}
+
+	fg := gocv.NewMat()
+	defer fg.Close()
+	if g.knn != nil {
+		g.knn.Apply(small, &fg)
+	} else {
+		g.mog2.Apply(small, &fg)
+	}
+	// 陰影 (127) 不算前景, 再以斷開去除雜訊
+	gocv.Threshold(fg, &fg, 200, 255, gocv.ThresholdBinary)
+	gocv.MorphologyEx(fg, &fg, gocv.MorphOpen, g.kernel)
+
+	total := fg.Rows() * fg.Cols()
+	if total > 0 {
+		ratio = float64(gocv.CountNonZero(fg)) / float64(total)
+	}
+	if ratio < g.opt.Threshold {
+		return ratio, false, nil
+	}
+	if !g.opt.ROI {
+		return ratio, true, nil
+	}
+
+	gocv.Dilate(fg, &fg, g.kernel)
+	contours := gocv.FindContours(fg, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+	for i := 0; i < contours.Size(); i++ {
+		r := gocv.BoundingRect(contours.At(i))
+		r = image.Rect(
+			int(float64(r.Min.X)/scale), int(float64(r.Min.Y)/scale),
+			int(float64(r.Max.X)/scale), int(float64(r.Max.Y)/scale),
+		)
+		if r.Dx()*r.Dy() < g.opt.MinArea {
+			continue
+		}
+		rois = append(rois, CropRect(r, g.opt.Padding, false, img.Cols(), img.Rows()))
+	}
+	if len(rois) == 0 {
+		return ratio, false, nil
+	}
+	return ratio, true, MergeRects(rois)
+}
+
+// Stats 處理的幀數及跳過推論的幀數
+func (g *MotionGate) Stats() (frames, skipped int) { return g.frames, g.skipped }
+
+// SkipRate 跳過推論的比例
+func (g *MotionGate) SkipRate() float64 {
+	if g.frames == 0 {
+		return 0
+	}
+	return float64(g.skipped) / float64(g.frames)
+}
+
+func (g *MotionGate) Close() {
+	if g.knn != nil {
+		g.knn.Close()
+	}
+	if g.mog2 != nil {
+		g.mog2.Close()
+	}
+	g.kernel.Close()
+}
+
+// MergeRects 反覆合併互相重疊的框, 直到沒有重疊
+func MergeRects(rects []image.Rectangle) []image.Rectangle {
+	merged := append([]image.Rectangle{}, rects...)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(merged) && !changed; i++ {
+			for j := i + 1; j < len(merged); j++ {
+				if merged[i].Overlaps(merged[j]) {
+					merged[i] = merged[i].Union(merged[j])
+					merged = append(merged[:j], merged[j+1:]...)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return merged
+}
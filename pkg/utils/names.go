@@ -1,6 +1,10 @@
 package utils
 
-import "strings"
+import (
+	"image"
+	"strconv"
+	"strings"
+)
 
 func MetadataToNames(_names string) []string {
 	names := []string{}
@@ -13,3 +17,35 @@ func MetadataToNames(_names string) []string {
 	}
 	return names
 }
+
+// InputSize 模型輸入的寬高, dims 為 [N C H W]. 動態輸入 (<= 0) 時取 metadata 的 imgsz (例如 "[640, 640]", 高在前),
+// 都沒有時為 640x640
+func InputSize(dims []int64, imgsz string) image.Point {
+	if len(dims) == 4 && dims[2] > 0 && dims[3] > 0 {
+		return image.Pt(int(dims[3]), int(dims[2]))
+	}
+	size := []int{}
+	for _, s := range strings.Split(strings.Trim(imgsz, "[] "), ",") {
+		if v, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && v > 0 {
+			size = append(size, v)
+		}
+	}
+	switch len(size) {
+	case 1:
+		return image.Pt(size[0], size[0])
+	case 2:
+		return image.Pt(size[1], size[0])
+	}
+	return image.Pt(640, 640)
+}
+
+// SplitList 拆開以逗號分隔的參數, 去掉空白及空的項目
+func SplitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
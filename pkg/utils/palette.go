@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UltralyticsPalette Ultralytics 的 20 色調色盤, 依類別編號循環使用
+var UltralyticsPalette = []color.RGBA{
+	{0xFF, 0x38, 0x38, 255}, {0xFF, 0x9D, 0x97, 255}, {0xFF, 0x70, 0x1F, 255}, {0xFF, 0xB2, 0x1D, 255},
+	{0xCF, 0xD2, 0x31, 255}, {0x48, 0xF9, 0x0A, 255}, {0x92, 0xCC, 0x17, 255}, {0x3D, 0xDB, 0x86, 255},
+	{0x1A, 0x93, 0x34, 255}, {0x00, 0xD4, 0xBB, 255}, {0x2C, 0x99, 0xA8, 255}, {0x00, 0xC2, 0xFF, 255},
+	{0x34, 0x45, 0x93, 255}, {0x64, 0x73, 0xFF, 255}, {0x00, 0x18, 0xEC, 255}, {0x84, 0x38, 0xFF, 255},
+	{0x52, 0x00, 0x85, 255}, {0xCB, 0x38, 0xFF, 255}, {0xFF, 0x95, 0xC8, 255}, {0xFF, 0x37, 0xC7, 255},
+}
+
+// PosePalette Ultralytics 畫姿態用的調色盤
+var PosePalette = []color.RGBA{
+	{255, 128, 0, 255}, {255, 153, 51, 255}, {255, 178, 102, 255}, {230, 230, 0, 255},
+	{255, 153, 255, 255}, {153, 204, 255, 255}, {255, 102, 255, 255}, {255, 51, 255, 255},
+	{102, 178, 255, 255}, {51, 153, 255, 255}, {255, 153, 153, 255}, {255, 102, 102, 255},
+	{255, 51, 51, 255}, {153, 255, 153, 255}, {102, 255, 102, 255}, {51, 255, 51, 255},
+	{0, 255, 0, 255}, {0, 0, 255, 255}, {255, 0, 0, 255}, {255, 255, 255, 255},
+}
+
+// HashColor 由類別名稱的雜湊決定色相, 同名類別在不同模型或執行間顏色一致
+func HashColor(label string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(label))
+	sum := h.Sum32()
+	hue := float64(sum%360) / 60
+	s := 0.65 + float64(sum>>9%20)/100  // 0.65 ~ 0.84
+	v := 0.80 + float64(sum>>17%20)/100 // 0.80 ~ 0.99
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(hue, 2)-1))
+	var r, g, b float64
+	switch int(hue) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 255}
+}
+
+// PaletteColors 依調色盤產生每個類別的顏色: ultralytics 依編號取 20 色, hash 依類別名稱雜湊
+func PaletteColors(names []string, palette string) ([]color.RGBA, error) {
+	colors := make([]color.RGBA, len(names))
+	for i, name := range names {
+		switch palette {
+		case "", "ultralytics":
+			colors[i] = UltralyticsPalette[i%len(UltralyticsPalette)]
+		case "hash":
+			colors[i] = HashColor(name)
+		default:
+			return nil, fmt.Errorf("unknown palette %q, expect ultralytics or hash", palette)
+		}
+	}
+	return colors, nil
+}
+
+// LoadColorMap 讀取類別名稱對應 #RRGGBB 的顏色表, 支援 JSON 物件或單層的 YAML (name: "#RRGGBB")
+func LoadColorMap(filename string) (map[string]color.RGBA, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]string{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: expect name: \"#RRGGBB\"", filename, n)
+			}
+			raw[strings.Trim(strings.TrimSpace(key), `"'`)] = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	colors := map[string]color.RGBA{}
+	for name, hex := range raw {
+		c, err := ParseHexColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("class %s: %w", name, err)
+		}
+		colors[name] = c
+	}
+	return colors, nil
+}
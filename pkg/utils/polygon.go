@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// MergePolygons 將多個多邊形畫到同一張遮罩上取聯集, 回傳聯集後面積最大的外輪廓
+func MergePolygons(polygons [][]image.Point, box image.Rectangle) []image.Point {
+	mask := gocv.Zeros(box.Dy(), box.Dx(), gocv.MatTypeCV8UC1)
+	defer mask.Close()
+
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		pts := make([]image.Point, len(polygon))
+		for i, pt := range polygon {
+			pts[i] = pt.Sub(box.Min)
+		}
+		pv := gocv.NewPointsVectorFromPoints([][]image.Point{pts})
+		gocv.FillPoly(&mask, pv, color.RGBA{255, 255, 255, 0})
+		pv.Close()
+	}
+
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	maxAreaIdx := -1
+	maxArea := -1.0
+	for i := 0; i < contours.Size(); i++ {
+		area := gocv.ContourArea(contours.At(i))
+		if area > maxArea {
+			maxAreaIdx = i
+			maxArea = area
+		}
+	}
+
+	pts := []image.Point{}
+	if maxAreaIdx >= 0 {
+		pts = contours.At(maxAreaIdx).ToPoints()
+	}
+	for i := range pts {
+		pts[i] = pts[i].Add(box.Min)
+	}
+	return pts
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// RedactOption 匿名化 (去識別化) 的設定
+type RedactOption struct {
+	Classes []string   // 要匿名化的類別, 空的代表全部
+	Method  string     // 匿名化方式: blur 高斯模糊, pixelate 馬賽克, fill 純色填滿
+	Level   int        // blur 的模糊核為長邊的 1/Level, pixelate 把長邊切成 Level 格
+	Padding float64    // 框向外擴張的比例, 使用遮罩時改為膨脹遮罩
+	Color   color.RGBA // fill 的顏色
+}
+
+func DefaultRedactOption() RedactOption {
+	return RedactOption{
+		Method:  "blur",
+		Level:   8,
+		Padding: 0.1,
+		Color:   color.RGBA{0, 0, 0, 255},
+	}
+}
+
+func (opt RedactOption) Match(label string) bool {
+	if len(opt.Classes) == 0 {
+		return true
+	}
+	for _, name := range opt.Classes {
+		if strings.EqualFold(name, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactRecord 匿名化的稽核紀錄
+type RedactRecord struct {
+	Frame int             `json:"frame"`
+	ID    int             `json:"id"`
+	Label string          `json:"label"`
+	Score float32         `json:"score"`
+	Box   image.Rectangle `json:"box"`  // 實際匿名化的範圍
+	Mask  bool            `json:"mask"` // 是否只處理遮罩內
+}
+
+// RedactAudit 匿名化的稽核報告
+type RedactAudit struct {
+	Input   string         `json:"input"`
+	Output  string         `json:"output"`
+	Method  string         `json:"method"`
+	Classes []string       `json:"classes,omitempty"`
+	Frames  int            `json:"frames"`
+	Records []RedactRecord `json:"records"`
+}
+
+// RedactFile 以 redact 匿名化圖片或影片的每一幀並寫到 output, ctx 取消時停止並回傳已處理的部分
+func RedactFile(ctx context.Context, input, output string, opt RedactOption,
+	redact func(img *gocv.Mat, frame int) ([]RedactRecord, error),
+) (RedactAudit, error) {
+	audit := RedactAudit{
+		Input:   input,
+		Output:  output,
+		Method:  opt.Method,
+		Classes: opt.Classes,
+		Records: []RedactRecord{},
+	}
+
+	if !IsVideo(input) {
+		img := gocv.IMRead(input, gocv.IMReadColor)
+		if img.Empty() {
+			return audit, fmt.Errorf("read image %s failed", input)
+		}
+		defer img.Close()
+		records, err := redact(&img, 0)
+		if err != nil {
+			return audit, err
+		}
+		audit.Frames = 1
+		audit.Records = append(audit.Records, records...)
+		if !gocv.IMWrite(output, img) {
+			return audit, fmt.Errorf("write image %s failed", output)
+		}
+		return audit, nil
+	}
+
+	frames, err := ProcessVideo(ctx, input, output, func(frame int, img *gocv.Mat) error {
+		records, err := redact(img, frame)
+		audit.Records = append(audit.Records, records...)
+		return err
+	})
+	audit.Frames = frames
+	return audit, err
+}
+
+// Redact 匿名化 rect 擴張 Padding 後的範圍, 回傳實際處理的範圍.
+// mask 為原圖大小的 CV8UC1 遮罩, 不為 nil 時只處理遮罩內的像素
+func Redact(img *gocv.Mat, rect image.Rectangle, mask *gocv.Mat, opt RedactOption) image.Rectangle {
+	rect = CropRect(rect, opt.Padding, false, img.Cols(), img.Rows())
+	if rect.Empty() {
+		return rect
+	}
+	w, h := rect.Dx(), rect.Dy()
+	long := int(math.Max(float64(w), float64(h)))
+	level := opt.Level
+	if level <= 0 {
+		level = 8
+	}
+
+	region := img.Region(rect)
+	defer region.Close()
+	processed := region.Clone()
+	defer processed.Close()
+
+	switch opt.Method {
+	case "pixelate":
+		block := long / level
+		if block < 1 {
+			block = 1
+		}
+		small := gocv.NewMat()
+		sw, sh := w/block, h/block
+		if sw < 1 {
+			sw = 1
+		}
+		if sh < 1 {
+			sh = 1
+		}
+		gocv.Resize(processed, &small, image.Pt(sw, sh), 0, 0, gocv.InterpolationArea)
+		gocv.Resize(small, &processed, image.Pt(w, h), 0, 0, gocv.InterpolationNearestNeighbor)
+		small.Close()
+	case "fill":
+		processed.SetTo(gocv.NewScalar(float64(opt.Color.B), float64(opt.Color.G), float64(opt.Color.R), 0))
+	default: // blur
+		k := long/level | 1
+		if k < 3 {
+			k = 3
+		}
+		gocv.GaussianBlur(processed, &processed, image.Pt(k, k), 0, 0, gocv.BorderDefault)
+	}
+
+	if mask == nil {
+		processed.CopyTo(&region)
+		return rect
+	}
+
+	m := mask.Region(rect)
+	defer m.Close()
+	if r := int(float64(long) * opt.Padding); r > 0 {
+		dilated := gocv.NewMat()
+		defer dilated.Close()
+		kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Pt(r*2+1, r*2+1))
+		gocv.Dilate(m, &dilated, kernel)
+		kernel.Close()
+		processed.CopyToWithMask(&region, dilated)
+	} else {
+		processed.CopyToWithMask(&region, m)
+	}
+	return rect
+}
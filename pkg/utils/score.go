@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// Softmax 將 logits 轉成機率, temperature > 1 會讓分佈更平滑, <= 0 視為 1
+func Softmax(logits []float32, temperature float32) []float32 {
+	if temperature <= 0 {
+		temperature = 1
+	}
+	probs := make([]float32, len(logits))
+	if len(logits) == 0 {
+		return probs
+	}
+
+	maxLogit := logits[0]
+	for _, v := range logits {
+		if v > maxLogit {
+			maxLogit = v
+		}
+	}
+
+	var sum float64
+	for i, v := range logits {
+		e := math.Exp(float64((v - maxLogit) / temperature))
+		probs[i] = float32(e)
+		sum += e
+	}
+	for i := range probs {
+		probs[i] = float32(float64(probs[i]) / sum)
+	}
+	return probs
+}
+
+// TopK 回傳分數最高的 k 個索引 (由高到低), k <= 0 時回傳全部
+func TopK(scores []float32, k int) []int {
+	indices := make([]int, len(scores))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool { return scores[indices[i]] > scores[indices[j]] })
+	if k > 0 && k < len(indices) {
+		indices = indices[:k]
+	}
+	return indices
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// SliceOption 切片推論 (SAHI) 的設定
+type SliceOption struct {
+	Width, Height int     // 切片大小
+	Overlap       float64 // 切片重疊比例, 範圍 [0, 1)
+	FullImage     bool    // 是否額外跑一次整張圖
+	Merge         string  // 切片接縫的合併方式: nms 或 nmm
+	MatchMetric   string  // nmm 的重疊度量: iou 或 ios (交集比較小框面積)
+	MatchThresh   float32 // 合併時的重疊門檻
+}
+
+func DefaultSliceOption() SliceOption {
+	return SliceOption{
+		Width:       640,
+		Height:      640,
+		Overlap:     0.2,
+		FullImage:   true,
+		Merge:       "nmm",
+		MatchMetric: "ios",
+		MatchThresh: 0.5,
+	}
+}
+
+// SliceRects 將圖片切成互相重疊的切片, 最後一列/行會往回貼齊圖片邊緣
+func SliceRects(imageWidth, imageHeight int, opt SliceOption) []image.Rectangle {
+	sliceW, sliceH := opt.Width, opt.Height
+	if sliceW <= 0 || sliceW > imageWidth {
+		sliceW = imageWidth
+	}
+	if sliceH <= 0 || sliceH > imageHeight {
+		sliceH = imageHeight
+	}
+	overlap := opt.Overlap
+	if overlap < 0 || overlap >= 1 {
+		overlap = 0
+	}
+	stepX := int(math.Max(1, float64(sliceW)*(1-overlap)))
+	stepY := int(math.Max(1, float64(sliceH)*(1-overlap)))
+
+	rects := []image.Rectangle{}
+	for y := 0; ; y += stepY {
+		if y+sliceH > imageHeight {
+			y = imageHeight - sliceH
+		}
+		for x := 0; ; x += stepX {
+			if x+sliceW > imageWidth {
+				x = imageWidth - sliceW
+			}
+			rects = append(rects, image.Rect(x, y, x+sliceW, y+sliceH))
+			if x+sliceW >= imageWidth {
+				break
+			}
+		}
+		if y+sliceH >= imageHeight {
+			break
+		}
+	}
+	return rects
+}
+
+// NonMaxMerge 非極大值合併 (NMM)
+// 依分數由高到低, 把同類別且重疊度超過門檻的框合併成聯集框, 分數取最高者,
+// 回傳每個合併後的框以及它包含的原始索引 (第一個為分數最高者)
+func NonMaxMerge(
+	boxes []image.Rectangle,
+	scores []float32,
+	classIds []int,
+	matchMetric string,
+	matchThresh float32,
+) (merged []image.Rectangle, groups [][]int) {
+	overlap := IoU
+	if matchMetric == "ios" {
+		overlap = IoS
+	}
+
+	order := make([]int, len(boxes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	used := make([]bool, len(boxes))
+	for _, i := range order {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		box := boxes[i]
+		group := []int{i}
+		for _, j := range order {
+			if used[j] || classIds[j] != classIds[i] {
+				continue
+			}
+			if overlap(boxes[i], boxes[j]) > matchThresh {
+				used[j] = true
+				box = box.Union(boxes[j])
+				group = append(group, j)
+			}
+		}
+		merged = append(merged, box)
+		groups = append(groups, group)
+	}
+	return
+}
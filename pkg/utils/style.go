@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// DrawStyle 繪製結果的樣式
+type DrawStyle struct {
+	Thickness   int                   `json:"thickness"`      // 框線粗細
+	FontScale   float64               `json:"font_scale"`     // 字體大小
+	FontFace    gocv.HersheyFont      `json:"font_face"`      // Hershey 字型
+	FontFile    string                `json:"font_file"`      // TTF/OTF 字型檔, 可顯示中文, 沒設定時使用 Hershey
+	FontSize    float64               `json:"font_size"`      // TTF 字型的像素大小
+	LabelPos    string                `json:"label_position"` // 標籤位置: outside 框外上方 (超出圖片頂端時翻進框內) 或 inside 框內
+	HideLabels  bool                  `json:"hide_labels"`    // 不顯示類別名稱
+	HideScores  bool                  `json:"hide_scores"`    // 不顯示分數
+	LabelAlpha  float64               `json:"label_alpha"`    // 標籤背景的不透明度, 範圍 (0, 1]
+	MaskAlpha   float64               `json:"mask_alpha"`     // 遮罩填色的不透明度, 0 為不填色
+	MaskOutline int                   `json:"mask_outline"`   // 遮罩輪廓粗細, 0 為不畫
+	Colors      map[string]color.RGBA `json:"-"`              // 依類別名稱覆寫顏色
+	Font        *Font                 `json:"-"`              // 由 FontFile 載入的字型
+}
+
+func DefaultDrawStyle() DrawStyle {
+	return DrawStyle{
+		Thickness:   2,
+		FontScale:   0.8,
+		FontFace:    gocv.FontHersheyComplex,
+		FontSize:    20,
+		LabelPos:    "outside",
+		LabelAlpha:  1,
+		MaskAlpha:   0.4,
+		MaskOutline: 2,
+	}
+}
+
+// LoadDrawStyle 讀取 JSON 樣式設定, 沒寫到的欄位沿用預設值, colors 為類別名稱對應 #RRGGBB
+func LoadDrawStyle(filename string) (DrawStyle, error) {
+	style := DefaultDrawStyle()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return style, err
+	}
+	cfg := struct {
+		*DrawStyle
+		Colors map[string]string `json:"colors"`
+	}{DrawStyle: &style}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return style, err
+	}
+	if len(cfg.Colors) > 0 {
+		style.Colors = map[string]color.RGBA{}
+		for name, hex := range cfg.Colors {
+			c, err := ParseHexColor(hex)
+			if err != nil {
+				return style, fmt.Errorf("class %s: %w", name, err)
+			}
+			style.Colors[name] = c
+		}
+	}
+	if err := style.LoadFont(); err != nil {
+		return style, err
+	}
+	return style, nil
+}
+
+// LoadFont 依 FontFile 及 FontSize 載入 TTF 字型, FontFile 為空時改回 Hershey
+func (s *DrawStyle) LoadFont() error {
+	s.Font = nil
+	if s.FontFile == "" {
+		return nil
+	}
+	size := s.FontSize
+	if size <= 0 {
+		size = 20
+	}
+	f, err := LoadFont(s.FontFile, size)
+	if err != nil {
+		return err
+	}
+	s.Font = f
+	return nil
+}
+
+// Color 回傳類別的覆寫顏色, 沒有設定時使用 fallback
+func (s DrawStyle) Color(label string, fallback color.RGBA) color.RGBA {
+	if c, ok := s.Colors[label]; ok {
+		return c
+	}
+	return fallback
+}
+
+func (s DrawStyle) label(name string, confidence float32) string {
+	switch {
+	case s.HideLabels && s.HideScores:
+		return ""
+	case s.HideLabels || name == "":
+		return fmt.Sprintf("%.2f%%", confidence*100)
+	case s.HideScores:
+		return name
+	default:
+		return fmt.Sprintf("%s (%.2f%%)", name, confidence*100)
+	}
+}
+
+// DrawBox 畫框及標籤
+func (s DrawStyle) DrawBox(img *gocv.Mat, name string, confidence float32, rect image.Rectangle, _color color.RGBA) {
+	thickness := s.Thickness
+	if thickness <= 0 {
+		thickness = 2
+	}
+	gocv.Rectangle(img, rect, _color, thickness)
+	s.DrawLabel(img, name, confidence, rect, _color)
+}
+
+// DrawLabel 在框的左上角畫標籤, 文字顏色依背景亮度選黑或白
+func (s DrawStyle) DrawLabel(img *gocv.Mat, name string, confidence float32, rect image.Rectangle, _color color.RGBA) {
+	label := s.label(name, confidence)
+	if label == "" {
+		return
+	}
+	fontScale := s.FontScale
+	if fontScale <= 0 {
+		fontScale = 0.8
+	}
+	fontFace := s.FontFace
+	if fontFace == 0 {
+		fontFace = gocv.FontHersheyComplex
+	}
+	textThickness := 1
+	if fontScale >= 1 {
+		textThickness = 2
+	}
+
+	// ascent 為基線以上的高度, descent 為基線以下的高度
+	var textWidth, ascent, descent int
+	if s.Font != nil {
+		textWidth, ascent, descent = s.Font.TextSize(label)
+	} else {
+		textSize, baseline := gocv.GetTextSizeWithBaseline(label, fontFace, fontScale, textThickness)
+		textWidth, ascent, descent = textSize.X, textSize.Y, baseline
+	}
+	padding := 4
+	w := textWidth + padding*2
+	h := ascent + descent + padding*2
+
+	x := rect.Min.X
+	if x+w > img.Cols() {
+		x = img.Cols() - w
+	}
+	if x < 0 {
+		x = 0
+	}
+	y := rect.Min.Y - h
+	if s.LabelPos == "inside" || y < 0 {
+		y = rect.Min.Y
+	}
+	box := image.Rect(x, y, x+w, y+h)
+
+	// 畫文字的背景
+	if s.LabelAlpha > 0 && s.LabelAlpha < 1 {
+		blendRect(img, box, _color, s.LabelAlpha)
+	} else {
+		gocv.Rectangle(img, box, _color, -1)
+	}
+	// 畫文字
+	textColor := color.RGBA{255, 255, 255, 0}
+	if 0.299*float64(_color.R)+0.587*float64(_color.G)+0.114*float64(_color.B) > 150 {
+		textColor = color.RGBA{0, 0, 0, 0}
+	}
+	org := image.Pt(x+padding, y+padding+ascent)
+	if s.Font != nil {
+		s.Font.PutText(img, label, org, textColor)
+	} else {
+		gocv.PutText(img, label, org, fontFace, fontScale, textColor, textThickness)
+	}
+}
+
+// DrawMasks 以 AddWeighted 半透明填滿遮罩, 再畫輪廓. polygons[i] 為第 i 個物件的所有外輪廓及孔洞
+func (s DrawStyle) DrawMasks(img *gocv.Mat, polygons [][][]image.Point, colors []color.RGBA) {
+	if s.MaskAlpha > 0 {
+		overlay := img.Clone()
+		for i, polygon := range polygons {
+			if len(polygon) == 0 {
+				continue
+			}
+			pts := gocv.NewPointsVectorFromPoints(polygon)
+			gocv.FillPoly(&overlay, pts, colors[i])
+			pts.Close()
+		}
+		alpha := s.MaskAlpha
+		if alpha > 1 {
+			alpha = 1
+		}
+		gocv.AddWeighted(overlay, alpha, *img, 1-alpha, 0, img)
+		overlay.Close()
+	}
+	if s.MaskOutline > 0 {
+		for i, polygon := range polygons {
+			if len(polygon) == 0 {
+				continue
+			}
+			pts := gocv.NewPointsVectorFromPoints(polygon)
+			gocv.Polylines(img, pts, true, colors[i], s.MaskOutline)
+			pts.Close()
+		}
+	}
+}
+
+// blendRect 以 alpha 半透明填滿 rect
+func blendRect(img *gocv.Mat, rect image.Rectangle, _color color.RGBA, alpha float64) {
+	rect = rect.Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return
+	}
+	roi := img.Region(rect)
+	defer roi.Close()
+	overlay := roi.Clone()
+	defer overlay.Close()
+	gocv.Rectangle(&overlay, image.Rect(0, 0, rect.Dx(), rect.Dy()), _color, -1)
+	gocv.AddWeighted(overlay, alpha, roi, 1-alpha, 0, &roi)
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// TTAOption 測試時增強 (Test-Time Augmentation) 的設定
+type TTAOption struct {
+	Scales []float64 // 縮放比例, 範圍 (0, 1]
+	Flip   bool      // 每個比例額外再跑一次水平翻轉
+	Merge  string    // 偵測框合併方式: nms 或 wbf
+}
+
+// TTAVariant 單次增強的參數
+type TTAVariant struct {
+	Scale float64
+	Flip  bool
+}
+
+func DefaultTTAOption() TTAOption {
+	return TTAOption{
+		Scales: []float64{1, 0.83, 0.67},
+		Flip:   true,
+		Merge:  "nms",
+	}
+}
+
+func (opt TTAOption) Variants() []TTAVariant {
+	scales := opt.Scales
+	if len(scales) == 0 {
+		scales = []float64{1}
+	}
+	variants := []TTAVariant{}
+	for _, scale := range scales {
+		if scale <= 0 || scale > 1 {
+			scale = 1
+		}
+		variants = append(variants, TTAVariant{Scale: scale})
+		if opt.Flip {
+			variants = append(variants, TTAVariant{Scale: scale, Flip: true})
+		}
+	}
+	return variants
+}
+
+// TTAImage 產生偵測用的增強圖: 先水平翻轉, 再於右下補灰邊讓物件縮小成 Scale 倍
+func TTAImage(img gocv.Mat, v TTAVariant) gocv.Mat {
+	dst := img.Clone()
+	if v.Flip {
+		gocv.Flip(dst, &dst, 1)
+	}
+	if v.Scale > 0 && v.Scale < 1 {
+		w := int(math.Round(float64(img.Cols()) / v.Scale))
+		h := int(math.Round(float64(img.Rows()) / v.Scale))
+		padded := gocv.NewMat()
+		gocv.CopyMakeBorder(dst, &padded, 0, h-img.Rows(), 0, w-img.Cols(), gocv.BorderConstant, color.RGBA{114, 114, 114, 0})
+		dst.Close()
+		dst = padded
+	}
+	return dst
+}
+
+// TTABox 將增強圖上的框映射回原圖座標
+func TTABox(rect image.Rectangle, v TTAVariant, width, height int) image.Rectangle {
+	rect = rect.Intersect(image.Rect(0, 0, width, height))
+	if v.Flip {
+		rect = image.Rect(width-rect.Max.X, rect.Min.Y, width-rect.Min.X, rect.Max.Y)
+	}
+	return rect
+}
+
+// TTACrop 產生分類用的增強圖: 先水平翻轉, 再取中心 Scale 倍大小的區域
+func TTACrop(img gocv.Mat, v TTAVariant) gocv.Mat {
+	dst := img.Clone()
+	if v.Flip {
+		gocv.Flip(dst, &dst, 1)
+	}
+	if v.Scale > 0 && v.Scale < 1 {
+		w := int(math.Round(float64(img.Cols()) * v.Scale))
+		h := int(math.Round(float64(img.Rows()) * v.Scale))
+		x := (img.Cols() - w) / 2
+		y := (img.Rows() - h) / 2
+		region := dst.Region(image.Rect(x, y, x+w, y+h))
+		crop := region.Clone()
+		region.Close()
+		dst.Close()
+		dst = crop
+	}
+	return dst
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// IsVideo 以副檔名判斷輸入是否為影片
+func IsVideo(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp4", ".avi", ".mkv", ".mov", ".m4v", ".webm":
+		return true
+	}
+	return false
+}
+
+// VideoCodec 依輸出的副檔名選擇 VideoWriter 的 FourCC
+func VideoCodec(filename string) string {
+	if strings.ToLower(filepath.Ext(filename)) == ".avi" {
+		return "MJPG"
+	}
+	return "mp4v"
+}
+
+// IsLive 攝影機編號或 rtsp, http 等串流網址
+func IsLive(input string) bool {
+	if _, err := strconv.Atoi(input); err == nil {
+		return true
+	}
+	return strings.Contains(input, "://")
+}
+
+// VideoIO 讀取影片並把處理後的每一幀寫到另一個影片
+type VideoIO struct {
+	FPS           float64 // 取不到時以 30 計
+	Width, Height int
+	vc            *gocv.VideoCapture
+	vw            *gocv.VideoWriter
+}
+
+// OpenVideoIO 開啟 in 以及相同 FPS 及大小的輸出 out
+func OpenVideoIO(in, out string) (*VideoIO, error) {
+	vc, err := gocv.VideoCaptureFile(in)
+	if err != nil {
+		return nil, err
+	}
+	fps := vc.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		fps = 30
+	}
+	width := int(vc.Get(gocv.VideoCaptureFrameWidth))
+	height := int(vc.Get(gocv.VideoCaptureFrameHeight))
+	vw, err := gocv.VideoWriterFile(out, VideoCodec(out), fps, width, height, true)
+	if err != nil {
+		vc.Close()
+		return nil, err
+	}
+	return &VideoIO{FPS: fps, Width: width, Height: height, vc: vc, vw: vw}, nil
+}
+
+// Run 逐幀呼叫 fn (可以直接畫在 img 上) 後寫入輸出, 讀不到或 ctx 取消時停止, 回傳讀到的幀數.
+// frame 為從 0 開始的幀號, 讀到空的幀時略過但仍佔一個幀號
+func (v *VideoIO) Run(ctx context.Context, fn func(frame int, img *gocv.Mat) error) (int, error) {
+	img := gocv.NewMat()
+	defer img.Close()
+	frames := 0
+	for ; v.vc.Read(&img); frames++ {
+		select {
+		case <-ctx.Done():
+			return frames, nil
+		default:
+		}
+		if img.Empty() {
+			continue
+		}
+		if err := fn(frames, &img); err != nil {
+			return frames, err
+		}
+		if err := v.vw.Write(img); err != nil {
+			return frames, err
+		}
+	}
+	return frames, nil
+}
+
+func (v *VideoIO) Close() {
+	v.vw.Close()
+	v.vc.Close()
+}
+
+// ProcessVideo 以 fn 處理 in 的每一幀並寫到 out, 不需要 FPS 等資訊時使用
+func ProcessVideo(ctx context.Context, in, out string, fn func(frame int, img *gocv.Mat) error) (int, error) {
+	v, err := OpenVideoIO(in, out)
+	if err != nil {
+		return 0, err
+	}
+	defer v.Close()
+	return v.Run(ctx, fn)
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// Viewer -show 模式的視窗: 以拉桿調整門檻, 按鍵暫停, 單步, 存圖及切換標籤或遮罩.
+//
+//	space 暫停/繼續, n 暫停時前進一幀, s 存圖, l 切換標籤, m 切換遮罩, q 或 esc 離開
+type Viewer struct {
+	window *gocv.Window
+	prefix string
+	names  []string
+	bars   map[string]*gocv.Trackbar
+	values map[string]*int // 拉桿同步的值, 需要在視窗存在期間保留
+	paused bool
+	shots  int
+	quit   bool
+	Labels bool // 是否顯示標籤
+	Masks  bool // 是否顯示遮罩
+}
+
+// NewViewer prefix 為存圖的檔名開頭
+func NewViewer(name, prefix string) *Viewer {
+	return &Viewer{
+		window: gocv.NewWindow(name),
+		prefix: prefix,
+		bars:   map[string]*gocv.Trackbar{},
+		values: map[string]*int{},
+		Labels: true,
+		Masks:  true,
+	}
+}
+
+// AddThreshold 加一個 0 ~ 1 的門檻拉桿, 以 0 ~ 100 顯示
+func (v *Viewer) AddThreshold(name string, value float64) {
+	pos := new(int)
+	*pos = int(value*100 + 0.5)
+	v.names = append(v.names, name)
+	v.values[name] = pos
+	v.bars[name] = v.window.CreateTrackbarWithValue(name, pos, 100)
+}
+
+// Threshold 拉桿目前的門檻
+func (v *Viewer) Threshold(name string) float32 {
+	bar, ok := v.bars[name]
+	if !ok {
+		return 0
+	}
+	return float32(bar.GetPos()) / 100
+}
+
+// Thresholds 以命令列參數的格式列出目前的門檻, 例如 "-conf 0.45 -iou 0.50"
+func (v *Viewer) Thresholds() string {
+	args := make([]string, 0, len(v.names))
+	for _, name := range v.names {
+		args = append(args, fmt.Sprintf("-%s %.2f", name, v.Threshold(name)))
+	}
+	return strings.Join(args, " ")
+}
+
+// Show 顯示畫好的一幀並處理按鍵, 暫停時停在這裡直到繼續或單步. 回傳 false 表示要離開
+func (v *Viewer) Show(img gocv.Mat) bool {
+	v.window.IMShow(img)
+	for {
+		delay := 1
+		if v.paused {
+			delay = 30
+		}
+		step := false
+		switch key := v.window.WaitKey(delay); key {
+		case ' ':
+			v.paused = !v.paused
+		case 'n':
+			v.paused, step = true, true
+		case 's':
+			file := fmt.Sprintf("%s_snapshot_%d.jpg", v.prefix, v.shots)
+			gocv.IMWrite(file, img)
+			v.shots++
+			fmt.Println("saved snapshot to", file)
+		case 'l':
+			v.Labels = !v.Labels
+		case 'm':
+			v.Masks = !v.Masks
+		case 'q', 27:
+			v.quit = true
+		}
+		if v.quit || !v.window.IsOpen() {
+			return false
+		}
+		if !v.paused || step {
+			return true
+		}
+	}
+}
+
+// Run 開啟 input (影片, 攝影機或串流, 圖片時重複同一張), 逐幀呼叫 fn 畫好後顯示,
+// 直到讀完, 關閉視窗或 ctx 取消. 離開時印出最後選定的門檻
+func (v *Viewer) Run(ctx context.Context, input string, fn func(frame *gocv.Mat) error) error {
+	defer func() { fmt.Println("thresholds:", v.Thresholds()) }()
+	video := IsVideo(input) || IsLive(input)
+	var vc *gocv.VideoCapture
+	var still gocv.Mat
+	if video {
+		var err error
+		if vc, err = gocv.OpenVideoCapture(input); err != nil {
+			return err
+		}
+		defer vc.Close()
+	} else {
+		still = gocv.IMRead(input, gocv.IMReadColor)
+		defer still.Close()
+		if still.Empty() {
+			return fmt.Errorf("read %s failed", input)
+		}
+	}
+
+	frame := gocv.NewMat()
+	defer frame.Close()
+	for ctx.Err() == nil {
+		if video {
+			if !vc.Read(&frame) {
+				return nil
+			}
+			if frame.Empty() {
+				continue
+			}
+		} else {
+			still.CopyTo(&frame)
+		}
+		if err := fn(&frame); err != nil {
+			return err
+		}
+		if !v.Show(frame) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (v *Viewer) Close() { v.window.Close() }
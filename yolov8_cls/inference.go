@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image"
 	"os"
-	"sort"
 	"time"
 
 	"go-onnxruntime-example/pkg/gocv"
@@ -13,9 +12,36 @@ import (
 	ort "github.com/yam8511/go-onnxruntime"
 )
 
+type ClassScore struct {
+	ID    int     `json:"id"`
+	Label string  `json:"label"`
+	Score float32 `json:"score"`
+}
+
+type ClassifyResult struct {
+	TopK  []ClassScore `json:"topk"`  // 超過門檻的前 k 名, 由高到低
+	Probs []float32    `json:"probs"` // 所有類別的機率
+}
+
+// Top1 回傳第一名的標籤及分數, 沒有超過門檻時回傳空字串
+func (r ClassifyResult) Top1() (string, float32) {
+	if len(r.TopK) == 0 {
+		return "", 0
+	}
+	return r.TopK[0].Label, r.TopK[0].Score
+}
+
+type ClassifyOption struct {
+	TopK        int     // 回傳前幾名
+	Softmax     bool    // 模型輸出是 logits 時, 先做 softmax
+	Temperature float32 // softmax 的溫度
+}
+
 type Session_CLS struct {
 	session *ort.Session
 	names   []string
+	tta     *utils.TTAOption
+	opt     ClassifyOption
 }
 
 func NewSession_CLS(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_CLS, error) {
@@ -34,47 +60,77 @@ func NewSession_CLS(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session
 	return &Session_CLS{
 		session: sess,
 		names:   names,
+		opt:     ClassifyOption{TopK: 5, Temperature: 1},
 	}, nil
 }
 
 func (sess *Session_CLS) predict_file(inputFile string, threshold float32) (
-	gocv.Mat, string, float32, error,
+	gocv.Mat, ClassifyResult, error,
 ) {
 	b, err := os.ReadFile(inputFile)
 	if err != nil {
-		return gocv.Mat{}, "", 0, err
+		return gocv.Mat{}, ClassifyResult{}, err
 	}
 	img, err := gocv.IMDecode(b, gocv.IMReadColor)
 	if err != nil {
-		return gocv.Mat{}, "", 0, err
+		return gocv.Mat{}, ClassifyResult{}, err
+	}
+	var result ClassifyResult
+	if sess.tta != nil {
+		result, err = sess.predict_tta(img, threshold, *sess.tta)
+	} else {
+		result, err = sess.predict(img, threshold)
 	}
-	label, score, err := sess.predict(img, threshold)
 	if err != nil {
 		img.Close()
 	}
-	return img, label, score, err
+	return img, result, err
+}
+
+// predict_tta 以多個中心裁切比例及水平翻轉各推論一次, 平均 softmax 輸出後再取分類
+func (sess *Session_CLS) predict_tta(img gocv.Mat, threshold float32, opt utils.TTAOption) (ClassifyResult, error) {
+	variants := opt.Variants()
+	var avg []float32
+	for _, v := range variants {
+		input, err := sess.prepare_input(utils.TTACrop(img, v))
+		if err != nil {
+			return ClassifyResult{}, err
+		}
+		output, err := sess.run_model(input)
+		if err != nil {
+			return ClassifyResult{}, err
+		}
+		probs := sess.probabilities(output)
+		if avg == nil {
+			avg = make([]float32, len(probs))
+		}
+		for i, v := range probs {
+			avg[i] += v / float32(len(variants))
+		}
+	}
+	return sess.process_output(avg, threshold)
 }
 
-func (sess *Session_CLS) predict(img gocv.Mat, threshold float32) (string, float32, error) {
+func (sess *Session_CLS) predict(img gocv.Mat, threshold float32) (ClassifyResult, error) {
 	var preP, inferP, postP time.Duration
 	now := time.Now()
 	input, err := sess.prepare_input(img.Clone())
 	if err != nil {
-		return "", 0, err
+		return ClassifyResult{}, err
 	}
 	preP = time.Since(now)
 
 	now = time.Now()
 	output, err := sess.run_model(input)
 	if err != nil {
-		return "", 0, err
+		return ClassifyResult{}, err
 	}
 	inferP = time.Since(now)
 
 	now = time.Now()
-	label, confidence, err := sess.process_output(output, threshold)
+	result, err := sess.process_output(sess.probabilities(output), threshold)
 	if err != nil {
-		return "", 0, err
+		return ClassifyResult{}, err
 	}
 	postP = time.Since(now)
 
@@ -84,7 +140,7 @@ func (sess *Session_CLS) predict(img gocv.Mat, threshold float32) (string, float
 		preP+inferP+postP,
 	)
 
-	return label, confidence, nil
+	return result, nil
 }
 
 func (sess *Session_CLS) prepare_input(img gocv.Mat) ([]float32, error) {
@@ -133,28 +189,36 @@ func (sess *Session_CLS) run_model(input []float32) ([]float32, error) {
 	return outputTensor.GetData(), nil
 }
 
-type ScoreIdx struct {
-	index int
-	score float32
-}
-
-func (sess *Session_CLS) process_output(output []float32, threshold float32) (string, float32, error) {
-	if len(output) == 0 {
-		return "", 0, nil
+// probabilities 依設定把模型輸出轉成機率, yolov8-cls 匯出時已含 softmax, 預設不再處理
+func (sess *Session_CLS) probabilities(output []float32) []float32 {
+	if sess.opt.Softmax {
+		return utils.Softmax(output, sess.opt.Temperature)
 	}
+	return output
+}
 
-	scores := []ScoreIdx{}
-	for i, v := range output {
-		scores = append(scores, ScoreIdx{index: i, score: v})
+func (sess *Session_CLS) process_output(probs []float32, threshold float32) (ClassifyResult, error) {
+	result := ClassifyResult{TopK: []ClassScore{}, Probs: probs}
+	if len(probs) == 0 {
+		return result, nil
 	}
 
-	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
-
-	if si := scores[0]; si.score > threshold {
-		return sess.names[si.index], si.score, nil
+	for _, idx := range utils.TopK(probs, sess.opt.TopK) {
+		if probs[idx] <= threshold {
+			break
+		}
+		label := ""
+		if idx < len(sess.names) {
+			label = sess.names[idx]
+		}
+		result.TopK = append(result.TopK, ClassScore{
+			ID:    idx,
+			Label: label,
+			Score: probs[idx],
+		})
 	}
 
-	return "", 0, nil
+	return result, nil
 }
 
 func (sess *Session_CLS) release() { sess.session.Release() }
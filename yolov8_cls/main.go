@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"runtime"
 
+	"go-onnxruntime-example/pkg/utils"
+
 	ort "github.com/yam8511/go-onnxruntime"
 )
 
@@ -20,6 +24,11 @@ func main() {
 	input := flag.String("input", "bus.jpg", "inference input image")
 	onnxFile := flag.String("onnx", "yolov8n-cls.onnx", "inference onnx model")
 	flag.Float64Var(&threshold, "conf", 0.0, "inference confidence threshold")
+	tta := flag.Bool("tta", false, "test-time augmentation (multi-crop + horizontal flip)")
+	topK := flag.Int("topk", 5, "number of top classes to report")
+	softmax := flag.Bool("softmax", false, "apply softmax to the model output (for models that output logits)")
+	temperature := flag.Float64("temperature", 1, "softmax temperature")
+	jsonFile := flag.String("json", "", "save the result as JSON, including the full probability vector")
 	flag.Parse()
 
 	ortSDK, err := ort.New_ORT_SDK(func(opt *ort.OrtSdkOption) {
@@ -42,13 +51,44 @@ func main() {
 	}
 	defer sess.release()
 
+	if *tta {
+		opt := utils.DefaultTTAOption()
+		sess.tta = &opt
+	}
+	sess.opt = ClassifyOption{
+		TopK:        *topK,
+		Softmax:     *softmax,
+		Temperature: float32(*temperature),
+	}
+
 	for i := 0; i < 5; i++ {
-		img, label, confidence, err := sess.predict_file(*input, float32(threshold))
+		img, result, err := sess.predict_file(*input, float32(threshold))
 		if err != nil {
 			log.Println("inference failed:", err)
 			return
 		}
 		img.Close()
+		label, confidence := result.Top1()
 		fmt.Printf("label: %v, confidence: %v\n", label, confidence)
+		print_topk(result)
+
+		if *jsonFile != "" {
+			b, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				log.Println("輸出 JSON 失敗: ", err)
+				return
+			}
+			if err := os.WriteFile(*jsonFile, b, 0644); err != nil {
+				log.Println("儲存 JSON 失敗: ", err)
+				return
+			}
+		}
+	}
+}
+
+func print_topk(result ClassifyResult) {
+	fmt.Printf("%-6s%-8s%-24s%s\n", "rank", "id", "label", "score")
+	for i, cs := range result.TopK {
+		fmt.Printf("%-6d%-8d%-24s%.2f%%\n", i+1, cs.ID, cs.Label, cs.Score*100)
 	}
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"image"
+	"strings"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+
+	ort "github.com/yam8511/go-onnxruntime"
+)
+
+// Session_CLS 兩階段流程的分類模型, 對偵測框裁切出的小圖再做一次分類
+type Session_CLS struct {
+	session   *ort.Session
+	names     []string
+	inputSize image.Point // 模型輸入的寬高, 動態輸入時由 metadata 的 imgsz 決定
+}
+
+// SubClass 分類模型給的一個子類別
+type SubClass struct {
+	ID    int     `json:"id"`
+	Label string  `json:"label"`
+	Score float32 `json:"score"`
+}
+
+type ClassifyOption struct {
+	Padding     float64  // 裁切時框向外擴張的比例
+	Square      bool     // 以長邊補成正方形再裁切
+	Classes     []string // 只分類這些類別的偵測框, 空的代表全部
+	Threshold   float32  // 子分類的信心門檻
+	TopK        int      // 保留前幾名, <= 1 時只填 SubID/SubLabel/SubScore
+	Softmax     bool     // 模型輸出是 logits 時, 先做 softmax
+	Temperature float32  // softmax 的溫度
+}
+
+func (opt ClassifyOption) match(label string) bool {
+	if len(opt.Classes) == 0 {
+		return true
+	}
+	for _, name := range opt.Classes {
+		if strings.EqualFold(name, label) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewSession_CLS(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_CLS, error) {
+	sess, err := ort.NewSessionWithONNX(ortSDK, onnxFile, useGPU)
+	if err != nil {
+		return nil, err
+	}
+
+	_names, err := sess.Metadata("names")
+	if err != nil {
+		sess.Release()
+		return nil, err
+	}
+	names := utils.MetadataToNames(_names)
+	input0, _ := sess.Input("images")
+	imgsz, _ := sess.Metadata("imgsz")
+
+	return &Session_CLS{
+		session:   sess,
+		names:     names,
+		inputSize: utils.InputSize(input0.Shape, imgsz),
+	}, nil
+}
+
+// classify_objects 裁切每個符合類別的偵測框, 批次送進分類模型, 把子類別及分數附加到 DetectObject
+func (sess *Session_CLS) classify_objects(img gocv.Mat, objs []DetectObject, opt ClassifyOption) error {
+	indices := []int{}
+	crops := []gocv.Mat{}
+	defer func() {
+		for _, crop := range crops {
+			crop.Close()
+		}
+	}()
+
+	for i, obj := range objs {
+		if !opt.match(obj.Label) {
+			continue
+		}
+		rect := utils.CropRect(obj.Box, opt.Padding, opt.Square, img.Cols(), img.Rows())
+		if rect.Empty() {
+			continue
+		}
+		region := img.Region(rect)
+		crops = append(crops, region.Clone())
+		region.Close()
+		indices = append(indices, i)
+	}
+	if len(crops) == 0 {
+		return nil
+	}
+
+	probs, err := sess.predict_batch(crops)
+	if err != nil {
+		return err
+	}
+
+	k := opt.TopK
+	if k < 1 {
+		k = 1
+	}
+	for j, i := range indices {
+		prob := probs[j]
+		if opt.Softmax {
+			prob = utils.Softmax(prob, opt.Temperature)
+		}
+		subs := []SubClass{}
+		for _, idx := range utils.TopK(prob, k) {
+			if prob[idx] < opt.Threshold {
+				break
+			}
+			sub := SubClass{ID: idx, Score: prob[idx]}
+			if idx < len(sess.names) {
+				sub.Label = sess.names[idx]
+			}
+			subs = append(subs, sub)
+		}
+		if len(subs) == 0 {
+			continue
+		}
+		id := subs[0].ID
+		objs[i].SubID, objs[i].SubLabel, objs[i].SubScore = &id, subs[0].Label, subs[0].Score
+		if opt.TopK > 1 {
+			objs[i].SubTopK = subs
+		}
+	}
+	return nil
+}
+
+// predict_batch 模型的 batch 維度是動態的話一次送進所有小圖, 否則逐張推論
+func (sess *Session_CLS) predict_batch(imgs []gocv.Mat) ([][]float32, error) {
+	input0, _ := sess.session.Input("images")
+	batch := len(imgs)
+	if input0.Shape[0] > 0 {
+		batch = int(input0.Shape[0])
+	}
+
+	probs := make([][]float32, 0, len(imgs))
+	for start := 0; start < len(imgs); start += batch {
+		end := start + batch
+		if end > len(imgs) {
+			end = len(imgs)
+		}
+
+		inputs := []float32{}
+		for _, img := range imgs[start:end] {
+			input, err := sess.prepare_input(img.Clone())
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, input...)
+		}
+
+		output, err := sess.run_model(inputs, end-start)
+		if err != nil {
+			return nil, err
+		}
+		size := len(output) / (end - start)
+		for i := 0; i < end-start; i++ {
+			probs = append(probs, output[i*size:(i+1)*size])
+		}
+	}
+	return probs, nil
+}
+
+func (sess *Session_CLS) prepare_input(img gocv.Mat) ([]float32, error) {
+	defer img.Close()
+	imgSize := sess.inputSize
+	gocv.Resize(img, &img, imgSize, 0, 0, gocv.InterpolationDefault)
+
+	ratio := 1.0 / 255
+	mean := gocv.NewScalar(0, 0, 0, 0)
+	swapRGB := true
+	blob := gocv.BlobFromImage(img, ratio, imgSize, mean, swapRGB, false)
+	input, err := blob.DataPtrFloat32()
+	if err != nil {
+		return nil, err
+	}
+
+	inputData := make([]float32, len(input))
+	copy(inputData, input)
+	blob.Close()
+	return inputData, nil
+}
+
+func (sess *Session_CLS) run_model(input []float32, batch int) ([]float32, error) {
+	inputShape := []int64{int64(batch), 3, int64(sess.inputSize.Y), int64(sess.inputSize.X)}
+	inputTensor, err := ort.NewTensor(sess.session, inputShape, input)
+	if err != nil {
+		return nil, err
+	}
+	defer inputTensor.Destroy()
+
+	output0 := sess.session.Outputs()[0]
+	outputShape := []int64{int64(batch), int64(len(sess.names))}
+	if len(output0.Shape) == 2 && output0.Shape[1] > 0 {
+		outputShape[1] = output0.Shape[1]
+	}
+	outputTensor, err := ort.NewEmptyTensor[float32](sess.session, outputShape)
+	if err != nil {
+		return nil, err
+	}
+	defer outputTensor.Destroy()
+
+	err = sess.session.RunDefault(
+		[]ort.AnyTensor{inputTensor},
+		[]ort.AnyTensor{outputTensor},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return outputTensor.GetData(), nil
+}
+
+func (sess *Session_CLS) release() { sess.session.Release() }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go-onnxruntime-example/pkg/count"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// ClipTrigger 觸發錄影的條件: class:<label> 類別出現, zone[:<name>] 進入區域, line[:<name>] 跨線
+type ClipTrigger struct {
+	Kind string
+	Name string // 空白為任何類別, 區域或線
+}
+
+// parse_clip_triggers 解析以逗號分隔的條件, 例如 "class:person,zone:door"
+func parse_clip_triggers(s string) ([]ClipTrigger, error) {
+	triggers := []ClipTrigger{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, name, _ := strings.Cut(item, ":")
+		switch kind {
+		case "class", "zone", "line":
+		default:
+			return nil, fmt.Errorf("unknown clip trigger %q, expect class:<label>, zone[:<name>] or line[:<name>]", item)
+		}
+		triggers = append(triggers, ClipTrigger{Kind: kind, Name: name})
+	}
+	return triggers, nil
+}
+
+// needs_counter 是否有需要計數結果的條件
+func needs_counter(triggers []ClipTrigger) bool {
+	for _, trigger := range triggers {
+		if trigger.Kind != "class" {
+			return true
+		}
+	}
+	return false
+}
+
+// clip_events 依條件找出這一幀的事件: 類別在上一幀沒有而這一幀出現, 或計數器的進入區域及跨線事件.
+// present 為上一幀出現的類別, 會更新成這一幀的
+func clip_events(triggers []ClipTrigger, frame int, t float64, objs []DetectObject, present map[string]bool, counts []count.Event) []utils.ClipEvent {
+	events := []utils.ClipEvent{}
+	labels := map[string][]DetectObject{}
+	for _, obj := range objs {
+		labels[obj.Label] = append(labels[obj.Label], obj)
+	}
+	byTrack := func(id int) []DetectObject {
+		for _, obj := range objs {
+			if obj.TrackID == id {
+				return []DetectObject{obj}
+			}
+		}
+		return nil
+	}
+
+	for _, trigger := range triggers {
+		switch trigger.Kind {
+		case "class":
+			for label, dets := range labels {
+				if (trigger.Name == "" || trigger.Name == label) && !present[label] {
+					events = append(events, utils.ClipEvent{Time: t, Frame: frame, Type: "class", Name: label, Detections: dets})
+				}
+			}
+		case "zone", "line":
+			for _, ev := range counts {
+				isZone := ev.Type == "enter"
+				isLine := ev.Type == "in" || ev.Type == "out"
+				if (trigger.Kind == "zone" && !isZone) || (trigger.Kind == "line" && !isLine) {
+					continue
+				}
+				if trigger.Name != "" && trigger.Name != ev.Name {
+					continue
+				}
+				events = append(events, utils.ClipEvent{Time: t, Frame: frame, Type: trigger.Kind + "_" + ev.Type, Name: ev.Name, Detections: byTrack(ev.TrackID)})
+			}
+		}
+	}
+
+	for label := range present {
+		delete(present, label)
+	}
+	for label := range labels {
+		present[label] = true
+	}
+	return events
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"sort"
+
+	"go-onnxruntime-example/pkg/count"
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// count_objects 把有追蹤 ID 的偵測結果轉成計數的輸入
+func count_objects(objs []DetectObject) []count.Object {
+	objects := make([]count.Object, 0, len(objs))
+	for _, obj := range objs {
+		objects = append(objects, count.Object{TrackID: obj.TrackID, Label: obj.Label, Box: obj.Box})
+	}
+	return objects
+}
+
+// format_counts 把各類別的數量排成 "car 3 person 2"
+func format_counts(counts map[string]int) string {
+	labels := make([]string, 0, len(counts))
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	s := ""
+	for _, label := range labels {
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("%s %d", label, counts[label])
+	}
+	return s
+}
+
+// draw_counts 半透明填滿區域, 畫出計數線以及目前的計數
+func draw_counts(img *gocv.Mat, counter *count.Counter) {
+	cfg := counter.Config()
+	summary := counter.Summary()
+	lineColor := color.RGBA{255, 255, 0, 255}
+	zoneColor := color.RGBA{0, 200, 255, 255}
+	textColor := color.RGBA{255, 255, 255, 255}
+
+	if len(cfg.Zones) > 0 {
+		polygons := make([][]image.Point, 0, len(cfg.Zones))
+		for _, zone := range cfg.Zones {
+			polygons = append(polygons, zone.Points)
+		}
+		pts := gocv.NewPointsVectorFromPoints(polygons)
+		overlay := img.Clone()
+		gocv.FillPoly(&overlay, pts, zoneColor)
+		gocv.AddWeighted(overlay, 0.25, *img, 0.75, 0, img)
+		overlay.Close()
+		gocv.Polylines(img, pts, true, zoneColor, 2)
+		pts.Close()
+	}
+
+	for i, zone := range cfg.Zones {
+		zc := summary.Zones[i]
+		text := fmt.Sprintf("%s: %s", zc.Name, format_counts(zc.Occupancy))
+		gocv.PutText(img, text, zone.Points[0].Add(image.Pt(4, 20)), gocv.FontHersheySimplex, 0.6, textColor, 2)
+	}
+
+	for i, line := range cfg.Lines {
+		pts := gocv.NewPointsVectorFromPoints([][]image.Point{line.Points})
+		gocv.Polylines(img, pts, false, lineColor, 3)
+		pts.Close()
+		lc := summary.Lines[i]
+		text := fmt.Sprintf("%s in: %s out: %s", lc.Name, format_counts(lc.In), format_counts(lc.Out))
+		gocv.PutText(img, text, line.Points[0].Add(image.Pt(0, -8)), gocv.FontHersheySimplex, 0.6, lineColor, 2)
+	}
+}
+
+// append_jsonl 把一筆資料以 JSON Lines 附加到檔案
+func append_jsonl(filename string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
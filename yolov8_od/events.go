@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go-onnxruntime-example/pkg/event"
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// publish_events 每個物件產生一筆事件, 過濾後若需要快照只對畫好的這一幀編碼一次 JPEG,
+// 附在每個類別的第一筆事件, 讓只訂閱某個串流/類別 topic 的接收端也拿得到
+func publish_events(pub *event.Publisher, streamID string, frame int, img gocv.Mat, objs []DetectObject) error {
+	now := time.Now()
+	events := make([]event.Event, len(objs))
+	for i, obj := range objs {
+		events[i] = event.Event{
+			ID:      fmt.Sprintf("%s-%d-%d", streamID, frame, i),
+			Time:    now,
+			Stream:  streamID,
+			Frame:   frame,
+			TrackID: obj.TrackID,
+			Label:   obj.Label,
+			Score:   obj.Score,
+			Box:     obj.Box,
+			Data:    obj,
+		}
+	}
+	events = pub.Filter(events)
+	if len(events) == 0 {
+		return nil
+	}
+	if pub.Snapshot() && !img.Empty() {
+		buf, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, img, []int{gocv.IMWriteJpegQuality, 80})
+		if err != nil {
+			return err
+		}
+		jpeg := append([]byte{}, buf.GetBytes()...)
+		buf.Close()
+		labels := map[string]bool{}
+		for i := range events {
+			if !labels[events[i].Label] {
+				labels[events[i].Label] = true
+				events[i].Snapshot = jpeg
+			}
+		}
+	}
+	return pub.Send(events)
+}
+
+// new_publisher 依設定檔連線所有 webhook 及 MQTT broker, filename 空白時回傳 nil
+func new_publisher(filename string) (*event.Publisher, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	cfg, err := event.LoadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewPublisherFromConfig(cfg)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"image"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// propagate_objects 以光流把上一幀的物件移到這一幀, 分數依 Decay 遞減, 太小的框留在原處但分數一樣遞減.
+// 光流不可靠或有物件分數低於 MinScore 時 ok 為 false, 應該重新偵測
+func (sess *Session_OD) propagate_objects(flow *utils.BoxFlow, frame gocv.Mat, last []DetectObject) (objs []DetectObject, ok bool) {
+	opt := flow.Option()
+	boxes := make([]image.Rectangle, len(last))
+	for i, obj := range last {
+		boxes[i] = obj.Box
+	}
+	moved, ok := flow.Propagate(frame, boxes)
+	if !ok {
+		return nil, false
+	}
+	objs = make([]DetectObject, len(last))
+	for i, obj := range last {
+		obj.Box = moved[i]
+		obj.Score *= opt.Decay
+		if obj.Score < opt.MinScore {
+			return nil, false
+		}
+		objs[i] = obj
+	}
+	return objs, true
+}
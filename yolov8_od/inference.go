@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"math/rand"
 	"os"
 	"time"
 
@@ -15,16 +14,29 @@ import (
 )
 
 type DetectObject struct {
-	ID    int
-	Label string
-	Score float32
-	Box   image.Rectangle
+	TrackID int             `json:"track_id,omitempty"`
+	ID      int             `json:"id"`
+	Label   string          `json:"label"`
+	Score   float32         `json:"score"`
+	Box     image.Rectangle `json:"box"`
+
+	// 兩階段流程中分類模型給的子類別
+	SubID    *int       `json:"sub_id,omitempty"` // nil 表示沒有分類, 子類別 0 也要能輸出
+	SubLabel string     `json:"sub_label,omitempty"`
+	SubScore float32    `json:"sub_score,omitempty"`
+	SubTopK  []SubClass `json:"sub_topk,omitempty"` // -cls_topk > 1 時超過門檻的前幾名
 }
 
 type Session_OD struct {
 	session *ort.Session
 	names   []string
 	colors  []color.RGBA
+	tta     *utils.TTAOption
+	slice   *utils.SliceOption
+	style   utils.DrawStyle
+	iou     float32 // NMS 的 IoU 門檻
+
+	inputSize image.Point // 模型輸入的寬高, 動態輸入 (dynamic=True 匯出) 時由 metadata 的 imgsz 決定
 }
 
 func NewSession_OD(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_OD, error) {
@@ -40,21 +52,39 @@ func NewSession_OD(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_
 	}
 	names := utils.MetadataToNames(_names)
 
-	colors := []color.RGBA{}
-	if len(names) > 0 {
-		rng := rand.New(rand.NewSource(time.Now().UnixMilli()))
-		for range names {
-			colors = append(colors, color.RGBA{uint8(rng.Intn(255)), uint8(rng.Intn(255)), uint8(rng.Intn(255)), 255})
-		}
-	}
+	colors, _ := utils.PaletteColors(names, "ultralytics")
+
+	input0, _ := sess.Input("images")
+	imgsz, _ := sess.Metadata("imgsz")
 
 	return &Session_OD{
-		session: sess,
-		names:   names,
-		colors:  colors,
+		session:   sess,
+		names:     names,
+		colors:    colors,
+		style:     utils.DefaultDrawStyle(),
+		iou:       0.5,
+		inputSize: utils.InputSize(input0.Shape, imgsz),
 	}, nil
 }
 
+// output_shape batch 張圖的輸出大小 [batch 4+類別數 anchors].
+// 動態匯出時 metadata 的類別數或 anchors 為 -1, 改由 names 及輸入大小 (stride 8, 16, 32 的格子數) 算出
+func (sess *Session_OD) output_shape(batch int) []int64 {
+	output0, _ := sess.session.Output("output0")
+	shape := []int64{int64(batch), int64(4 + len(sess.names)), 0}
+	if len(output0.Shape) == 3 && output0.Shape[1] > 0 {
+		shape[1] = output0.Shape[1]
+	}
+	if len(output0.Shape) == 3 && output0.Shape[2] > 0 {
+		shape[2] = output0.Shape[2]
+	} else {
+		for _, stride := range []int{8, 16, 32} {
+			shape[2] += int64((sess.inputSize.X / stride) * (sess.inputSize.Y / stride))
+		}
+	}
+	return shape
+}
+
 func (sess *Session_OD) predict_file(inputFile string, threshold float32) (
 	gocv.Mat, []DetectObject, error,
 ) {
@@ -66,13 +96,88 @@ func (sess *Session_OD) predict_file(inputFile string, threshold float32) (
 	if err != nil {
 		return gocv.Mat{}, nil, err
 	}
-	objs, err := sess.predict(img, threshold)
+	objs, err := sess.predict_image(img, threshold)
 	if err != nil {
 		img.Close()
 	}
 	return img, objs, err
 }
 
+// predict_image 依設定選擇切片, TTA 或一般推論
+func (sess *Session_OD) predict_image(img gocv.Mat, threshold float32) ([]DetectObject, error) {
+	switch {
+	case sess.slice != nil:
+		return sess.predict_sliced(img, threshold, *sess.slice)
+	case sess.tta != nil:
+		return sess.predict_tta(img, threshold, *sess.tta)
+	default:
+		return sess.predict(img, threshold)
+	}
+}
+
+// predict_tta 以多個比例及水平翻轉各推論一次, 映射回原圖後再以 NMS 或 WBF 合併
+func (sess *Session_OD) predict_tta(img gocv.Mat, threshold float32, opt utils.TTAOption) (
+	[]DetectObject, error,
+) {
+	imageWidth := img.Cols()
+	imageHeight := img.Rows()
+	variants := opt.Variants()
+
+	boxes := []image.Rectangle{}
+	scores := []float32{}
+	classIds := []int{}
+	for _, v := range variants {
+		aug := utils.TTAImage(img, v)
+		objs, err := sess.predict(aug, threshold)
+		aug.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			box := utils.TTABox(obj.Box, v, imageWidth, imageHeight)
+			if box.Empty() {
+				continue
+			}
+			boxes = append(boxes, box)
+			scores = append(scores, obj.Score)
+			classIds = append(classIds, obj.ID)
+		}
+	}
+
+	objs := []DetectObject{}
+	if len(boxes) == 0 {
+		return objs, nil
+	}
+
+	switch opt.Merge {
+	case "wbf":
+		boxes, scores, classIds = utils.WeightedBoxesFusion(boxes, scores, classIds, 0.55, len(variants))
+		for idx := range boxes {
+			if scores[idx] < threshold {
+				continue
+			}
+			objs = append(objs, DetectObject{
+				ID:    classIds[idx],
+				Label: sess.names[classIds[idx]],
+				Score: scores[idx],
+				Box:   boxes[idx],
+			})
+		}
+	default:
+		indices := gocv.NMSBoxes(boxes, scores, threshold, sess.iou)
+		for _, idx := range indices {
+			objs = append(objs, DetectObject{
+				ID:    classIds[idx],
+				Label: sess.names[classIds[idx]],
+				Score: scores[idx],
+				Box:   boxes[idx],
+			})
+		}
+	}
+
+	return objs, nil
+}
+
 func (sess *Session_OD) predict(img gocv.Mat, threshold float32) (
 	[]DetectObject, error,
 ) {
@@ -111,9 +216,7 @@ func (sess *Session_OD) predict(img gocv.Mat, threshold float32) (
 func (sess *Session_OD) prepare_input(img gocv.Mat) ([]float32, float32, float32, error) {
 	// img := gocv.IMRead(inputFile, gocv.IMReadColor)
 	defer img.Close()
-	input0, _ := sess.session.Input("images")
-	// fmt.Printf("input0: %v\n", input0)
-	imgSize := image.Pt(int(input0.Shape[2]), int(input0.Shape[3]))
+	imgSize := sess.inputSize
 	img_width, img_height := img.Cols(), img.Rows()
 
 	ratio := 1.0 / 255
@@ -134,13 +237,19 @@ func (sess *Session_OD) prepare_input(img gocv.Mat) ([]float32, float32, float32
 }
 
 func (sess *Session_OD) run_model(input []float32) ([]float32, error) {
-	inputTensor, err := ort.NewInputTensor(sess.session, "", input)
+	return sess.run_model_batch(input, 1)
+}
+
+// run_model_batch 以 inputSize 及 output_shape 建立 tensor, 動態匯出的模型也能推論
+func (sess *Session_OD) run_model_batch(input []float32, batch int) ([]float32, error) {
+	inputShape := []int64{int64(batch), 3, int64(sess.inputSize.Y), int64(sess.inputSize.X)}
+	inputTensor, err := ort.NewTensor(sess.session, inputShape, input)
 	if err != nil {
 		return nil, err
 	}
 	defer inputTensor.Destroy()
 
-	outputTensor, err := ort.NewEmptyOutputTensor[float32](sess.session, "")
+	outputTensor, err := ort.NewEmptyTensor[float32](sess.session, sess.output_shape(batch))
 	if err != nil {
 		return nil, err
 	}
@@ -159,15 +268,9 @@ func (sess *Session_OD) run_model(input []float32) ([]float32, error) {
 func (sess *Session_OD) process_output(img gocv.Mat, output []float32, threshold, xFactor, yFactor float32) (
 	objs []DetectObject,
 ) {
-	output0, ok := sess.session.Output("output0")
-	if !ok {
-		return
-	}
-	// fmt.Printf("output0.Shape: %v\n", output0.Shape)
-	size := int(output0.Shape[2])
-	// fmt.Printf("size: %v\n", size)
-	nameSize := int(output0.Shape[1])
-	// fmt.Printf("nameSize: %v\n", nameSize)
+	// anchors 由資料長度決定, 不讀 metadata 中可能是 -1 的維度
+	nameSize := int(sess.output_shape(1)[1])
+	size := len(output) / nameSize
 	imageWidth := img.Cols()
 	imageHeight := img.Rows()
 
@@ -208,7 +311,7 @@ func (sess *Session_OD) process_output(img gocv.Mat, output []float32, threshold
 		return
 	}
 
-	indices := gocv.NMSBoxes(boxes, scores, threshold, 0.5)
+	indices := gocv.NMSBoxes(boxes, scores, threshold, sess.iou)
 	for _, idx := range indices {
 		objs = append(objs, DetectObject{
 			ID:    classIds[idx],
@@ -228,13 +331,27 @@ func (sess *Session_OD) draw(
 	objs []DetectObject,
 ) {
 	for _, obj := range objs {
-		utils.DrawBox(
+		_color := sess.style.Color(obj.Label, sess.colors[obj.ID])
+		label := obj.Label
+		if obj.TrackID > 0 {
+			label = fmt.Sprintf("#%d %s", obj.TrackID, obj.Label)
+		}
+		sess.style.DrawBox(
 			img,
-			obj.Label,
+			label,
 			obj.Score,
 			obj.Box,
-			sess.colors[obj.ID],
-			0, 0, 0,
+			_color,
 		)
+		if obj.SubLabel != "" {
+			// 子類別標籤畫在框的左下角
+			sess.style.DrawLabel(
+				img,
+				obj.SubLabel,
+				obj.SubScore,
+				image.Rect(obj.Box.Min.X, obj.Box.Max.Y, obj.Box.Max.X, obj.Box.Max.Y),
+				_color,
+			)
+		}
 	}
 }
@@ -2,14 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"image/color"
 	"log"
+	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
+	"go-onnxruntime-example/pkg/count"
 	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/stream"
+	"go-onnxruntime-example/pkg/utils"
 
 	ort "github.com/yam8511/go-onnxruntime"
 )
@@ -22,9 +29,78 @@ func main() {
 		flag.StringVar(&dllPath, "lib", "onnxruntime.dll", "onnxruntime DLL")
 	}
 	useGPU := flag.Bool("gpu", true, "inference using CUDA")
-	input := flag.String("input", "bus.jpg", "inference input image")
+	input := flag.String("input", "bus.jpg", "inference input image or video")
 	onnxFile := flag.String("onnx", "yolov8n.onnx", "inference onnx model")
 	flag.Float64Var(&threshold, "conf", 0.7, "inference confidence threshold")
+	show := flag.Bool("show", false, "show results in a window with threshold trackbars (space pause, n step, s snapshot, l labels, q quit)")
+	iou := flag.Float64("iou", 0.5, "NMS IoU threshold")
+	tta := flag.Bool("tta", false, "test-time augmentation (multi-scale + horizontal flip)")
+	ttaMerge := flag.String("tta_merge", "nms", "merge method of test-time augmentation: nms or wbf")
+	sliceSize := flag.Int("slice", 0, "sliced inference with tile size, 0 to disable")
+	sliceOverlap := flag.Float64("slice_overlap", 0.2, "overlap ratio between tiles")
+	sliceFull := flag.Bool("slice_full", true, "also run inference on the full image when slicing")
+	sliceMerge := flag.String("slice_merge", "nmm", "merge method across tile seams: nms or nmm")
+	clsOnnx := flag.String("cls_onnx", "", "classify onnx model for the detection crops, empty to disable")
+	clsPadding := flag.Float64("cls_pad", 0.1, "padding ratio of the detection crops")
+	clsSquare := flag.Bool("cls_square", true, "square the detection crops before classifying")
+	clsClasses := flag.String("cls_classes", "", "comma separated detection classes to classify, empty for all")
+	clsThreshold := flag.Float64("cls_conf", 0.0, "classify confidence threshold")
+	clsTopK := flag.Int("cls_topk", 1, "number of top sub classes to keep per detection")
+	clsSoftmax := flag.Bool("cls_softmax", false, "apply softmax to the classify output (for models that output logits)")
+	clsTemperature := flag.Float64("cls_temperature", 1, "classify softmax temperature")
+	jsonFile := flag.String("json", "", "save the detections as JSON")
+	palette := flag.String("palette", "ultralytics", "class color palette: ultralytics or hash")
+	colorMap := flag.String("colors", "", "JSON or YAML file mapping class names to #RRGGBB colors")
+	styleFile := flag.String("style", "", "JSON drawing style config, e.g. thickness, label_position and per-class colors")
+	thickness := flag.Int("thickness", 2, "box thickness")
+	fontScale := flag.Float64("font_scale", 0.8, "label font scale")
+	fontFile := flag.String("font", "", "TTF/OTF font for labels (e.g. Noto Sans CJK for Chinese), empty for Hershey")
+	fontSize := flag.Float64("font_size", 20, "TTF font size in pixels")
+	labelPos := flag.String("label_pos", "outside", "label position: outside or inside the box")
+	hideLabels := flag.Bool("hide_labels", false, "hide class names")
+	hideScores := flag.Bool("hide_scores", false, "hide scores")
+	labelAlpha := flag.Float64("label_alpha", 1, "label background opacity")
+	output := flag.String("output", "result_od.mp4", "output video when the input is a video")
+	trackMode := flag.Bool("track", false, "assign track IDs to detections in a video")
+	trackAge := flag.Int("track_age", 30, "frames a track survives without a matching detection, counted tracks leave zones after the same time")
+	countFile := flag.String("count", "", "JSON config of counting lines and zones for a video (enables tracking)")
+	countEvery := flag.Float64("count_every", 10, "emit a counting summary every N seconds of video")
+	countJSON := flag.String("count_json", "result_count.jsonl", "append counting summaries as JSON Lines")
+	motion := flag.String("motion", "", "skip inference on static video frames by background subtraction: mog2 or knn, empty to disable")
+	motionThreshold := flag.Float64("motion_conf", 0.002, "minimum foreground ratio to run inference")
+	motionROI := flag.Bool("motion_roi", false, "run detection only on the motion regions, objects outside them keep their last detections")
+	motionRefresh := flag.Int("motion_refresh", 30, "force a full-frame detection after N frames without one, so reused detections of objects that left expire; 0 to disable")
+	flowInterval := flag.Int("flow_interval", 0, "run detection every N video frames and propagate boxes with optical flow in between, 0 to disable")
+	flowDecay := flag.Float64("flow_decay", 0.95, "score decay per propagated frame")
+	flowMinScore := flag.Float64("flow_min_conf", 0.2, "re-detect early when a propagated score falls below this")
+	flowMinPoints := flag.Int("flow_min_points", 5, "re-detect when fewer tracked features remain in a box")
+	clipOn := flag.String("clip_on", "", "save event clips of a video when triggered: comma separated class:<label>, zone[:<name>] or line[:<name>] (zone and line need -count)")
+	clipDir := flag.String("clip_dir", "clips", "event clip folder, each clip has a JSON sidecar")
+	clipPre := flag.Float64("clip_pre", 5, "seconds kept before the event")
+	clipPost := flag.Float64("clip_post", 5, "seconds recorded after the last event")
+	clipMax := flag.Int("clip_max", 0, "keep at most N clips, 0 for no limit")
+	clipMaxMB := flag.Int64("clip_max_mb", 0, "keep the clips under N MB, 0 for no limit")
+	pipelineMode := flag.Bool("pipeline", false, "run video in concurrent capture/preprocess/inference/postprocess/render stages (supports -track only)")
+	sessions := flag.Int("sessions", 1, "inference sessions in the pipeline's session pool")
+	workers := flag.Int("workers", runtime.NumCPU()/2, "pre-process and post-process workers in the pipeline")
+	queueSize := flag.Int("queue", 4, "channel size between pipeline stages")
+	pipelineStats := flag.String("pipeline_stats", "", "save the per-stage latency histograms as JSON")
+	streamsFile := flag.String("streams", "", "JSON config of multiple camera streams sharing the session pool (-sessions)")
+	streamResults := flag.String("stream_results", "result_streams.jsonl", "save the detections tagged with stream IDs as JSON Lines")
+	streamHealth := flag.String("stream_health", "result_streams_health.json", "save the per-stream health (fps, last frame, errors)")
+	healthEvery := flag.Float64("health_every", 10, "print the stream health every N seconds")
+	mjpegAddr := flag.String("mjpeg", "", "serve annotated video/streams as MJPEG on this address, e.g. :8080, empty to disable")
+	mjpegQuality := flag.Int("mjpeg_quality", 80, "MJPEG JPEG quality (0-100)")
+	mjpegFPS := flag.Float64("mjpeg_fps", 10, "MJPEG frames per second cap per stream")
+	eventsFile := flag.String("events", "", "JSON config of webhooks and MQTT brokers to publish detection events of video/streams, empty to disable")
+	redactMode := flag.Bool("redact", false, "anonymize detected objects in the input image or video")
+	redactClasses := flag.String("redact_classes", "person", "comma separated classes to anonymize, empty for all")
+	redactMethod := flag.String("redact_method", "blur", "anonymize method: blur, pixelate or fill")
+	redactLevel := flag.Int("redact_level", 8, "blur kernel or pixel blocks relative to the box long side")
+	redactPadding := flag.Float64("redact_pad", 0.1, "expand the box by this ratio before anonymizing")
+	redactColor := flag.String("redact_color", "#000000", "fill color as #RRGGBB")
+	redactOutput := flag.String("redact_out", "", "anonymized output, default result_redact.jpg or result_redact.mp4")
+	redactAudit := flag.String("redact_audit", "result_redact.json", "save the redaction audit as JSON")
 	flag.Parse()
 
 	ortSDK, err := ort.New_ORT_SDK(func(opt *ort.OrtSdkOption) {
@@ -47,7 +123,288 @@ func main() {
 	}
 	defer sess.release()
 
+	if *styleFile != "" {
+		if sess.style, err = utils.LoadDrawStyle(*styleFile); err != nil {
+			log.Println("讀取樣式設定失敗: ", err)
+			return
+		}
+	}
+	// 有指定的參數覆寫樣式設定
+	reloadFont := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "thickness":
+			sess.style.Thickness = *thickness
+		case "font_scale":
+			sess.style.FontScale = *fontScale
+		case "label_pos":
+			sess.style.LabelPos = *labelPos
+		case "hide_labels":
+			sess.style.HideLabels = *hideLabels
+		case "hide_scores":
+			sess.style.HideScores = *hideScores
+		case "label_alpha":
+			sess.style.LabelAlpha = *labelAlpha
+		case "font":
+			sess.style.FontFile = *fontFile
+			reloadFont = true
+		case "font_size":
+			sess.style.FontSize = *fontSize
+			reloadFont = true
+		}
+	})
+	if reloadFont {
+		if err := sess.style.LoadFont(); err != nil {
+			log.Println("讀取字型失敗: ", err)
+			return
+		}
+	}
+
+	if sess.colors, err = utils.PaletteColors(sess.names, *palette); err != nil {
+		log.Println(err)
+		return
+	}
+	if *colorMap != "" {
+		colors, err := utils.LoadColorMap(*colorMap)
+		if err != nil {
+			log.Println("讀取顏色設定失敗: ", err)
+			return
+		}
+		if sess.style.Colors == nil {
+			sess.style.Colors = map[string]color.RGBA{}
+		}
+		for name, c := range colors {
+			sess.style.Colors[name] = c
+		}
+	}
+
+	if *tta {
+		opt := utils.DefaultTTAOption()
+		opt.Merge = *ttaMerge
+		sess.tta = &opt
+	}
+
+	if *sliceSize > 0 {
+		opt := utils.DefaultSliceOption()
+		opt.Width, opt.Height = *sliceSize, *sliceSize
+		opt.Overlap = *sliceOverlap
+		opt.FullImage = *sliceFull
+		opt.Merge = *sliceMerge
+		sess.slice = &opt
+	}
+
+	sess.iou = float32(*iou)
+	pipelined := *pipelineMode && (utils.IsVideo(*input) || utils.IsLive(*input))
+	if *clsOnnx != "" && (*show || *streamsFile != "" || pipelined) {
+		log.Println("-cls_onnx supports images and -input videos only, not -show, -streams or -pipeline")
+		return
+	}
+
+	var clsSess *Session_CLS
+	clsOpt := ClassifyOption{
+		Padding:     *clsPadding,
+		Square:      *clsSquare,
+		Threshold:   float32(*clsThreshold),
+		TopK:        *clsTopK,
+		Softmax:     *clsSoftmax,
+		Temperature: float32(*clsTemperature),
+	}
+	if *clsClasses != "" {
+		clsOpt.Classes = utils.SplitList(*clsClasses)
+	}
+	if *clsOnnx != "" {
+		clsSess, err = NewSession_CLS(ortSDK, *clsOnnx, *useGPU)
+		if err != nil {
+			log.Println("建立分類 Session 失敗: ", err)
+			return
+		}
+		defer clsSess.release()
+	}
+
+	if *show {
+		sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		if err := sess.show(sig, *input, float32(threshold)); err != nil {
+			log.Println("inference failed:", err)
+		}
+		return
+	}
+
+	if *streamsFile != "" {
+		cfg, err := stream.LoadConfig(*streamsFile)
+		if err != nil {
+			log.Println("讀取串流設定失敗: ", err)
+			return
+		}
+		pool, err := new_session_pool(ortSDK, sess, *onnxFile, *useGPU, *sessions)
+		if err != nil {
+			log.Println("建立物件偵測 Session 失敗: ", err)
+			return
+		}
+		defer release_pool(pool[1:])
+		opt := StreamOption{
+			ResultFile:  *streamResults,
+			HealthFile:  *streamHealth,
+			HealthEvery: time.Duration(*healthEvery * float64(time.Second)),
+			Track:       *trackMode,
+			TrackAge:    *trackAge,
+		}
+		if opt.Events, err = new_publisher(*eventsFile); err != nil {
+			log.Println("建立事件推送失敗: ", err)
+			return
+		}
+		if opt.Events != nil {
+			defer opt.Events.Close()
+		}
+		sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		opt.Preview = start_preview(sig, *mjpegAddr, stream.MJPEGOption{Quality: *mjpegQuality, FPS: *mjpegFPS})
+		if err := run_streams(sig, pool, stream.NewManager(cfg, float32(threshold)), opt); err != nil {
+			log.Println("inference failed:", err)
+		}
+		return
+	}
+
+	if pipelined {
+		pool, err := new_session_pool(ortSDK, sess, *onnxFile, *useGPU, *sessions)
+		if err != nil {
+			log.Println("建立物件偵測 Session 失敗: ", err)
+			return
+		}
+		defer release_pool(pool[1:])
+		opt := PipelineOption{
+			Output:    *output,
+			Workers:   *workers,
+			QueueSize: *queueSize,
+			Live:      utils.IsLive(*input),
+			Track:     *trackMode,
+			TrackAge:  *trackAge,
+		}
+		sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		opt.Preview = start_preview(sig, *mjpegAddr, stream.MJPEGOption{Quality: *mjpegQuality, FPS: *mjpegFPS})
+		stats, err := predict_pipeline(sig, pool, *input, float32(threshold), opt)
+		if err != nil {
+			log.Println("inference failed:", err)
+		}
+		stats.print()
+		if *pipelineStats != "" {
+			if err := save_json(*pipelineStats, stats); err != nil {
+				log.Println("儲存 JSON 失敗: ", err)
+			}
+		}
+		return
+	}
+
+	if utils.IsVideo(*input) && !*redactMode {
+		opt := VideoOption{
+			Output:       *output,
+			Track:        *trackMode,
+			TrackAge:     *trackAge,
+			SummaryEvery: *countEvery,
+			SummaryFile:  *countJSON,
+			Classifier:   clsSess,
+			ClassifyOpt:  clsOpt,
+		}
+		if *countFile != "" {
+			cfg, err := count.LoadConfig(*countFile)
+			if err != nil {
+				log.Println("讀取計數設定失敗: ", err)
+				return
+			}
+			opt.Count = &cfg
+		}
+		if *motion != "" {
+			motionOpt := utils.DefaultMotionOption()
+			motionOpt.Method = *motion
+			motionOpt.Threshold = *motionThreshold
+			motionOpt.ROI = *motionROI
+			motionOpt.Refresh = *motionRefresh
+			opt.Motion = utils.NewMotionGate(motionOpt)
+			defer opt.Motion.Close()
+		}
+		if *clipOn != "" {
+			if opt.ClipOn, err = parse_clip_triggers(*clipOn); err != nil {
+				log.Println(err)
+				return
+			}
+			if needs_counter(opt.ClipOn) && opt.Count == nil {
+				log.Println("zone and line clip triggers need -count")
+				return
+			}
+			clipOpt := utils.DefaultClipOption()
+			clipOpt.Dir = *clipDir
+			clipOpt.PreRoll, clipOpt.PostRoll = *clipPre, *clipPost
+			clipOpt.MaxClips = *clipMax
+			clipOpt.MaxBytes = *clipMaxMB << 20
+			opt.Clip = &clipOpt
+		}
+		if *flowInterval > 1 {
+			flowOpt := utils.DefaultFlowOption()
+			flowOpt.Interval = *flowInterval
+			flowOpt.Decay = float32(*flowDecay)
+			flowOpt.MinScore = float32(*flowMinScore)
+			flowOpt.MinPoints = *flowMinPoints
+			opt.Flow = utils.NewBoxFlow(flowOpt)
+			defer opt.Flow.Close()
+		}
+		if opt.Events, err = new_publisher(*eventsFile); err != nil {
+			log.Println("建立事件推送失敗: ", err)
+			return
+		}
+		if opt.Events != nil {
+			defer opt.Events.Close()
+		}
+		sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		opt.Preview = start_preview(sig, *mjpegAddr, stream.MJPEGOption{Quality: *mjpegQuality, FPS: *mjpegFPS})
+		frames, err := sess.predict_video(sig, *input, float32(threshold), opt)
+		if err != nil {
+			log.Println("inference failed:", err)
+		}
+		fmt.Printf("%d frames. and saved to %s\n", frames, *output)
+		if opt.Events != nil {
+			fmt.Printf("published %d events\n", opt.Events.Sent())
+		}
+		if opt.Motion != nil {
+			_, skipped := opt.Motion.Stats()
+			fmt.Printf("motion gate skipped %d frames (%.1f%%)\n", skipped, opt.Motion.SkipRate()*100)
+		}
+		if opt.Flow != nil {
+			propagated, failed := opt.Flow.Stats()
+			fmt.Printf("optical flow propagated %d frames, flow unreliable on %d frames\n", propagated, failed)
+		}
+		return
+	}
+
 	sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	if *redactMode {
+		opt := utils.DefaultRedactOption()
+		opt.Method = *redactMethod
+		opt.Level = *redactLevel
+		opt.Padding = *redactPadding
+		if opt.Color, err = utils.ParseHexColor(*redactColor); err != nil {
+			log.Println(err)
+			return
+		}
+		if *redactClasses != "" {
+			opt.Classes = utils.SplitList(*redactClasses)
+		}
+		output := *redactOutput
+		if output == "" {
+			output = "result_redact.jpg"
+			if utils.IsVideo(*input) {
+				output = "result_redact.mp4"
+			}
+		}
+		audit, err := sess.redact_file(sig, *input, output, float32(threshold), opt)
+		if err != nil {
+			log.Println("redact failed:", err)
+		}
+		if err := save_json(*redactAudit, audit); err != nil {
+			log.Println("儲存 JSON 失敗: ", err)
+			return
+		}
+		fmt.Printf("redact %d objects in %d frames. and saved to %s\n", len(audit.Records), audit.Frames, output)
+		return
+	}
+
 	for i := 0; i < 5; i++ {
 		select {
 		case <-sig.Done():
@@ -59,9 +416,31 @@ func main() {
 			log.Println("inference failed:", err)
 			return
 		}
+		if clsSess != nil {
+			if err := clsSess.classify_objects(img, objs, clsOpt); err != nil {
+				log.Println("classify failed:", err)
+				img.Close()
+				return
+			}
+		}
+		if *jsonFile != "" {
+			if err := save_json(*jsonFile, objs); err != nil {
+				log.Println("儲存 JSON 失敗: ", err)
+				img.Close()
+				return
+			}
+		}
 		sess.draw(&img, objs)
 		gocv.IMWrite("result_od.jpg", img)
 		img.Close()
 		fmt.Printf("detect %d objects. and saved to result_od.jpg\n", len(objs))
 	}
 }
+
+func save_json(filename string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"image"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// predict_rois 只在動態區域推論, 框平移回原圖座標.
+// 動態區域超過半張圖時直接整張推論
+func (sess *Session_OD) predict_rois(img gocv.Mat, rois []image.Rectangle, threshold float32) (
+	[]DetectObject, error,
+) {
+	area := 0
+	for _, roi := range rois {
+		area += roi.Dx() * roi.Dy()
+	}
+	if area*2 > img.Cols()*img.Rows() {
+		return sess.predict_image(img, threshold)
+	}
+
+	crops := make([]gocv.Mat, 0, len(rois))
+	for _, roi := range rois {
+		region := img.Region(roi)
+		crops = append(crops, region.Clone())
+		region.Close()
+	}
+	results, err := sess.predict_batch(crops, threshold)
+	for _, crop := range crops {
+		crop.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []DetectObject{}
+	for i, res := range results {
+		for _, obj := range res {
+			obj.Box = obj.Box.Add(rois[i].Min)
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+// outside_rois 上一次的結果中完全在動態區域外的物件, 靜止的物件不會因為只推論動態區域而消失
+func outside_rois(last []DetectObject, rois []image.Rectangle) []DetectObject {
+	objs := []DetectObject{}
+	for _, obj := range last {
+		inside := false
+		for _, roi := range rois {
+			if obj.Box.Overlaps(roi) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/pipeline"
+	"go-onnxruntime-example/pkg/stream"
+	"go-onnxruntime-example/pkg/track"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// PipelineOption 分階段並行推論影片的設定
+type PipelineOption struct {
+	Output    string
+	Workers   int  // 前處理及後處理各自的 goroutine 數量
+	QueueSize int  // 各階段之間的 channel 大小
+	Live      bool // 即時來源: 來不及處理時丟掉最舊的幀
+	Track     bool
+	TrackAge  int
+	Preview   *stream.MJPEGServer
+}
+
+// PipelineStats 各階段的延遲直方圖
+type PipelineStats struct {
+	Frames     int                            `json:"frames"`
+	Dropped    int                            `json:"dropped"`
+	Elapsed    float64                        `json:"elapsed"` // 秒
+	FPS        float64                        `json:"fps"`
+	Stages     []string                       `json:"stages"`
+	Histograms map[string]*pipeline.Histogram `json:"-"`
+	Snapshots  map[string]pipeline.Snapshot   `json:"histograms"`
+}
+
+func newPipelineStats() *PipelineStats {
+	stats := &PipelineStats{
+		Stages:     []string{"capture", "preprocess", "inference", "postprocess", "render", "latency"},
+		Histograms: map[string]*pipeline.Histogram{},
+	}
+	for _, stage := range stats.Stages {
+		stats.Histograms[stage] = pipeline.NewHistogram()
+	}
+	return stats
+}
+
+func (stats *PipelineStats) snapshot() {
+	stats.Snapshots = map[string]pipeline.Snapshot{}
+	for _, stage := range stats.Stages {
+		stats.Snapshots[stage] = stats.Histograms[stage].Snapshot()
+	}
+	if stats.Elapsed > 0 {
+		stats.FPS = float64(stats.Frames) / stats.Elapsed
+	}
+}
+
+func (stats *PipelineStats) print() {
+	fmt.Printf("%d frames, %d dropped, %.1f fps\n", stats.Frames, stats.Dropped, stats.FPS)
+	for _, stage := range stats.Stages {
+		fmt.Printf("  %-12s %s\n", stage, stats.Histograms[stage])
+	}
+}
+
+// pipeFrame 在各階段之間傳遞的一幀
+type pipeFrame struct {
+	seq              int
+	img              gocv.Mat
+	input            []float32
+	xFactor, yFactor float32
+	output           []float32
+	objs             []DetectObject
+	start            time.Time // 讀到這一幀的時間
+}
+
+func (f *pipeFrame) release() { f.img.Close() }
+
+// predict_pipeline 把讀取, 前處理, 推論, 後處理, 畫圖寫檔拆成並行的階段:
+// 推論階段每個 goroutine 綁定 pool 中的一個 Session, 前處理及後處理各有 opt.Workers 個 goroutine,
+// 最後依序號排回原本的順序再追蹤及寫入影片
+func predict_pipeline(ctx context.Context, pool []*Session_OD, input string, threshold float32, opt PipelineOption) (
+	*PipelineStats, error,
+) {
+	sess := pool[0]
+	stats := newPipelineStats()
+
+	vc, err := gocv.OpenVideoCapture(input)
+	if err != nil {
+		return stats, err
+	}
+	defer vc.Close()
+	fps := vc.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		fps = 30
+	}
+	width := int(vc.Get(gocv.VideoCaptureFrameWidth))
+	height := int(vc.Get(gocv.VideoCaptureFrameHeight))
+	vw, err := gocv.VideoWriterFile(opt.Output, utils.VideoCodec(opt.Output), fps, width, height, true)
+	if err != nil {
+		return stats, err
+	}
+	defer vw.Close()
+
+	p := pipeline.New(ctx, (*pipeFrame).release)
+	defer p.Stop()
+	captured := pipeline.NewQueue(opt.QueueSize, opt.Live, (*pipeFrame).release)
+	started := time.Now()
+
+	// 讀取: 即時來源時丟掉來不及處理的舊幀
+	go func() {
+		defer captured.Close()
+		for p.Context().Err() == nil {
+			now := time.Now()
+			img := gocv.NewMat()
+			if !vc.Read(&img) {
+				img.Close()
+				return
+			}
+			if img.Empty() {
+				img.Close()
+				continue
+			}
+			stats.Histograms["capture"].Since(now)
+			captured.Push(p.Context(), &pipeFrame{img: img, start: now})
+		}
+	}()
+
+	// 依進入管線的順序編號, 丟掉的幀不佔序號
+	sequenced := make(chan *pipeFrame, opt.QueueSize)
+	go func() {
+		defer close(sequenced)
+		seq := 0
+		for f := range captured.C() {
+			f.seq = seq
+			seq++
+			select {
+			case sequenced <- f:
+			case <-p.Context().Done():
+				f.release()
+			}
+		}
+	}()
+
+	preprocessed := p.Stage(opt.Workers, opt.QueueSize, sequenced, stats.Histograms["preprocess"], func(_ int, f *pipeFrame) error {
+		input, xFactor, yFactor, err := sess.prepare_input(f.img.Clone())
+		f.input, f.xFactor, f.yFactor = input, xFactor, yFactor
+		return err
+	})
+	inferred := p.Stage(len(pool), opt.QueueSize, preprocessed, stats.Histograms["inference"], func(worker int, f *pipeFrame) error {
+		output, err := pool[worker].run_model(f.input)
+		f.input, f.output = nil, output
+		return err
+	})
+	postprocessed := p.Stage(opt.Workers, opt.QueueSize, inferred, stats.Histograms["postprocess"], func(_ int, f *pipeFrame) error {
+		f.objs = sess.process_output(f.img, f.output, threshold, f.xFactor, f.yFactor)
+		f.output = nil
+		return nil
+	})
+
+	// 畫圖及寫檔: 追蹤需要依序處理
+	var tracker *track.Tracker
+	if opt.Track {
+		tracker = new_tracker(opt.TrackAge)
+	}
+	reorder := pipeline.NewReorder[*pipeFrame]()
+	for f := range postprocessed {
+		for _, f := range reorder.Add(f.seq, f) {
+			if p.Context().Err() != nil {
+				f.release()
+				continue
+			}
+			now := time.Now()
+			if tracker != nil {
+				sess.track_objects(tracker, f.objs)
+			}
+			sess.draw(&f.img, f.objs)
+			if opt.Preview != nil {
+				if err := opt.Preview.Publish("video", f.img); err != nil {
+					p.Fail(err)
+				}
+			}
+			if err := vw.Write(f.img); err != nil {
+				p.Fail(err)
+			}
+			stats.Histograms["render"].Since(now)
+			stats.Histograms["latency"].Since(f.start)
+			stats.Frames++
+			f.release()
+		}
+	}
+	for _, f := range reorder.Rest() {
+		f.release()
+	}
+
+	stats.Dropped = captured.Dropped()
+	stats.Elapsed = time.Since(started).Seconds()
+	stats.snapshot()
+	return stats, p.Err()
+}
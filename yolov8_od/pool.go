@@ -0,0 +1,28 @@
+package main
+
+import (
+	ort "github.com/yam8511/go-onnxruntime"
+)
+
+// new_session_pool 以同一個模型建立 n 個 Session, 第一個為 first, 其餘沿用 first 的推論設定 (字型共用, Font 自己有鎖)
+func new_session_pool(ortSDK *ort.ORT_SDK, first *Session_OD, onnxFile string, useGPU bool, n int) ([]*Session_OD, error) {
+	pool := []*Session_OD{first}
+	for i := 1; i < n; i++ {
+		sess, err := NewSession_OD(ortSDK, onnxFile, useGPU)
+		if err != nil {
+			release_pool(pool[1:])
+			return nil, err
+		}
+		sess.tta, sess.slice = first.tta, first.slice
+		sess.colors, sess.style = first.colors, first.style
+		sess.iou = first.iou
+		pool = append(pool, sess)
+	}
+	return pool, nil
+}
+
+func release_pool(pool []*Session_OD) {
+	for _, sess := range pool {
+		sess.release()
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go-onnxruntime-example/pkg/stream"
+)
+
+// start_preview 在 addr 以 MJPEG 提供畫好結果的即時預覽, addr 空白時回傳 nil
+func start_preview(ctx context.Context, addr string, opt stream.MJPEGOption) *stream.MJPEGServer {
+	if addr == "" {
+		return nil
+	}
+	preview := stream.NewMJPEGServer(opt)
+	go func() {
+		if err := preview.ListenAndServe(ctx, addr); err != nil {
+			log.Println("啟動 MJPEG 預覽失敗: ", err)
+		}
+	}()
+	log.Printf("MJPEG preview on http://%s/\n", addr)
+	return preview
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// show 在視窗中即時顯示偵測結果, 拉桿調整 conf 及 iou 並在下一幀生效, 輸入為圖片時重複推論同一張.
+// 離開時印出最後選定的門檻
+func (sess *Session_OD) show(ctx context.Context, input string, threshold float32) error {
+	viewer := utils.NewViewer("yolov8 detect", "result_od")
+	defer viewer.Close()
+	viewer.AddThreshold("conf", float64(threshold))
+	viewer.AddThreshold("iou", float64(sess.iou))
+
+	style := sess.style
+	defer func() { sess.style = style }()
+	return viewer.Run(ctx, input, func(frame *gocv.Mat) error {
+		sess.iou = viewer.Threshold("iou")
+		objs, err := sess.predict_image(*frame, viewer.Threshold("conf"))
+		if err != nil {
+			return err
+		}
+		sess.style.HideLabels = style.HideLabels || !viewer.Labels
+		sess.style.HideScores = style.HideScores || !viewer.Labels
+		sess.draw(frame, objs)
+		return nil
+	})
+}
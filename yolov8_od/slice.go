@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// predict_sliced 將大圖切成互相重疊的切片分別推論 (SAHI),
+// 把框平移回原圖座標後, 在切片接縫處以 NMS 或 NMM 合併
+func (sess *Session_OD) predict_sliced(img gocv.Mat, threshold float32, opt utils.SliceOption) (
+	[]DetectObject, error,
+) {
+	rects := utils.SliceRects(img.Cols(), img.Rows(), opt)
+	tiles := make([]gocv.Mat, 0, len(rects))
+	for _, rect := range rects {
+		region := img.Region(rect)
+		tiles = append(tiles, region.Clone())
+		region.Close()
+	}
+	results, err := sess.predict_batch(tiles, threshold)
+	for _, tile := range tiles {
+		tile.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	boxes := []image.Rectangle{}
+	scores := []float32{}
+	classIds := []int{}
+	for i, objs := range results {
+		for _, obj := range objs {
+			boxes = append(boxes, obj.Box.Add(rects[i].Min))
+			scores = append(scores, obj.Score)
+			classIds = append(classIds, obj.ID)
+		}
+	}
+
+	if opt.FullImage && len(rects) > 1 {
+		objs, err := sess.predict(img, threshold)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			boxes = append(boxes, obj.Box)
+			scores = append(scores, obj.Score)
+			classIds = append(classIds, obj.ID)
+		}
+	}
+
+	objs := []DetectObject{}
+	if len(boxes) == 0 {
+		return objs, nil
+	}
+
+	switch opt.Merge {
+	case "nmm":
+		merged, groups := utils.NonMaxMerge(boxes, scores, classIds, opt.MatchMetric, opt.MatchThresh)
+		for i, box := range merged {
+			idx := groups[i][0]
+			objs = append(objs, DetectObject{
+				ID:    classIds[idx],
+				Label: sess.names[classIds[idx]],
+				Score: scores[idx],
+				Box:   box,
+			})
+		}
+	default:
+		indices := gocv.NMSBoxes(boxes, scores, threshold, opt.MatchThresh)
+		for _, idx := range indices {
+			objs = append(objs, DetectObject{
+				ID:    classIds[idx],
+				Label: sess.names[classIds[idx]],
+				Score: scores[idx],
+				Box:   boxes[idx],
+			})
+		}
+	}
+
+	return objs, nil
+}
+
+// predict_batch 一次推論多張圖
+// 模型的 batch 維度是動態的話會合成一個 batch 送進去, 否則逐張推論
+func (sess *Session_OD) predict_batch(imgs []gocv.Mat, threshold float32) (
+	[][]DetectObject, error,
+) {
+	results := make([][]DetectObject, 0, len(imgs))
+	input0, _ := sess.session.Input("images")
+	if input0.Shape[0] > 0 || len(imgs) < 2 {
+		for _, img := range imgs {
+			objs, err := sess.predict(img, threshold)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, objs)
+		}
+		return results, nil
+	}
+
+	var preP, inferP, postP time.Duration
+	now := time.Now()
+	inputs := []float32{}
+	factors := make([][2]float32, 0, len(imgs))
+	for _, img := range imgs {
+		input, xFactor, yFactor, err := sess.prepare_input(img.Clone())
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input...)
+		factors = append(factors, [2]float32{xFactor, yFactor})
+	}
+	preP = time.Since(now)
+
+	now = time.Now()
+	output, err := sess.run_model_batch(inputs, len(imgs))
+	if err != nil {
+		return nil, err
+	}
+	inferP = time.Since(now)
+
+	now = time.Now()
+	size := len(output) / len(imgs)
+	for i, img := range imgs {
+		objs := sess.process_output(img, output[i*size:(i+1)*size], threshold, factors[i][0], factors[i][1])
+		results = append(results, objs)
+	}
+	postP = time.Since(now)
+
+	fmt.Printf(
+		"batch %d: %s pre-process, %s inference, %s post-process, total %s\n",
+		len(imgs), preP, inferP, postP,
+		preP+inferP+postP,
+	)
+
+	return results, nil
+}
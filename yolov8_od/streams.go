@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go-onnxruntime-example/pkg/event"
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/stream"
+	"go-onnxruntime-example/pkg/track"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// StreamResult 多路串流中一幀的偵測結果
+type StreamResult struct {
+	Stream  string         `json:"stream"`
+	Frame   int            `json:"frame"`
+	Time    time.Time      `json:"time"`
+	Objects []DetectObject `json:"objects"`
+}
+
+// StreamOption 多路串流推論的設定
+type StreamOption struct {
+	ResultFile  string        // 偵測結果的 JSON Lines 檔, 空白不輸出
+	HealthFile  string        // 串流狀態的 JSON 檔, 空白不輸出
+	HealthEvery time.Duration // 每隔多久輸出一次串流狀態
+	Track       bool
+	TrackAge    int
+	Preview     *stream.MJPEGServer // 每路串流的 MJPEG 預覽
+	Events      *event.Publisher    // 推送偵測事件到 webhook 及 MQTT
+}
+
+// streamState 單一串流推論時的狀態, Manager 保證同一路串流依序處理
+type streamState struct {
+	tracker *track.Tracker
+	writer  *gocv.VideoWriter
+}
+
+// run_streams 多路串流共用 pool 推論, 每個結果標上串流 ID, ctx 取消時停止
+func run_streams(ctx context.Context, pool []*Session_OD, manager *stream.Manager, opt StreamOption) error {
+	var results *json.Encoder
+	if opt.ResultFile != "" {
+		f, err := os.Create(opt.ResultFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		results = json.NewEncoder(f)
+	}
+
+	outputs := map[string]string{}
+	for _, src := range manager.Sources() {
+		outputs[src.ID] = src.Output
+	}
+	mu := sync.Mutex{}
+	states := map[string]*streamState{}
+	state := func(id string) *streamState {
+		mu.Lock()
+		defer mu.Unlock()
+		st, ok := states[id]
+		if !ok {
+			st = &streamState{}
+			if opt.Track {
+				st.tracker = new_tracker(opt.TrackAge)
+			}
+			states[id] = st
+		}
+		return st
+	}
+	defer func() {
+		for _, st := range states {
+			if st.writer != nil {
+				st.writer.Close()
+			}
+		}
+	}()
+
+	handle := func(worker int, f stream.Frame) error {
+		sess := pool[worker]
+		objs, err := sess.predict_image(f.Image, f.Threshold)
+		if err != nil {
+			return err
+		}
+		st := state(f.Stream)
+		if st.tracker != nil {
+			sess.track_objects(st.tracker, objs)
+		}
+		if results != nil {
+			mu.Lock()
+			err = results.Encode(StreamResult{Stream: f.Stream, Frame: f.Seq, Time: f.Time, Objects: objs})
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		// 推送失敗只記錄, 不影響預覽及錄影
+		publish := func() {
+			if opt.Events == nil {
+				return
+			}
+			if err := publish_events(opt.Events, f.Stream, f.Seq, f.Image, objs); err != nil {
+				fmt.Println(f.Stream, "publish events failed:", err)
+			}
+		}
+		output := outputs[f.Stream]
+		snapshot := opt.Events != nil && opt.Events.Snapshot()
+		if output == "" && opt.Preview == nil && !snapshot {
+			publish()
+			return nil
+		}
+		sess.draw(&f.Image, objs)
+		publish()
+		if opt.Preview != nil {
+			if err := opt.Preview.Publish(f.Stream, f.Image); err != nil {
+				return err
+			}
+		}
+		if output != "" {
+			if st.writer == nil {
+				vw, err := gocv.VideoWriterFile(output, utils.VideoCodec(output), f.FPS, f.Image.Cols(), f.Image.Rows(), true)
+				if err != nil {
+					return err
+				}
+				st.writer = vw
+			}
+			return st.writer.Write(f.Image)
+		}
+		return nil
+	}
+
+	report := func() error {
+		health := manager.Health()
+		for _, h := range health {
+			fmt.Printf("[%s] enabled=%t connected=%t capture %.1f fps, infer %.1f fps, %d frames, %d dropped, %d errors, %d reconnects\n",
+				h.ID, h.Enabled, h.Connected, h.CaptureFPS, h.FPS, h.Frames, h.Dropped, h.Errors, h.Reconnects)
+		}
+		if opt.HealthFile == "" {
+			return nil
+		}
+		return save_json(opt.HealthFile, health)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		manager.Run(ctx, len(pool), handle)
+	}()
+
+	if opt.HealthEvery <= 0 {
+		opt.HealthEvery = 10 * time.Second
+	}
+	ticker := time.NewTicker(opt.HealthEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := report(); err != nil {
+				fmt.Println("save stream health failed:", err)
+			}
+		case <-done:
+			return report()
+		}
+	}
+}
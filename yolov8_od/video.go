@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"go-onnxruntime-example/pkg/count"
+	"go-onnxruntime-example/pkg/event"
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/stream"
+	"go-onnxruntime-example/pkg/track"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// VideoOption 影片推論的設定
+type VideoOption struct {
+	Output       string        // 畫好結果的影片
+	Track        bool          // 給每個物件追蹤 ID
+	TrackAge     int           // 軌跡連續幾幀沒配對到就刪除, 0 為預設
+	Count        *count.Config // 跨線及區域計數, 需要追蹤
+	Classifier   *Session_CLS  // 兩階段流程的分類模型, 只在重新偵測的幀上分類
+	ClassifyOpt  ClassifyOption
+	SummaryEvery float64           // 每隔幾秒 (影片時間) 輸出一次計數統計
+	SummaryFile  string            // 計數統計的 JSON Lines 檔
+	Motion       *utils.MotionGate // 畫面沒有變化時跳過推論, 沿用上一次的結果
+	Flow         *utils.BoxFlow    // 每隔幾幀才偵測, 中間的幀以光流傳播上一次的框
+	Clip         *utils.ClipOption // 事件發生時錄下前後幾秒的片段
+	ClipOn       []ClipTrigger     // 觸發錄影的條件
+	Preview      *stream.MJPEGServer
+	Events       *event.Publisher // 推送偵測事件到 webhook 及 MQTT
+}
+
+// predict_video 逐幀偵測並畫到 opt.Output, ctx 取消時停止, 回傳處理的幀數
+func (sess *Session_OD) predict_video(ctx context.Context, input string, threshold float32, opt VideoOption) (int, error) {
+	video, err := utils.OpenVideoIO(input, opt.Output)
+	if err != nil {
+		return 0, err
+	}
+	defer video.Close()
+	fps := video.FPS
+
+	var clips *utils.ClipRecorder
+	if opt.Clip != nil && len(opt.ClipOn) > 0 {
+		if clips, err = utils.NewClipRecorder(*opt.Clip, fps); err != nil {
+			return 0, err
+		}
+		defer func() {
+			if err := clips.Close(); err != nil {
+				fmt.Println("close clip failed:", err)
+			}
+			fmt.Printf("saved %d event clips to %s\n", len(clips.Saved()), opt.Clip.Dir)
+		}()
+	}
+	present := map[string]bool{}
+
+	var tracker *track.Tracker
+	var counter *count.Counter
+	if opt.Track || opt.Count != nil {
+		tracker = new_tracker(opt.TrackAge)
+	}
+	if opt.Count != nil {
+		// 追蹤器刪除軌跡的同時, 計數也把它視為離開
+		counter = count.NewCounter(*opt.Count, float64(tracker.Option().MaxAge)/fps)
+	}
+	emit := func() error {
+		if counter == nil || opt.SummaryFile == "" {
+			return nil
+		}
+		if err := append_jsonl(opt.SummaryFile, counter.Summary()); err != nil {
+			return fmt.Errorf("write summary: %w", err)
+		}
+		return nil
+	}
+
+	sinceKey := 0
+	nextSummary := opt.SummaryEvery
+	last := []DetectObject{}
+	frames, err := video.Run(ctx, func(index int, frame *gocv.Mat) error {
+		t := float64(index) / fps
+
+		run, rois := true, []image.Rectangle(nil)
+		if opt.Motion != nil {
+			_, run, rois = opt.Motion.Detect(*frame)
+		}
+		var objs []DetectObject
+		var err error
+		propagated := false
+		if run && opt.Flow != nil && index > 0 && sinceKey < opt.Flow.Option().Interval {
+			objs, propagated = sess.propagate_objects(opt.Flow, *frame, last)
+		}
+		switch {
+		case propagated:
+			sinceKey++
+		case !run:
+			objs = append([]DetectObject{}, last...)
+		case len(rois) > 0:
+			objs, err = sess.predict_rois(*frame, rois, threshold)
+			objs = append(objs, outside_rois(last, rois)...)
+		default:
+			objs, err = sess.predict_image(*frame, threshold)
+		}
+		if err != nil {
+			return err
+		}
+		if run && !propagated && opt.Classifier != nil {
+			if err := opt.Classifier.classify_objects(*frame, objs, opt.ClassifyOpt); err != nil {
+				return err
+			}
+		}
+		if run && !propagated && opt.Flow != nil {
+			opt.Flow.Keyframe(*frame)
+			sinceKey = 1
+		}
+		last = objs
+		if tracker != nil {
+			sess.track_objects(tracker, objs)
+		}
+		var counts []count.Event
+		if counter != nil {
+			counts = counter.Update(t, count_objects(objs))
+			if opt.SummaryEvery > 0 && t >= nextSummary {
+				if err := emit(); err != nil {
+					return err
+				}
+				nextSummary += opt.SummaryEvery
+			}
+		}
+
+		sess.draw(frame, objs)
+		if counter != nil {
+			draw_counts(frame, counter)
+		}
+		if opt.Preview != nil {
+			if err := opt.Preview.Publish("video", *frame); err != nil {
+				return err
+			}
+		}
+		if opt.Events != nil {
+			if err := publish_events(opt.Events, "video", index, *frame, objs); err != nil {
+				fmt.Println("publish events failed:", err)
+			}
+		}
+		if clips != nil {
+			if err := clips.Trigger(clip_events(opt.ClipOn, index, t, objs, present, counts)...); err != nil {
+				return err
+			}
+			return clips.Push(*frame, t, index)
+		}
+		return nil
+	})
+	if err != nil {
+		return frames, err
+	}
+	return frames, emit()
+}
+
+// new_tracker maxAge 為軌跡連續幾幀沒配對到就刪除, 0 使用預設
+func new_tracker(maxAge int) *track.Tracker {
+	opt := track.DefaultOption()
+	if maxAge > 0 {
+		opt.MaxAge = maxAge
+	}
+	return track.New(opt)
+}
+
+// track_objects 以追蹤器填入每個物件的追蹤 ID
+func (sess *Session_OD) track_objects(tracker *track.Tracker, objs []DetectObject) {
+	boxes := make([]image.Rectangle, len(objs))
+	classIds := make([]int, len(objs))
+	for i, obj := range objs {
+		boxes[i] = obj.Box
+		classIds[i] = obj.ID
+	}
+	for i, id := range tracker.Update(boxes, classIds) {
+		objs[i].TrackID = id
+	}
+}
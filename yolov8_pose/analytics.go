@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// jointAngles 關節角度的定義: 名稱對應 (端點, 頂點, 端點) 的關鍵點名稱
+var jointAngles = []struct {
+	name    string
+	a, b, c string
+}{
+	{"left_elbow", "left_shoulder", "left_elbow", "left_wrist"},
+	{"right_elbow", "right_shoulder", "right_elbow", "right_wrist"},
+	{"left_knee", "left_hip", "left_knee", "left_ankle"},
+	{"right_knee", "right_hip", "right_knee", "right_ankle"},
+	{"left_hip", "left_shoulder", "left_hip", "left_knee"},
+	{"right_hip", "right_shoulder", "right_hip", "right_knee"},
+}
+
+// PostureRule 姿勢分類及跌倒偵測的規則, 角度單位為度
+type PostureRule struct {
+	LyingTrunk   float64 `json:"lying_trunk"`   // 軀幹與垂直線夾角超過此值視為躺
+	LyingAspect  float64 `json:"lying_aspect"`  // 沒有軀幹時, 框的寬高比超過此值視為躺
+	BendingTrunk float64 `json:"bending_trunk"` // 軀幹夾角超過此值視為彎腰
+	SittingKnee  float64 `json:"sitting_knee"`  // 膝蓋角度小於此值
+	SittingHip   float64 `json:"sitting_hip"`   // 且髖部角度小於此值視為坐
+
+	FallWindow      int     `json:"fall_window"`       // 跌倒比較的幀數
+	FallTrunkDelta  float64 `json:"fall_trunk_delta"`  // 期間內軀幹夾角增加超過此值
+	FallAspectDelta float64 `json:"fall_aspect_delta"` // 且寬高比增加超過此值視為跌倒
+	FallCooldown    int     `json:"fall_cooldown"`     // 同一人兩次跌倒事件間隔的幀數
+}
+
+func DefaultPostureRule() PostureRule {
+	return PostureRule{
+		LyingTrunk:      60,
+		LyingAspect:     1.2,
+		BendingTrunk:    30,
+		SittingKnee:     130,
+		SittingHip:      130,
+		FallWindow:      15,
+		FallTrunkDelta:  45,
+		FallAspectDelta: 0.6,
+		FallCooldown:    60,
+	}
+}
+
+// LoadPostureRule 讀取 JSON 規則, 沒寫到的欄位沿用預設值
+func LoadPostureRule(filename string) (PostureRule, error) {
+	rule := DefaultPostureRule()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return rule, err
+	}
+	err = json.Unmarshal(b, &rule)
+	return rule, err
+}
+
+// keypoint 依名稱取出可見的關鍵點
+func (obj PoseObject) keypoint(name string) (Keypoint, bool) {
+	for _, kp := range obj.Keypoints {
+		if kp.Name == name {
+			return kp, kp.X >= 0 && kp.Y >= 0
+		}
+	}
+	return Keypoint{}, false
+}
+
+// midpoint 兩個關鍵點的中點, 只有一個可見時取該點
+func (obj PoseObject) midpoint(a, b string) (float64, float64, bool) {
+	ka, okA := obj.keypoint(a)
+	kb, okB := obj.keypoint(b)
+	switch {
+	case okA && okB:
+		return float64(ka.X+kb.X) / 2, float64(ka.Y+kb.Y) / 2, true
+	case okA:
+		return float64(ka.X), float64(ka.Y), true
+	case okB:
+		return float64(kb.X), float64(kb.Y), true
+	}
+	return 0, 0, false
+}
+
+// angle 以 b 為頂點的 abc 夾角
+func angle(a, b, c Keypoint) float64 {
+	v1x, v1y := float64(a.X-b.X), float64(a.Y-b.Y)
+	v2x, v2y := float64(c.X-b.X), float64(c.Y-b.Y)
+	n := math.Hypot(v1x, v1y) * math.Hypot(v2x, v2y)
+	if n == 0 {
+		return 0
+	}
+	cos := math.Max(-1, math.Min(1, (v1x*v2x+v1y*v2y)/n))
+	return math.Acos(cos) * 180 / math.Pi
+}
+
+// analyze_angles 計算關節角度及軀幹與垂直線的夾角 (trunk), 缺少關鍵點的角度不輸出
+func (obj PoseObject) analyze_angles() map[string]float64 {
+	angles := map[string]float64{}
+	for _, j := range jointAngles {
+		a, okA := obj.keypoint(j.a)
+		b, okB := obj.keypoint(j.b)
+		c, okC := obj.keypoint(j.c)
+		if okA && okB && okC {
+			angles[j.name] = math.Round(angle(a, b, c)*10) / 10
+		}
+	}
+	sx, sy, okS := obj.midpoint("left_shoulder", "right_shoulder")
+	hx, hy, okH := obj.midpoint("left_hip", "right_hip")
+	if okS && okH && (sx != hx || sy != hy) {
+		trunk := math.Atan2(math.Abs(sx-hx), math.Abs(sy-hy)) * 180 / math.Pi
+		angles["trunk"] = math.Round(trunk*10) / 10
+	}
+	return angles
+}
+
+// aspect 框的寬高比
+func aspect(box image.Rectangle) float64 {
+	if box.Dy() == 0 {
+		return 0
+	}
+	return float64(box.Dx()) / float64(box.Dy())
+}
+
+// classify_posture 依規則分類為 standing, sitting, lying, bending, 資訊不足時為 unknown
+func (rule PostureRule) classify_posture(obj PoseObject) string {
+	trunk, hasTrunk := obj.Angles["trunk"]
+	switch {
+	case hasTrunk && trunk >= rule.LyingTrunk:
+		return "lying"
+	case !hasTrunk && aspect(obj.Box) >= rule.LyingAspect:
+		return "lying"
+	case !hasTrunk:
+		return "unknown"
+	case trunk >= rule.BendingTrunk:
+		return "bending"
+	}
+	bent := func(side string) bool {
+		knee, okK := obj.Angles[side+"_knee"]
+		hip, okH := obj.Angles[side+"_hip"]
+		return okK && okH && knee < rule.SittingKnee && hip < rule.SittingHip
+	}
+	if bent("left") || bent("right") {
+		return "sitting"
+	}
+	return "standing"
+}
+
+// FallEvent 跌倒事件
+type FallEvent struct {
+	Frame      int             `json:"frame"`
+	TrackID    int             `json:"track_id,omitempty"`
+	Box        image.Rectangle `json:"box"`
+	TrunkFrom  float64         `json:"trunk_from"`
+	TrunkTo    float64         `json:"trunk_to"`
+	AspectFrom float64         `json:"aspect_from"`
+	AspectTo   float64         `json:"aspect_to"`
+}
+
+type poseSample struct {
+	frame  int
+	trunk  float64
+	aspect float64
+}
+
+type poseHistory struct {
+	id       int // 追蹤 ID, 0 為以 IoU 串接
+	box      image.Rectangle
+	samples  []poseSample
+	lastFall int
+}
+
+// PoseAnalyzer 計算角度及姿勢, 並以追蹤 ID (沒有時以 IoU) 串接前後幀的人保留歷史來偵測跌倒
+type PoseAnalyzer struct {
+	rule      PostureRule
+	histories []*poseHistory
+}
+
+func NewPoseAnalyzer(rule PostureRule) *PoseAnalyzer {
+	return &PoseAnalyzer{rule: rule}
+}
+
+// analyze 填入每個人的角度及姿勢, 回傳這一幀的跌倒事件
+func (pa *PoseAnalyzer) analyze(frame int, objs []PoseObject) []FallEvent {
+	rule := pa.rule
+	for i := range objs {
+		objs[i].Angles = objs[i].analyze_angles()
+		objs[i].Posture = rule.classify_posture(objs[i])
+	}
+
+	events := []FallEvent{}
+	used := make([]bool, len(pa.histories))
+	next := []*poseHistory{}
+	for i := range objs {
+		best, bestIoU := -1, float32(0.3)
+		for k, ph := range pa.histories {
+			if used[k] {
+				continue
+			}
+			if objs[i].TrackID > 0 {
+				if ph.id == objs[i].TrackID {
+					best = k
+					break
+				}
+				continue
+			}
+			if iou := utils.IoU(ph.box, objs[i].Box); iou > bestIoU {
+				best, bestIoU = k, iou
+			}
+		}
+		var h *poseHistory
+		if best >= 0 {
+			h = pa.histories[best]
+			used[best] = true
+		} else {
+			h = &poseHistory{id: objs[i].TrackID, lastFall: -rule.FallCooldown - 1}
+		}
+		h.box = objs[i].Box
+		trunk, hasTrunk := objs[i].Angles["trunk"]
+		if !hasTrunk {
+			trunk = math.NaN()
+		}
+		h.samples = append(h.samples, poseSample{frame, trunk, aspect(objs[i].Box)})
+		for len(h.samples) > 0 && frame-h.samples[0].frame > rule.FallWindow {
+			h.samples = h.samples[1:]
+		}
+		next = append(next, h)
+
+		if objs[i].Posture != "lying" || frame-h.lastFall <= rule.FallCooldown {
+			continue
+		}
+		cur := h.samples[len(h.samples)-1]
+		for _, s := range h.samples[:len(h.samples)-1] {
+			trunkUp := !math.IsNaN(s.trunk) && !math.IsNaN(cur.trunk) && cur.trunk-s.trunk >= rule.FallTrunkDelta
+			aspectUp := cur.aspect-s.aspect >= rule.FallAspectDelta
+			if trunkUp && aspectUp {
+				h.lastFall = frame
+				objs[i].Fall = true
+				events = append(events, FallEvent{
+					Frame:      frame,
+					TrackID:    objs[i].TrackID,
+					Box:        objs[i].Box,
+					TrunkFrom:  s.trunk,
+					TrunkTo:    cur.trunk,
+					AspectFrom: math.Round(s.aspect*100) / 100,
+					AspectTo:   math.Round(cur.aspect*100) / 100,
+				})
+				break
+			}
+		}
+	}
+
+	// 這一幀沒出現的人保留到超過比較的幀數
+	for k, ph := range pa.histories {
+		if !used[k] && len(ph.samples) > 0 && frame-ph.samples[len(ph.samples)-1].frame <= rule.FallWindow {
+			next = append(next, ph)
+		}
+	}
+	pa.histories = next
+	return events
+}
+
+// draw_analytics 在框內畫姿勢, 在關節旁畫角度, 跌倒時框改成紅色
+func (sess *Session_Pose) draw_analytics(img *gocv.Mat, objs []PoseObject) {
+	style := utils.DefaultDrawStyle()
+	style.HideScores = true
+	style.LabelPos = "inside"
+	style.FontScale = 0.6
+	fallColor := color.RGBA{255, 0, 0, 255}
+	textColor := color.RGBA{255, 255, 255, 255}
+
+	for _, obj := range objs {
+		if obj.Posture == "" {
+			continue
+		}
+		label := obj.Posture
+		if trunk, ok := obj.Angles["trunk"]; ok {
+			label = fmt.Sprintf("%s trunk %.0f", label, trunk)
+		}
+		_color := utils.UltralyticsPalette[0]
+		if obj.Fall {
+			label = "FALL " + label
+			_color = fallColor
+			gocv.Rectangle(img, obj.Box, _color, 4)
+		}
+		style.DrawLabel(img, label, obj.Score, obj.Box, _color)
+
+		for _, j := range jointAngles {
+			deg, ok := obj.Angles[j.name]
+			if !ok {
+				continue
+			}
+			kp, _ := obj.keypoint(j.b)
+			gocv.PutText(img, fmt.Sprintf("%.0f", deg), image.Pt(kp.X+4, kp.Y-4), gocv.FontHersheySimplex, 0.4, textColor, 1)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+
+	ort "github.com/yam8511/go-onnxruntime"
+)
+
+// Session_OD 由上而下 (top-down) 流程使用的物件偵測模型, 只取出人的框
+type Session_OD struct {
+	session  *ort.Session
+	personId int
+}
+
+func NewSession_OD(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_OD, error) {
+	sess, err := ort.NewSessionWithONNX(ortSDK, onnxFile, useGPU)
+	if err != nil {
+		return nil, err
+	}
+
+	_names, err := sess.Metadata("names")
+	if err != nil {
+		sess.Release()
+		return nil, err
+	}
+
+	personId := 0
+	for i, name := range utils.MetadataToNames(_names) {
+		if name == "person" {
+			personId = i
+			break
+		}
+	}
+
+	return &Session_OD{
+		session:  sess,
+		personId: personId,
+	}, nil
+}
+
+// predict_person 取出人的框, iou 沿用姿態模型的 NMS 門檻 (-iou 及視窗的拉桿)
+func (sess *Session_OD) predict_person(img gocv.Mat, threshold, iou float32) (
+	[]image.Rectangle, []float32, error,
+) {
+	now := time.Now()
+	input0, _ := sess.session.Input("images")
+	imgSize := image.Pt(int(input0.Shape[2]), int(input0.Shape[3]))
+	xFactor := float32(img.Cols()) / float32(imgSize.X)
+	yFactor := float32(img.Rows()) / float32(imgSize.Y)
+
+	blob := gocv.BlobFromImage(img, 1.0/255, imgSize, gocv.NewScalar(0, 0, 0, 0), true, false)
+	defer blob.Close()
+	input, err := blob.DataPtrFloat32()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inputTensor, err := ort.NewInputTensor(sess.session, "", input)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer inputTensor.Destroy()
+
+	outputTensor, err := ort.NewEmptyOutputTensor[float32](sess.session, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer outputTensor.Destroy()
+
+	err = sess.session.RunDefault(
+		[]ort.AnyTensor{inputTensor},
+		[]ort.AnyTensor{outputTensor},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	output := outputTensor.GetData()
+
+	output0, _ := sess.session.Output("output0")
+	size := int(output0.Shape[2])
+	nameSize := int(output0.Shape[1])
+	imageWidth := img.Cols()
+	imageHeight := img.Rows()
+
+	boxes := []image.Rectangle{}
+	scores := []float32{}
+	for index := 0; index < size; index++ {
+		prob := output[size*(sess.personId+4)+index]
+		if prob < threshold {
+			continue
+		}
+		// 人不是最高分的類別就跳過
+		isPerson := true
+		for col := 0; col < nameSize-4; col++ {
+			if output[size*(col+4)+index] > prob {
+				isPerson = false
+				break
+			}
+		}
+		if !isPerson {
+			continue
+		}
+
+		xc := output[0*size+index]
+		yc := output[1*size+index]
+		w := output[2*size+index]
+		h := output[3*size+index]
+
+		x1 := utils.NormalizePoint((xc-w*0.5)*xFactor, imageWidth)
+		y1 := utils.NormalizePoint((yc-h*0.5)*yFactor, imageHeight)
+		x2 := utils.NormalizePoint((xc+w*0.5)*xFactor, imageWidth)
+		y2 := utils.NormalizePoint((yc+h*0.5)*yFactor, imageHeight)
+
+		boxes = append(boxes, image.Rect(x1, y1, x2, y2))
+		scores = append(scores, prob)
+	}
+
+	personBoxes := []image.Rectangle{}
+	personScores := []float32{}
+	if len(boxes) > 0 {
+		for _, idx := range gocv.NMSBoxes(boxes, scores, threshold, iou) {
+			personBoxes = append(personBoxes, boxes[idx])
+			personScores = append(personScores, scores[idx])
+		}
+	}
+
+	fmt.Printf("%s person detection, %d person\n", time.Since(now), len(personBoxes))
+	return personBoxes, personScores, nil
+}
+
+func (sess *Session_OD) release() { sess.session.Release() }
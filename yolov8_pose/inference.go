@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"image"
-	"image/color"
 	"os"
 	"time"
 
@@ -14,18 +13,37 @@ import (
 )
 
 type PoseObject struct {
-	Box       image.Rectangle
-	Score     float32
-	Keypoints [17]Keypoint
+	TrackID   int             `json:"track_id,omitempty"`
+	Box       image.Rectangle `json:"box"`
+	Score     float32         `json:"score"`
+	Keypoints []Keypoint      `json:"keypoints"`
+
+	// 姿態分析的結果
+	Angles  map[string]float64 `json:"angles,omitempty"`
+	Posture string             `json:"posture,omitempty"`
+	Fall    bool               `json:"fall,omitempty"`
 }
 
+// Keypoint 低於門檻或沒偵測到的關鍵點座標為 -1
 type Keypoint struct {
-	X, Y  int
-	Score float32
+	Name  string  `json:"name"`
+	X     int     `json:"x"`
+	Y     int     `json:"y"`
+	Score float32 `json:"score"`
+
+	// 時間平滑後的速度 (像素/秒)
+	VX float64 `json:"vx,omitempty"`
+	VY float64 `json:"vy,omitempty"`
 }
 
 type Session_Pose struct {
-	session *ort.Session
+	session  *ort.Session
+	skeleton Skeleton
+	kptDims  int // 每個關鍵點的輸出維度: 2 為 (x, y), 3 為 (x, y, score)
+	topdown  *TopDownOption
+	tta      bool
+	iou      float32 // NMS 的 IoU 門檻
+	noLabels bool    // 不畫追蹤 ID 及姿態分析的文字
 }
 
 func NewSession_Pose(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_Pose, error) {
@@ -34,8 +52,17 @@ func NewSession_Pose(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Sessio
 		return nil, err
 	}
 
+	skeleton, kptDims, err := skeletonFromMetadata(sess)
+	if err != nil {
+		sess.Release()
+		return nil, err
+	}
+
 	return &Session_Pose{
-		session: sess,
+		session:  sess,
+		skeleton: skeleton,
+		kptDims:  kptDims,
+		iou:      0.5,
 	}, nil
 }
 
@@ -50,13 +77,25 @@ func (sess *Session_Pose) predict_file(inputFile string, thresholdPerson, thresh
 	if err != nil {
 		return gocv.Mat{}, nil, err
 	}
-	objs, err := sess.predict(img, thresholdPerson, thresholdPose)
+	objs, err := sess.predict_image(img, thresholdPerson, thresholdPose)
 	if err != nil {
 		img.Close()
 	}
 	return img, objs, err
 }
 
+// predict_image 依設定選擇 top-down, TTA 或一般推論
+func (sess *Session_Pose) predict_image(img gocv.Mat, thresholdPerson, thresholdPose float32) ([]PoseObject, error) {
+	switch {
+	case sess.topdown != nil:
+		return sess.predict_topdown(img, thresholdPerson, thresholdPose, *sess.topdown)
+	case sess.tta:
+		return sess.predict_tta(img, thresholdPerson, thresholdPose)
+	default:
+		return sess.predict(img, thresholdPerson, thresholdPose)
+	}
+}
+
 func (sess *Session_Pose) predict(img gocv.Mat, thresholdPerson, thresholdPose float32) (
 	[]PoseObject, error,
 ) {
@@ -152,9 +191,12 @@ func (sess *Session_Pose) process_output(img gocv.Mat, output []float32, thresho
 	imageWidth := img.Cols()
 	imageHeight := img.Rows()
 
+	names := sess.skeleton.Keypoints
+	dims := sess.kptDims
+
 	boxes := make([]image.Rectangle, 0, size)
 	scores := make([]float32, 0, size)
-	keypoints := make([][17]Keypoint, 0, size)
+	keypoints := make([][]Keypoint, 0, size)
 	for index := 0; index < size; index++ {
 		score := output[4*size+index]
 
@@ -162,16 +204,19 @@ func (sess *Session_Pose) process_output(img gocv.Mat, output []float32, thresho
 			continue
 		}
 
-		kps := [17]Keypoint{}
-		for i := 0; i < 17; i++ {
-			kp_score := output[(7+i*3)*size+index]
+		kps := make([]Keypoint, len(names))
+		for i := range kps {
+			kp_score := float32(1)
+			if dims > 2 {
+				kp_score = output[(5+i*dims+2)*size+index]
+			}
 			if kp_score < thresholdPose {
-				kps[i] = Keypoint{-1, -1, kp_score}
+				kps[i] = Keypoint{Name: names[i], X: -1, Y: -1, Score: kp_score}
 				continue
 			}
-			kp_x := utils.NormalizePoint(output[(5+i*3)*size+index]*xFactor, imageWidth)
-			kp_y := utils.NormalizePoint(output[(6+i*3)*size+index]*yFactor, imageHeight)
-			kps[i] = Keypoint{kp_x, kp_y, kp_score}
+			kp_x := utils.NormalizePoint(output[(5+i*dims)*size+index]*xFactor, imageWidth)
+			kp_y := utils.NormalizePoint(output[(5+i*dims+1)*size+index]*yFactor, imageHeight)
+			kps[i] = Keypoint{Name: names[i], X: kp_x, Y: kp_y, Score: kp_score}
 		}
 
 		xc := output[0*size+index]
@@ -194,7 +239,7 @@ func (sess *Session_Pose) process_output(img gocv.Mat, output []float32, thresho
 		return
 	}
 
-	indices := gocv.NMSBoxes(boxes, scores, thresholdPerson, 0.5)
+	indices := gocv.NMSBoxes(boxes, scores, thresholdPerson, sess.iou)
 	for _, idx := range indices {
 		objs = append(objs, PoseObject{
 			Box:       boxes[idx],
@@ -212,10 +257,13 @@ func (sess *Session_Pose) draw(
 	objs []PoseObject,
 ) {
 	for _, obj := range objs {
-		_color := color.RGBA{200, 200, 200, 0}
+		_color := utils.UltralyticsPalette[0] // person
 
 		// 畫框框
 		gocv.Rectangle(img, obj.Box, _color, 4)
+		if obj.TrackID > 0 && !sess.noLabels {
+			gocv.PutText(img, fmt.Sprintf("#%d", obj.TrackID), image.Pt(obj.Box.Max.X-40, obj.Box.Min.Y+24), gocv.FontHersheySimplex, 0.7, _color, 2)
+		}
 
 		// 畫肢體
 		sess.draw_body(
@@ -223,95 +271,43 @@ func (sess *Session_Pose) draw(
 			0, 0,
 		)
 	}
+
+	// 畫姿勢, 角度及跌倒
+	if !sess.noLabels {
+		sess.draw_analytics(img, objs)
+	}
 }
 
+// draw_body 依關鍵點定義畫關鍵點及肢體, 任一端點缺少的肢體不畫
 func (sess *Session_Pose) draw_body(
 	img *gocv.Mat,
-	kps [17]Keypoint,
+	kps []Keypoint,
 	thickness, radius int,
 ) {
 	if thickness == 0 {
-		thickness = 1
+		thickness = 2
 	}
 
 	if radius == 0 {
 		radius = 3
 	}
 
-	// 畫頭部圓圈
-	for i := 0; i < 7; i++ {
-		kpt := image.Pt(int(kps[i].X), int(kps[i].Y))
-		gocv.Circle(img, kpt, radius, color.RGBA{200, 200, 0, 0}, -1)
+	visible := func(i int) bool {
+		return i < len(kps) && kps[i].X >= 0 && kps[i].Y >= 0
 	}
 
-	for i := 5; i < 13; i++ {
-		gocv.Circle(img, image.Pt(kps[i].X, kps[i].Y), radius, color.RGBA{200, 0, 200, 0}, -1)
-	}
-	for i := 11; i < 17; i++ {
-		gocv.Circle(img, image.Pt(kps[i].X, kps[i].Y), radius, color.RGBA{0, 200, 200, 0}, -1)
-	}
-
-	kpset := []struct {
-		kp_index []int
-		color    color.RGBA
-		closed   bool
-	}{
-		{
-			kp_index: []int{5, 3, 1},
-			color:    color.RGBA{200, 200, 0, 125},
-		},
-		{
-			kp_index: []int{6, 4, 2},
-			color:    color.RGBA{200, 200, 0, 125},
-		},
-		{
-			kp_index: []int{0, 1, 2},
-			color:    color.RGBA{200, 200, 0, 125},
-			closed:   true,
-		},
-		{
-			kp_index: []int{5, 7, 9},
-			color:    color.RGBA{0, 0, 200, 125},
-		},
-		{
-			kp_index: []int{6, 8, 10},
-			color:    color.RGBA{0, 0, 200, 125},
-		},
-		{
-			kp_index: []int{11, 13, 15},
-			color:    color.RGBA{0, 200, 0, 125},
-		},
-		{
-			kp_index: []int{12, 14, 16},
-			color:    color.RGBA{0, 200, 0, 125},
-		},
-		{
-			kp_index: []int{5, 6, 12, 11},
-			color:    color.RGBA{255, 0, 0, 125},
-			closed:   true,
-		},
+	for i, limb := range sess.skeleton.Limbs {
+		if !visible(limb[0]) || !visible(limb[1]) {
+			continue
+		}
+		a, b := kps[limb[0]], kps[limb[1]]
+		gocv.Line(img, image.Pt(a.X, a.Y), image.Pt(b.X, b.Y), sess.skeleton.LimbColors[i], thickness)
 	}
 
-	for _, kpi := range kpset {
-		func() { // 0~6
-			pts := gocv.NewPointsVector()
-			defer pts.Close()
-			pv := gocv.NewPointVector()
-			defer pv.Close()
-			for _, i := range kpi.kp_index {
-				kp := kps[i]
-				if kp.X < 0 || kp.Y < 0 {
-					continue
-				}
-				kpt := image.Pt(kp.X, kp.Y)
-				pv.Append(kpt)
-			}
-			pts.Append(pv)
-			if kpi.closed {
-				gocv.Polylines(img, pts, true, kpi.color, thickness)
-			} else {
-				gocv.Polylines(img, pts, false, kpi.color, thickness)
-			}
-		}()
+	for i := range kps {
+		if !visible(i) || i >= len(sess.skeleton.KptColors) {
+			continue
+		}
+		gocv.Circle(img, image.Pt(kps[i].X, kps[i].Y), radius, sess.skeleton.KptColors[i], -1)
 	}
 }
@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
 
 	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
 
 	ort "github.com/yam8511/go-onnxruntime"
 )
@@ -22,10 +25,32 @@ func main() {
 		flag.StringVar(&dllPath, "lib", "onnxruntime.dll", "onnxruntime DLL")
 	}
 	useGPU := flag.Bool("gpu", true, "inference using CUDA")
-	input := flag.String("input", "bus.jpg", "inference input image")
+	input := flag.String("input", "bus.jpg", "inference input image or video")
 	onnxFile := flag.String("onnx", "yolov8n-pose.onnx", "inference onnx model")
 	flag.Float64Var(&thresholdPerson, "conf_person", 0.25, "inference confidence threshold of person")
 	flag.Float64Var(&thresholdPose, "conf_pose", 0.5, "inference confidence threshold of pose")
+	show := flag.Bool("show", false, "show results in a window with threshold trackbars (space pause, n step, s snapshot, l labels, q quit)")
+	iou := flag.Float64("iou", 0.5, "NMS IoU threshold")
+	topdown := flag.Bool("topdown", false, "top-down pose: estimate pose again on each person crop")
+	topdownPadding := flag.Float64("topdown_pad", 0.25, "padding ratio of the person crops")
+	detOnnx := flag.String("det_onnx", "", "detection onnx model for the person boxes, empty to use the pose model's boxes")
+	skeletonFile := flag.String("skeleton", "", "JSON keypoint schema: keypoints, limbs, limb_colors, kpt_colors, flip_pairs")
+	tta := flag.Bool("tta", false, "test-time augmentation with a horizontal flip (swaps left/right keypoints)")
+	jsonFile := flag.String("json", "", "save the poses with keypoint names as JSON")
+	analytics := flag.Bool("analytics", false, "joint angles, posture classification and fall detection (video)")
+	postureRules := flag.String("posture_rules", "", "JSON posture and fall detection rules")
+	smooth := flag.String("smooth", "", "temporal keypoint smoothing with track IDs on video: oneeuro or kalman, empty to disable")
+	minCutoff := flag.Float64("min_cutoff", 1.0, "One-Euro minimum cutoff frequency (Hz), lower is smoother")
+	beta := flag.Float64("beta", 0.01, "One-Euro speed coefficient, higher reacts faster")
+	kalmanQ := flag.Float64("kalman_q", 1000, "Kalman process noise")
+	kalmanR := flag.Float64("kalman_r", 25, "Kalman measurement noise, higher is smoother")
+	output := flag.String("output", "result_pose.mp4", "output video when the input is a video")
+	clipFall := flag.Bool("clip_fall", false, "save a clip around each fall event (needs -analytics)")
+	clipDir := flag.String("clip_dir", "clips", "event clip folder, each clip has a JSON sidecar")
+	clipPre := flag.Float64("clip_pre", 5, "seconds kept before the event")
+	clipPost := flag.Float64("clip_post", 5, "seconds recorded after the last event")
+	clipMax := flag.Int("clip_max", 0, "keep at most N clips, 0 for no limit")
+	clipMaxMB := flag.Int64("clip_max_mb", 0, "keep the clips under N MB, 0 for no limit")
 	flag.Parse()
 
 	ortSDK, err := ort.New_ORT_SDK(func(opt *ort.OrtSdkOption) {
@@ -48,7 +73,91 @@ func main() {
 	}
 	defer sess.release()
 
+	if *skeletonFile != "" {
+		skeleton, err := LoadSkeleton(*skeletonFile)
+		if err == nil {
+			err = skeleton.check(len(sess.skeleton.Keypoints))
+		}
+		if err != nil {
+			log.Println("讀取關鍵點定義失敗: ", err)
+			return
+		}
+		sess.skeleton = skeleton
+	}
+	sess.tta = *tta
+	sess.iou = float32(*iou)
+
+	if *topdown {
+		opt := TopDownOption{Padding: *topdownPadding}
+		if *detOnnx != "" {
+			opt.Detector, err = NewSession_OD(ortSDK, *detOnnx, *useGPU)
+			if err != nil {
+				log.Println("建立物件偵測 Session 失敗: ", err)
+				return
+			}
+			defer opt.Detector.release()
+		}
+		sess.topdown = &opt
+	}
+
+	var analyzer *PoseAnalyzer
+	if *analytics {
+		rule := DefaultPostureRule()
+		if *postureRules != "" {
+			if rule, err = LoadPostureRule(*postureRules); err != nil {
+				log.Println("讀取姿勢規則失敗: ", err)
+				return
+			}
+		}
+		analyzer = NewPoseAnalyzer(rule)
+	}
+
+	var smoother *PoseSmoother
+	if *smooth != "" {
+		opt := DefaultSmoothOption()
+		opt.Method = *smooth
+		opt.MinCutoff = *minCutoff
+		opt.Beta = *beta
+		opt.Q, opt.R = *kalmanQ, *kalmanR
+		smoother = NewPoseSmoother(opt)
+	}
+
+	var clip *utils.ClipOption
+	if *clipFall {
+		if analyzer == nil {
+			log.Println("-clip_fall needs -analytics")
+			return
+		}
+		opt := utils.DefaultClipOption()
+		opt.Dir = *clipDir
+		opt.PreRoll, opt.PostRoll = *clipPre, *clipPost
+		opt.MaxClips = *clipMax
+		opt.MaxBytes = *clipMaxMB << 20
+		clip = &opt
+	}
+
 	sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	if *show {
+		if err := sess.show(sig, *input, float32(thresholdPerson), float32(thresholdPose)); err != nil {
+			log.Println("inference failed:", err)
+		}
+		return
+	}
+	if utils.IsVideo(*input) {
+		report, err := sess.predict_video(sig, *input, *output, float32(thresholdPerson), float32(thresholdPose), smoother, analyzer, clip)
+		if err != nil {
+			log.Println("inference failed:", err)
+		}
+		if *jsonFile != "" {
+			if err := save_json(*jsonFile, report); err != nil {
+				log.Println("儲存 JSON 失敗: ", err)
+				return
+			}
+		}
+		fmt.Printf("%d frames, %d fall events. and saved to %s\n", report.Frames, len(report.Events), *output)
+		return
+	}
+
 	for i := 0; i < 5; i++ {
 		select {
 		case <-sig.Done():
@@ -60,9 +169,27 @@ func main() {
 			log.Println("inference failed:", err)
 			return
 		}
+		if analyzer != nil {
+			analyzer.analyze(0, objs)
+		}
+		if *jsonFile != "" {
+			if err := save_json(*jsonFile, objs); err != nil {
+				log.Println("儲存 JSON 失敗: ", err)
+				img.Close()
+				return
+			}
+		}
 		sess.draw(&img, objs)
 		gocv.IMWrite("result_pose.jpg", img)
 		img.Close()
 		fmt.Printf("detect %d person. and saved to result_pose.jpg\n", len(objs))
 	}
 }
+
+func save_json(filename string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// show 在視窗中即時顯示姿態, 拉桿調整人及關鍵點的門檻與 iou 並在下一幀生效, 輸入為圖片時重複推論同一張.
+// 離開時印出最後選定的門檻
+func (sess *Session_Pose) show(ctx context.Context, input string, thresholdPerson, thresholdPose float32) error {
+	viewer := utils.NewViewer("yolov8 pose", "result_pose")
+	defer viewer.Close()
+	viewer.AddThreshold("conf_person", float64(thresholdPerson))
+	viewer.AddThreshold("conf_pose", float64(thresholdPose))
+	viewer.AddThreshold("iou", float64(sess.iou))
+
+	defer func() { sess.noLabels = false }()
+	return viewer.Run(ctx, input, func(frame *gocv.Mat) error {
+		sess.iou = viewer.Threshold("iou")
+		objs, err := sess.predict_image(*frame, viewer.Threshold("conf_person"), viewer.Threshold("conf_pose"))
+		if err != nil {
+			return err
+		}
+		sess.noLabels = !viewer.Labels
+		sess.draw(frame, objs)
+		return nil
+	})
+}
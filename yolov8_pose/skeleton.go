@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+
+	"go-onnxruntime-example/pkg/utils"
+
+	ort "github.com/yam8511/go-onnxruntime"
+)
+
+// Skeleton 姿態的關鍵點定義: 名稱, 肢體連線, 顏色以及水平翻轉時左右互換的關鍵點
+type Skeleton struct {
+	Keypoints  []string
+	Limbs      [][2]int
+	LimbColors []color.RGBA
+	KptColors  []color.RGBA
+	FlipPairs  [][2]int
+}
+
+// skeletonFile 設定檔的格式, 顏色為 #RRGGBB
+type skeletonFile struct {
+	Keypoints  []string `json:"keypoints"`
+	Limbs      [][2]int `json:"limbs"`
+	LimbColors []string `json:"limb_colors"`
+	KptColors  []string `json:"kpt_colors"`
+	FlipPairs  [][2]int `json:"flip_pairs"`
+}
+
+// COCOSkeleton COCO 17 個關鍵點, 連線及顏色同 Ultralytics
+func COCOSkeleton() Skeleton {
+	palette := func(idx ...int) []color.RGBA {
+		colors := make([]color.RGBA, len(idx))
+		for i, k := range idx {
+			colors[i] = utils.PosePalette[k]
+		}
+		return colors
+	}
+	return Skeleton{
+		Keypoints: []string{
+			"nose", "left_eye", "right_eye", "left_ear", "right_ear",
+			"left_shoulder", "right_shoulder", "left_elbow", "right_elbow", "left_wrist", "right_wrist",
+			"left_hip", "right_hip", "left_knee", "right_knee", "left_ankle", "right_ankle",
+		},
+		Limbs: [][2]int{
+			{15, 13}, {13, 11}, {16, 14}, {14, 12}, {11, 12}, {5, 11}, {6, 12}, {5, 6}, {5, 7},
+			{6, 8}, {7, 9}, {8, 10}, {1, 2}, {0, 1}, {0, 2}, {1, 3}, {2, 4}, {3, 5}, {4, 6},
+		},
+		LimbColors: palette(9, 9, 9, 9, 7, 7, 7, 0, 0, 0, 0, 0, 16, 16, 16, 16, 16, 16, 16),
+		KptColors:  palette(16, 16, 16, 16, 16, 0, 0, 0, 0, 0, 0, 9, 9, 9, 9, 9, 9),
+		FlipPairs:  [][2]int{{1, 2}, {3, 4}, {5, 6}, {7, 8}, {9, 10}, {11, 12}, {13, 14}, {15, 16}},
+	}
+}
+
+// GenericSkeleton 只有關鍵點數量時的定義, 不畫連線
+func GenericSkeleton(n int) Skeleton {
+	s := Skeleton{}
+	for i := 0; i < n; i++ {
+		s.Keypoints = append(s.Keypoints, fmt.Sprintf("kpt_%d", i))
+		s.KptColors = append(s.KptColors, utils.PosePalette[i%len(utils.PosePalette)])
+	}
+	return s
+}
+
+// ParseSkeleton 解析 JSON 格式的關鍵點定義, 沒給顏色時依序使用 utils.PosePalette
+func ParseSkeleton(b []byte) (Skeleton, error) {
+	f := skeletonFile{}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return Skeleton{}, err
+	}
+	s := Skeleton{Keypoints: f.Keypoints, Limbs: f.Limbs, FlipPairs: f.FlipPairs}
+	parse := func(hexes []string, n int) ([]color.RGBA, error) {
+		colors := make([]color.RGBA, n)
+		for i := range colors {
+			if i >= len(hexes) {
+				colors[i] = utils.PosePalette[i%len(utils.PosePalette)]
+				continue
+			}
+			c, err := utils.ParseHexColor(hexes[i])
+			if err != nil {
+				return nil, err
+			}
+			colors[i] = c
+		}
+		return colors, nil
+	}
+	var err error
+	if s.LimbColors, err = parse(f.LimbColors, len(f.Limbs)); err != nil {
+		return s, err
+	}
+	if s.KptColors, err = parse(f.KptColors, len(f.Keypoints)); err != nil {
+		return s, err
+	}
+	return s, s.validate()
+}
+
+// LoadSkeleton 讀取 JSON 格式的關鍵點定義檔
+func LoadSkeleton(filename string) (Skeleton, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return Skeleton{}, err
+	}
+	return ParseSkeleton(b)
+}
+
+// skeletonFromMetadata 優先使用模型 metadata 的 skeleton (JSON), 否則依 kpt_shape 決定關鍵點數量,
+// 17 點時視為 COCO. 回傳每個關鍵點在輸出中的維度 (2 為只有座標, 3 多了信心分數)
+func skeletonFromMetadata(sess *ort.Session) (Skeleton, int, error) {
+	n, dims := 17, 3
+	if _shape, err := sess.Metadata("kpt_shape"); err == nil && _shape != "" {
+		shape := []int{}
+		if err := json.Unmarshal([]byte(_shape), &shape); err != nil || len(shape) != 2 {
+			return Skeleton{}, 0, fmt.Errorf("invalid kpt_shape metadata %q", _shape)
+		}
+		n, dims = shape[0], shape[1]
+	}
+	if _skeleton, err := sess.Metadata("skeleton"); err == nil && _skeleton != "" {
+		s, err := ParseSkeleton([]byte(_skeleton))
+		if err != nil {
+			return s, dims, err
+		}
+		return s, dims, s.check(n)
+	}
+	if n == 17 {
+		return COCOSkeleton(), dims, nil
+	}
+	return GenericSkeleton(n), dims, nil
+}
+
+func (s Skeleton) validate() error {
+	n := len(s.Keypoints)
+	for _, limb := range s.Limbs {
+		if limb[0] < 0 || limb[0] >= n || limb[1] < 0 || limb[1] >= n {
+			return fmt.Errorf("limb %v out of %d keypoints", limb, n)
+		}
+	}
+	for _, pair := range s.FlipPairs {
+		if pair[0] < 0 || pair[0] >= n || pair[1] < 0 || pair[1] >= n {
+			return fmt.Errorf("flip pair %v out of %d keypoints", pair, n)
+		}
+	}
+	return nil
+}
+
+// check 確認定義的關鍵點數量與模型輸出一致
+func (s Skeleton) check(n int) error {
+	if len(s.Keypoints) != n {
+		return fmt.Errorf("skeleton has %d keypoints, model outputs %d", len(s.Keypoints), n)
+	}
+	return nil
+}
+
+// Flip 把水平翻轉圖上的關鍵點映射回原圖: x 鏡像並互換左右, 與 utils.TTABox 相同以 width - x 鏡像連續座標,
+// 再限制在 [0, width-1] 的像素範圍內 (x = 0 不會映射到圖外的 width)
+func (s Skeleton) Flip(kps []Keypoint, width int) []Keypoint {
+	flipped := make([]Keypoint, len(kps))
+	copy(flipped, kps)
+	for i := range flipped {
+		if flipped[i].X < 0 {
+			continue
+		}
+		x := width - flipped[i].X
+		if x > width-1 {
+			x = width - 1
+		}
+		if x < 0 {
+			x = 0
+		}
+		flipped[i].X = x
+	}
+	for _, pair := range s.FlipPairs {
+		a, b := pair[0], pair[1]
+		flipped[a], flipped[b] = flipped[b], flipped[a]
+		flipped[a].Name, flipped[b].Name = kps[a].Name, kps[b].Name
+	}
+	return flipped
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"go-onnxruntime-example/pkg/track"
+)
+
+// SmoothOption 關鍵點時間平滑的設定
+type SmoothOption struct {
+	Method    string  // oneeuro 或 kalman
+	MinCutoff float64 // One-Euro 的最低截止頻率 (Hz)
+	Beta      float64 // One-Euro 截止頻率隨速度增加的比例
+	Q, R      float64 // Kalman 的過程雜訊及量測雜訊
+}
+
+func DefaultSmoothOption() SmoothOption {
+	return SmoothOption{
+		Method:    "oneeuro",
+		MinCutoff: 1.0,
+		Beta:      0.01,
+		Q:         1000,
+		R:         25,
+	}
+}
+
+type pointFilter struct {
+	x, y track.Filter
+}
+
+// PoseSmoother 以追蹤器給每個人 ID, 再對每個人的每個關鍵點做時間平滑
+type PoseSmoother struct {
+	opt     SmoothOption
+	tracker *track.Tracker
+	filters map[int][]pointFilter
+}
+
+func NewPoseSmoother(opt SmoothOption) *PoseSmoother {
+	return &PoseSmoother{
+		opt:     opt,
+		tracker: track.New(track.DefaultOption()),
+		filters: map[int][]pointFilter{},
+	}
+}
+
+func (ps *PoseSmoother) new_filter() track.Filter {
+	if ps.opt.Method == "kalman" {
+		return track.NewKalman(ps.opt.Q, ps.opt.R)
+	}
+	return track.NewOneEuro(ps.opt.MinCutoff, ps.opt.Beta)
+}
+
+// smooth 填入追蹤 ID 並平滑時間 t (秒) 的關鍵點.
+// 消失的關鍵點維持 -1 並重設它的濾波器, 遺失的軌跡會刪除濾波器, 之後以新 ID 重新初始化
+func (ps *PoseSmoother) smooth(t float64, objs []PoseObject) {
+	boxes := make([]image.Rectangle, len(objs))
+	for i, obj := range objs {
+		boxes[i] = obj.Box
+	}
+	ids := ps.tracker.Update(boxes, nil)
+	for _, id := range ps.tracker.Lost() {
+		delete(ps.filters, id)
+	}
+
+	for i := range objs {
+		id := ids[i]
+		objs[i].TrackID = id
+		filters, ok := ps.filters[id]
+		if !ok || len(filters) != len(objs[i].Keypoints) {
+			filters = make([]pointFilter, len(objs[i].Keypoints))
+			for k := range filters {
+				filters[k] = pointFilter{ps.new_filter(), ps.new_filter()}
+			}
+			ps.filters[id] = filters
+		}
+		for k, kp := range objs[i].Keypoints {
+			f := filters[k]
+			if kp.X < 0 || kp.Y < 0 {
+				f.x.Reset()
+				f.y.Reset()
+				continue
+			}
+			x := f.x.Filter(float64(kp.X), t)
+			y := f.y.Filter(float64(kp.Y), t)
+			objs[i].Keypoints[k].X = int(math.Round(x))
+			objs[i].Keypoints[k].Y = int(math.Round(y))
+			objs[i].Keypoints[k].VX = math.Round(f.x.Velocity()*10) / 10
+			objs[i].Keypoints[k].VY = math.Round(f.y.Velocity()*10) / 10
+		}
+	}
+}
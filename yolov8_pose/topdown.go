@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// TopDownOption 由上而下 (top-down) 姿態估計的設定
+type TopDownOption struct {
+	Padding  float64     // 人框向外擴張的比例
+	Detector *Session_OD // 取人框的偵測模型, nil 時使用姿態模型自己的框
+}
+
+// predict_topdown 先取得人框, 每個人框擴張後 letterbox 成模型輸入大小再估一次姿態,
+// 最後把關鍵點映射回原圖座標, 遠處的小人會比整張圖直接推論準確許多
+func (sess *Session_Pose) predict_topdown(img gocv.Mat, thresholdPerson, thresholdPose float32, opt TopDownOption) (
+	[]PoseObject, error,
+) {
+	var boxes []image.Rectangle
+	var scores []float32
+	var fallback []PoseObject
+	if opt.Detector != nil {
+		var err error
+		boxes, scores, err = opt.Detector.predict_person(img, thresholdPerson, sess.iou)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		objs, err := sess.predict(img, thresholdPerson, thresholdPose)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			boxes = append(boxes, obj.Box)
+			scores = append(scores, obj.Score)
+		}
+		fallback = objs
+	}
+
+	input0, _ := sess.session.Input("images")
+	inputSize := image.Pt(int(input0.Shape[2]), int(input0.Shape[3]))
+	imageWidth := img.Cols()
+	imageHeight := img.Rows()
+
+	results := []PoseObject{}
+	for i, box := range boxes {
+		crop := utils.CropRect(box, opt.Padding, false, imageWidth, imageHeight)
+		if crop.Empty() {
+			continue
+		}
+		region := img.Region(crop)
+		lb, scale, pad := utils.Letterbox(region, inputSize)
+		region.Close()
+		objs, err := sess.predict(lb, thresholdPerson, thresholdPose)
+		lb.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// 挑出與原本人框最吻合的姿態
+		toCrop := func(x, y int) image.Point {
+			return image.Pt(
+				int(math.Round(float64(x-crop.Min.X)*scale))+pad.X,
+				int(math.Round(float64(y-crop.Min.Y)*scale))+pad.Y,
+			)
+		}
+		target := image.Rectangle{Min: toCrop(box.Min.X, box.Min.Y), Max: toCrop(box.Max.X, box.Max.Y)}
+		best, bestIoU := -1, float32(0)
+		for j, obj := range objs {
+			if iou := utils.IoU(obj.Box, target); iou > bestIoU {
+				best, bestIoU = j, iou
+			}
+		}
+		if best < 0 {
+			if fallback != nil {
+				results = append(results, fallback[i])
+			}
+			continue
+		}
+
+		obj := PoseObject{
+			Box:       box,
+			Score:     scores[i],
+			Keypoints: objs[best].Keypoints,
+		}
+		for k, kp := range obj.Keypoints {
+			if kp.X < 0 || kp.Y < 0 {
+				continue
+			}
+			obj.Keypoints[k].X = utils.NormalizePoint(float64(kp.X-pad.X)/scale+float64(crop.Min.X), imageWidth)
+			obj.Keypoints[k].Y = utils.NormalizePoint(float64(kp.Y-pad.Y)/scale+float64(crop.Min.Y), imageHeight)
+		}
+		results = append(results, obj)
+	}
+
+	return results, nil
+}
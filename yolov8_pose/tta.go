@@ -0,0 +1,76 @@
+package main
+
+import (
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// predict_tta 原圖及水平翻轉各推論一次, 翻轉結果依 FlipPairs 互換左右後,
+// 與原圖 IoU 最高的姿態以分數加權平均關鍵點
+func (sess *Session_Pose) predict_tta(img gocv.Mat, thresholdPerson, thresholdPose float32) (
+	[]PoseObject, error,
+) {
+	objs, err := sess.predict(img, thresholdPerson, thresholdPose)
+	if err != nil {
+		return nil, err
+	}
+
+	flipped := gocv.NewMat()
+	defer flipped.Close()
+	gocv.Flip(img, &flipped, 1)
+	flips, err := sess.predict(flipped, thresholdPerson, thresholdPose)
+	if err != nil {
+		return nil, err
+	}
+
+	width := img.Cols()
+	used := make([]bool, len(flips))
+	for i := range flips {
+		box := utils.TTABox(flips[i].Box, utils.TTAVariant{Scale: 1, Flip: true}, width, img.Rows())
+		flips[i].Box = box
+		flips[i].Keypoints = sess.skeleton.Flip(flips[i].Keypoints, width)
+	}
+
+	for i := range objs {
+		best, bestIoU := -1, float32(0.5)
+		for j := range flips {
+			if used[j] {
+				continue
+			}
+			if iou := utils.IoU(objs[i].Box, flips[j].Box); iou > bestIoU {
+				best, bestIoU = j, iou
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[best] = true
+		objs[i].Score = (objs[i].Score + flips[best].Score) / 2
+		for k, kp := range objs[i].Keypoints {
+			fk := flips[best].Keypoints[k]
+			switch {
+			case fk.X < 0:
+				// 只有原圖有
+			case kp.X < 0:
+				objs[i].Keypoints[k] = fk
+			default:
+				// 以分數加權平均, 兩邊分數都是 0 時 (-conf_pose 0) 直接平均
+				ka, kb := kp.Score, fk.Score
+				if ka+kb <= 0 {
+					ka, kb = 1, 1
+				}
+				w := ka + kb
+				objs[i].Keypoints[k].X = int((float32(kp.X)*ka + float32(fk.X)*kb) / w)
+				objs[i].Keypoints[k].Y = int((float32(kp.Y)*ka + float32(fk.Y)*kb) / w)
+				objs[i].Keypoints[k].Score = (kp.Score + fk.Score) / 2
+			}
+		}
+	}
+
+	for j := range flips {
+		if !used[j] {
+			objs = append(objs, flips[j])
+		}
+	}
+	return objs, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// FramePoses 單一幀的姿態
+type FramePoses struct {
+	Frame int          `json:"frame"`
+	Poses []PoseObject `json:"poses"`
+}
+
+// PoseReport 影片的姿態及跌倒事件
+type PoseReport struct {
+	Input  string       `json:"input"`
+	Output string       `json:"output"`
+	Frames int          `json:"frames"`
+	Events []FallEvent  `json:"events"`
+	Poses  []FramePoses `json:"poses"`
+}
+
+// predict_video 逐幀估計姿態並畫到 output, smoother 不為 nil 時追蹤並平滑關鍵點,
+// analyzer 不為 nil 時分析姿勢及跌倒, clip 不為 nil 時把跌倒前後錄成片段, ctx 取消時停止並回傳已處理的部分
+func (sess *Session_Pose) predict_video(ctx context.Context, input, output string, thresholdPerson, thresholdPose float32,
+	smoother *PoseSmoother, analyzer *PoseAnalyzer, clip *utils.ClipOption,
+) (
+	PoseReport, error,
+) {
+	report := PoseReport{Input: input, Output: output, Events: []FallEvent{}, Poses: []FramePoses{}}
+
+	video, err := utils.OpenVideoIO(input, output)
+	if err != nil {
+		return report, err
+	}
+	defer video.Close()
+	fps := video.FPS
+
+	var clips *utils.ClipRecorder
+	if clip != nil && analyzer != nil {
+		if clips, err = utils.NewClipRecorder(*clip, fps); err != nil {
+			return report, err
+		}
+		defer func() {
+			if err := clips.Close(); err != nil {
+				fmt.Println("close clip failed:", err)
+			}
+			fmt.Printf("saved %d fall clips to %s\n", len(clips.Saved()), clip.Dir)
+		}()
+	}
+
+	report.Frames, err = video.Run(ctx, func(frame int, img *gocv.Mat) error {
+		objs, err := sess.predict_image(*img, thresholdPerson, thresholdPose)
+		if err != nil {
+			return err
+		}
+		t := float64(frame) / fps
+		if smoother != nil {
+			smoother.smooth(t, objs)
+		}
+		var falls []FallEvent
+		if analyzer != nil {
+			falls = analyzer.analyze(frame, objs)
+			report.Events = append(report.Events, falls...)
+		}
+		report.Poses = append(report.Poses, FramePoses{Frame: frame, Poses: objs})
+		sess.draw(img, objs)
+		if clips == nil {
+			return nil
+		}
+		for _, fall := range falls {
+			if err := clips.Trigger(utils.ClipEvent{Time: t, Frame: frame, Type: "fall", Detections: fall}); err != nil {
+				return err
+			}
+		}
+		return clips.Push(*img, t, frame)
+	})
+	return report, err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// CutoutOption 去背輸出的設定
+type CutoutOption struct {
+	Classes    []string   // 只保留這些類別, 空的代表全部
+	Feather    int        // 邊緣羽化的半徑 (像素), 0 為不羽化
+	Crops      bool       // 額外輸出每個實例的裁切圖
+	Background string     // 背景: transparent 透明, blur 模糊原圖, color 純色
+	Color      color.RGBA // Background 為 color 時的背景色
+}
+
+func (opt CutoutOption) match(label string) bool {
+	if len(opt.Classes) == 0 {
+		return true
+	}
+	for _, name := range opt.Classes {
+		if strings.EqualFold(name, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse_background 解析背景參數: transparent, blur 或 #RRGGBB
+func parse_background(s string) (string, color.RGBA, error) {
+	switch s {
+	case "", "transparent":
+		return "transparent", color.RGBA{}, nil
+	case "blur":
+		return "blur", color.RGBA{}, nil
+	}
+	c, err := utils.ParseHexColor(s)
+	if err != nil {
+		return "", color.RGBA{}, fmt.Errorf("invalid background %q, expect transparent, blur or #RRGGBB", s)
+	}
+	return "color", c, nil
+}
+
+// cutout 以選取實例的遮罩聯集作為 alpha 輸出 BGRA 去背圖,
+// Crops 時另外回傳每個實例以自身遮罩去背後的框內裁切圖 (需要 MaskOption.Bitmap)
+func cutout(img gocv.Mat, objs []SegmentObject, opt CutoutOption) (gocv.Mat, []gocv.Mat) {
+	imageWidth, imageHeight := img.Cols(), img.Rows()
+
+	bg := gocv.NewMat()
+	defer bg.Close()
+	switch opt.Background {
+	case "blur":
+		k := imageWidth
+		if imageHeight > k {
+			k = imageHeight
+		}
+		k = k/40*2 + 1
+		gocv.GaussianBlur(img, &bg, image.Pt(k, k), 0, 0, gocv.BorderDefault)
+	case "color":
+		bg.Close()
+		bg = gocv.NewMatWithSizeFromScalar(
+			gocv.NewScalar(float64(opt.Color.B), float64(opt.Color.G), float64(opt.Color.R), 0),
+			imageHeight, imageWidth, gocv.MatTypeCV8UC3,
+		)
+	}
+
+	masks := []*utils.Bitmask{}
+	selected := []SegmentObject{}
+	for _, obj := range objs {
+		if obj.Bitmap == nil || !opt.match(obj.Label) {
+			continue
+		}
+		masks = append(masks, obj.Bitmap)
+		selected = append(selected, obj)
+	}
+
+	var alpha gocv.Mat
+	if len(masks) > 0 {
+		alpha = utils.MergeBitmasks(masks).ToMat(imageWidth, imageHeight)
+	} else {
+		alpha = gocv.Zeros(imageHeight, imageWidth, gocv.MatTypeCV8UC1)
+	}
+	result := compose_cutout(img, bg, alpha, opt.Feather)
+	alpha.Close()
+
+	crops := []gocv.Mat{}
+	if !opt.Crops {
+		return result, crops
+	}
+	for _, obj := range selected {
+		rect := obj.Box.Inset(-opt.Feather).Intersect(image.Rect(0, 0, imageWidth, imageHeight))
+		if rect.Empty() {
+			continue
+		}
+		alpha := obj.Bitmap.ToMat(imageWidth, imageHeight)
+		full := compose_cutout(img, bg, alpha, opt.Feather)
+		region := full.Region(rect)
+		crops = append(crops, region.Clone())
+		region.Close()
+		full.Close()
+		alpha.Close()
+	}
+	return result, crops
+}
+
+// compose_cutout 合成 BGRA 圖: 背景為空時 alpha 即遮罩 (透明背景),
+// 否則依遮罩把原圖疊在替換的背景上, alpha 全不透明
+func compose_cutout(img, bg, mask gocv.Mat, feather int) gocv.Mat {
+	alpha := mask.Clone()
+	defer alpha.Close()
+	if feather > 0 {
+		k := feather*2 + 1
+		gocv.GaussianBlur(alpha, &alpha, image.Pt(k, k), 0, 0, gocv.BorderDefault)
+	}
+
+	fg := img.Clone()
+	defer fg.Close()
+	if !bg.Empty() {
+		// fg = img * a + bg * (1 - a)
+		a := gocv.NewMat()
+		defer a.Close()
+		alpha.ConvertToWithParams(&a, gocv.MatTypeCV32F, 1.0/255, 0)
+		a3 := gocv.NewMat()
+		defer a3.Close()
+		gocv.Merge([]gocv.Mat{a, a, a}, &a3)
+		inv := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(1, 1, 1, 0), a3.Rows(), a3.Cols(), gocv.MatTypeCV32FC3)
+		defer inv.Close()
+		gocv.Subtract(inv, a3, &inv)
+
+		f := gocv.NewMat()
+		defer f.Close()
+		img.ConvertTo(&f, gocv.MatTypeCV32FC3)
+		b := gocv.NewMat()
+		defer b.Close()
+		bg.ConvertTo(&b, gocv.MatTypeCV32FC3)
+		gocv.Multiply(f, a3, &f)
+		gocv.Multiply(b, inv, &b)
+		gocv.Add(f, b, &f)
+		f.ConvertTo(&fg, gocv.MatTypeCV8UC3)
+		alpha.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	}
+
+	channels := gocv.Split(fg)
+	channels = append(channels, alpha)
+	dst := gocv.NewMat()
+	gocv.Merge(channels, &dst)
+	for _, ch := range channels[:len(channels)-1] {
+		ch.Close()
+	}
+	return dst
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"math/rand"
 	"os"
 	"time"
 
@@ -14,20 +13,29 @@ import (
 	ort "github.com/yam8511/go-onnxruntime"
 )
 
-const mask_thresh = 0.5
-
 type SegmentObject struct {
-	ID    int
-	Label string
-	Score float32
-	Box   image.Rectangle
-	Mask  []image.Point
+	ID    int             `json:"id"`
+	Label string          `json:"label"`
+	Score float32         `json:"score"`
+	Box   image.Rectangle `json:"box"`
+	Mask  []image.Point   `json:"mask"` // 面積最大的外輪廓
+
+	Polygons []utils.Polygon `json:"polygons,omitempty"` // 所有外輪廓及孔洞
+	Area     int             `json:"area,omitempty"`     // 遮罩的像素面積
+	RLE      *utils.RLE      `json:"rle,omitempty"`      // COCO RLE
+	Bitmap   *utils.Bitmask  `json:"-"`                  // 全解析度的二值遮罩
 }
 
 type Session_SEG struct {
-	session *ort.Session
-	names   []string
-	colors  []color.RGBA
+	session   *ort.Session
+	names     []string
+	colors    []color.RGBA
+	slice     *utils.SliceOption
+	mask      MaskOption
+	letterbox bool
+	style     utils.DrawStyle
+	iou       float32     // NMS 的 IoU 門檻
+	inputSize image.Point // 模型輸入的寬高
 }
 
 func NewSession_SEG(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session_SEG, error) {
@@ -43,18 +51,17 @@ func NewSession_SEG(ortSDK *ort.ORT_SDK, onnxFile string, useGPU bool) (*Session
 	}
 	names := utils.MetadataToNames(_names)
 
-	colors := []color.RGBA{}
-	if len(names) > 0 {
-		rng := rand.New(rand.NewSource(time.Now().UnixMilli()))
-		for range names {
-			colors = append(colors, color.RGBA{uint8(rng.Intn(255)), uint8(rng.Intn(255)), uint8(rng.Intn(255)), 255})
-		}
-	}
+	colors, _ := utils.PaletteColors(names, "ultralytics")
+	input0, _ := sess.Input("images")
 
 	return &Session_SEG{
-		session: sess,
-		names:   names,
-		colors:  colors,
+		inputSize: image.Pt(int(input0.Shape[3]), int(input0.Shape[2])),
+		session:   sess,
+		names:     names,
+		colors:    colors,
+		mask:      MaskOption{Threshold: 0.5},
+		style:     utils.DefaultDrawStyle(),
+		iou:       0.5,
 	}, nil
 }
 
@@ -69,19 +76,27 @@ func (sess *Session_SEG) predict_file(inputFile string, threshold float32) (
 	if err != nil {
 		return gocv.Mat{}, nil, err
 	}
-	objs, err := sess.predict(img, threshold)
+	objs, err := sess.predict_image(img, threshold)
 	if err != nil {
 		img.Close()
 	}
 	return img, objs, err
 }
 
+// predict_image 依設定選擇切片或一般推論
+func (sess *Session_SEG) predict_image(img gocv.Mat, threshold float32) ([]SegmentObject, error) {
+	if sess.slice != nil {
+		return sess.predict_sliced(img, threshold, *sess.slice)
+	}
+	return sess.predict(img, threshold)
+}
+
 func (sess *Session_SEG) predict(img gocv.Mat, threshold float32) (
 	[]SegmentObject, error,
 ) {
 	var preP, inferP, postP time.Duration
 	now := time.Now()
-	input, xFactor, yFactor, err := sess.prepare_input(img.Clone())
+	input, xFactor, yFactor, pad, err := sess.prepare_input(img.Clone())
 	if err != nil {
 		return nil, err
 	}
@@ -99,24 +114,19 @@ func (sess *Session_SEG) predict(img gocv.Mat, threshold float32) (
 		}
 	}()
 
-	ptr0, err := outputs[0].GetTensorMutableData()
-	if err != nil {
-		return nil, err
-	}
-
 	ptr1, err := outputs[1].GetTensorMutableData()
 	if err != nil {
 		return nil, err
 	}
 
+	output0 := outputs[0].GetData()
 	sizes0 := outputs[0].GetShape().Sizes()
-	output0 := gocv.NewMatWithSizesFromPtr([]int{sizes0[1], sizes0[2]}, gocv.MatTypeCV32F, ptr0)
 
 	sizes1 := outputs[1].GetShape().Sizes()
 	output1 := gocv.NewMatWithSizesFromPtr([]int{sizes1[1], sizes1[2], sizes1[3]}, gocv.MatTypeCV32F, ptr1)
 
 	now = time.Now()
-	objs, err := sess.process_output(&output0, &output1, &img, xFactor, yFactor, threshold)
+	objs, err := sess.process_output(output0, sizes0, &output1, &img, xFactor, yFactor, pad, threshold)
 	if err != nil {
 		return nil, err
 	}
@@ -135,12 +145,24 @@ func (sess *Session_SEG) predict(img gocv.Mat, threshold float32) (
 	return objs, nil
 }
 
-func (sess *Session_SEG) prepare_input(img gocv.Mat) ([]float32, float32, float32, error) {
+// prepare_input 回傳模型輸入以及座標轉換參數: 原圖座標 = (模型座標 - pad) * factor
+func (sess *Session_SEG) prepare_input(img gocv.Mat) ([]float32, float32, float32, image.Point, error) {
 	// img := gocv.IMRead(inputFile, gocv.IMReadColor)
 	defer img.Close()
-	input0, _ := sess.session.Input("images")
-	imgSize := image.Pt(int(input0.Shape[2]), int(input0.Shape[3]))
+	imgSize := sess.inputSize
 	img_width, img_height := img.Cols(), img.Rows()
+	xFactor := float32(img_width) / float32(imgSize.X)
+	yFactor := float32(img_height) / float32(imgSize.Y)
+	pad := image.Point{}
+
+	if sess.letterbox {
+		lb, scale, _pad := utils.Letterbox(img, imgSize)
+		img.Close()
+		img = lb
+		xFactor = float32(1 / scale)
+		yFactor = float32(1 / scale)
+		pad = _pad
+	}
 
 	ratio := 1.0 / 255
 	mean := gocv.NewScalar(0, 0, 0, 0)
@@ -148,15 +170,12 @@ func (sess *Session_SEG) prepare_input(img gocv.Mat) ([]float32, float32, float3
 	blob := gocv.BlobFromImage(img, ratio, imgSize, mean, swapRGB, false)
 	input, err := blob.DataPtrFloat32()
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, 0, 0, pad, err
 	}
 	inputData := make([]float32, len(input))
 	copy(inputData, input)
 	blob.Close()
-	return inputData,
-		float32(img_width) / float32(imgSize.X),
-		float32(img_height) / float32(imgSize.Y),
-		nil
+	return inputData, xFactor, yFactor, pad, nil
 }
 
 func (sess *Session_SEG) run_model(input []float32) (
@@ -195,28 +214,25 @@ func (sess *Session_SEG) run_model(input []float32) (
 	return ret, nil
 }
 
-func (sess *Session_SEG) process_output(_output0, output1, img *gocv.Mat, xFactor, yFactor, accu_thresh float32) (
+// process_output output0 為 [1 116 8400] 的原始資料, 直接在 []float32 上找出超過門檻的 anchor,
+// NMS 後只把存活者的 mask 係數集中成 [n 32], 跟原型 [32 25600] 做一次矩陣乘法算出所有遮罩
+func (sess *Session_SEG) process_output(
+	output0 []float32, sizes0 []int, output1, img *gocv.Mat,
+	xFactor, yFactor float32, pad image.Point, accu_thresh float32,
+) (
 	objs []SegmentObject, err error,
 ) {
-	output0 := _output0.T() // [116 8400] => [8400 116]
-	_output0.Close()
-	defer func() {
-		output0.Close()
-		output1.Close()
-	}()
-
-	// fmt.Println("output0 shape = ", output0.Size())  // [8400 116]
-	// fmt.Println("output1 shape = ", _output1.Size()) // [32 160 160]
+	defer output1.Close()
 
 	objs = []SegmentObject{}
-	sizes_0 := output0.Size() // [8400 116]
 	sizes_1 := output1.Size() // [32 160 160]
 
-	rows := sizes_0[0]               // 8400
-	totalSize := sizes_0[1]          // 116
+	totalSize := sizes0[1]           // 116
+	rows := sizes0[2]                // 8400
 	maskSize := sizes_1[0]           // 32
 	maskHeight := sizes_1[1]         // 160
 	nameSize := totalSize - maskSize // 116 - 32
+	padX, padY := float32(pad.X), float32(pad.Y)
 	imageWidth := img.Cols()
 	imageHeight := img.Rows()
 
@@ -224,118 +240,88 @@ func (sess *Session_SEG) process_output(_output0, output1, img *gocv.Mat, xFacto
 	scores := make([]float32, 0, rows)
 	classIds := make([]int, 0, rows)
 	originIdx := make([]int, 0, rows)
+	inputBoxes := make([][4]float32, 0, rows)
 
 	for index := 0; index < rows; index++ {
-		func() {
-			row := output0.RowRange(index, index+1)
-			defer row.Close()
-
-			classes := row.ColRange(4, nameSize)
-			defer classes.Close()
-
-			_, maxScore, _, maxLoc := gocv.MinMaxLoc(classes)
-			if maxScore < accu_thresh {
-				return
+		class_id, maxScore := 0, float32(0.0)
+		for col := 4; col < nameSize; col++ {
+			if output0[rows*col+index] > maxScore {
+				maxScore = output0[rows*col+index]
+				class_id = col - 4
 			}
-			// mask := row.ColRange(nameSize, row.Cols())
-
-			xc := row.GetFloatAt(0, 0)
-			yc := row.GetFloatAt(0, 1)
-			w := row.GetFloatAt(0, 2)
-			h := row.GetFloatAt(0, 3)
-
-			x1 := utils.NormalizePoint((xc-w*0.5)*xFactor, imageWidth)
-			y1 := utils.NormalizePoint((yc-h*0.5)*yFactor, imageHeight)
-			x2 := utils.NormalizePoint((xc+w*0.5)*xFactor, imageWidth)
-			y2 := utils.NormalizePoint((yc+h*0.5)*yFactor, imageHeight)
-
-			boxes = append(boxes, image.Rect(x1, y1, x2, y2))
-			scores = append(scores, maxScore)
-			classIds = append(classIds, maxLoc.X)
-			originIdx = append(originIdx, index)
-		}()
+		}
+		if maxScore < accu_thresh {
+			continue
+		}
+
+		xc := output0[0*rows+index]
+		yc := output0[1*rows+index]
+		w := output0[2*rows+index]
+		h := output0[3*rows+index]
+
+		x1 := utils.NormalizePoint((xc-w*0.5-padX)*xFactor, imageWidth)
+		y1 := utils.NormalizePoint((yc-h*0.5-padY)*yFactor, imageHeight)
+		x2 := utils.NormalizePoint((xc+w*0.5-padX)*xFactor, imageWidth)
+		y2 := utils.NormalizePoint((yc+h*0.5-padY)*yFactor, imageHeight)
+
+		boxes = append(boxes, image.Rect(x1, y1, x2, y2))
+		scores = append(scores, maxScore)
+		classIds = append(classIds, class_id)
+		originIdx = append(originIdx, index)
+		inputBoxes = append(inputBoxes, [4]float32{xc - w*0.5, yc - h*0.5, xc + w*0.5, yc + h*0.5})
 	}
 
 	if len(boxes) == 0 {
 		return
 	}
 
-	indices := gocv.NMSBoxes(boxes, scores, accu_thresh, 0.5)
-
-	output1_reshape := output1.Reshape(output1.Channels(), maskSize) // [32 160 160] => [32 25600]
-	defer output1_reshape.Close()
-	for _, idx := range indices {
-		originIndex := originIdx[idx]
-		box := boxes[idx]
-		func() {
-			row := output0.RowRange(originIndex, originIndex+1) // [8400 116] => [1 116]
-			col := row.ColRange(nameSize, totalSize)            // [1 116] => [1 32]
-			row.Close()
-
-			mask := col.MultiplyMatrix(output1_reshape)
-			col.Close()
-
-			mask_reshape := mask.Reshape(mask.Channels(), maskHeight)
-			mask.Close()
-
-			gocv.Resize(mask_reshape, &mask_reshape, image.Pt(imageWidth, imageHeight), 0, 0, gocv.InterpolationDefault)
-
-			mask_region := mask_reshape.Region(box)
-			mask_reshape.Close()
-			defer mask_region.Close()
-
-			gocv.Threshold(mask_region, &mask_region, 1, 255, gocv.ThresholdBinary)
-			mask_region.ConvertTo(&mask_region, gocv.MatTypeCV8U)
-			// if !gocv.IMWrite(fmt.Sprintf("mask_%d.jpg", idx), mask_region) {
-			// 	fmt.Println("存圖失敗")
-			// }
-
-			pts_vec := gocv.FindContours(mask_region, gocv.RetrievalExternal, gocv.ChainApproxSimple)
-			defer pts_vec.Close()
-
-			maxAreaIdx := -1
-			maxArea := -1.0
-			for i := 0; i < pts_vec.Size(); i++ { // 找出最大面積
-				contour := pts_vec.At(i)
-				area := gocv.ContourArea(contour)
-				// fmt.Println(idx, "面積 ==> ", area, "|", i)
-				if area > maxArea {
-					maxAreaIdx = i
-					maxArea = area
-				}
-			}
-
-			// mask_draw := mask_region.Clone()
-			// defer mask_draw.Close()
-			// gocv.CvtColor(mask_draw, &mask_draw, gocv.ColorGrayToBGR)
+	indices := []int{}
+	for _, idx := range gocv.NMSBoxes(boxes, scores, accu_thresh, sess.iou) {
+		if !boxes[idx].Empty() {
+			indices = append(indices, idx)
+		}
+	}
+	if len(indices) == 0 {
+		return
+	}
 
-			pts := []image.Point{}
-			if maxAreaIdx >= 0 {
-				contour := pts_vec.At(maxAreaIdx)
-				pts = contour.ToPoints()
-				// gocv.DrawContours(&mask_draw, pts_vec, maxAreaIdx, color.RGBA{R: 255}, 4)
-				// fmt.Println(idx, "最終選擇 ", maxAreaIdx, " ==> ", maxArea)
-			}
+	// 存活者的 mask 係數 [n 32]
+	coeffs := gocv.NewMatWithSize(len(indices), maskSize, gocv.MatTypeCV32F)
+	defer coeffs.Close()
+	for i, idx := range indices {
+		for k := 0; k < maskSize; k++ {
+			coeffs.SetFloatAt(i, k, output0[rows*(nameSize+k)+originIdx[idx]])
+		}
+	}
 
-			// if !gocv.IMWrite(fmt.Sprintf("mask_draw_%d.jpg", idx), mask_draw) {
-			// 	fmt.Println("存圖失敗")
-			// }
+	protos := output1.Reshape(output1.Channels(), maskSize) // [32 160 160] => [32 25600]
+	defer protos.Close()
 
-			for i := range pts {
-				pts[i].X += box.Min.X
-				pts[i].Y += box.Min.Y
-			}
+	// [n 32] x [32 25600] => [n 25600], 再一次對全部做 sigmoid: 1 / (1 + exp(-x))
+	masks := coeffs.MultiplyMatrix(protos)
+	defer masks.Close()
+	masks.MultiplyFloat(-1)
+	gocv.Exp(masks, &masks)
+	masks.AddFloat(1)
+	gocv.Pow(masks, -1, &masks)
 
-			// return pts
-			obj := SegmentObject{
-				ID:    classIds[idx],
-				Label: sess.names[classIds[idx]],
-				Score: scores[idx],
-				Box:   box,
-				Mask:  pts,
-			}
-			objs = append(objs, obj)
-		}()
+	for i, idx := range indices {
+		box := boxes[idx]
+		row := masks.RowRange(i, i+1)      // [1 25600]
+		prob := row.Reshape(1, maskHeight) // [160 160]
+		mask_region := sess.decode_mask(prob, inputBoxes[idx], box, xFactor, yFactor, pad, image.Pt(imageWidth, imageHeight))
+		prob.Close()
+		row.Close()
+
+		obj := SegmentObject{
+			ID:    classIds[idx],
+			Label: sess.names[classIds[idx]],
+			Score: scores[idx],
+			Box:   box,
+		}
+		sess.fill_mask(&obj, mask_region)
+		mask_region.Close()
+		objs = append(objs, obj)
 	}
 
 	return
@@ -346,24 +332,30 @@ func (sess *Session_SEG) release() { sess.session.Release() }
 func (sess *Session_SEG) draw(
 	img *gocv.Mat, objs []SegmentObject,
 ) {
+	masks := make([][][]image.Point, 0, len(objs))
+	colors := make([]color.RGBA, 0, len(objs))
 	for _, obj := range objs {
-		_color := sess.colors[obj.ID]
-		pt := gocv.NewPointVectorFromPoints(obj.Mask)
-		pts := gocv.NewPointsVector()
-		pts.Append(pt)
-		gocv.Polylines(img, pts, true, _color, 8)
-		pts.Close()
+		polygons := [][]image.Point{}
+		if obj.Polygons != nil {
+			for _, polygon := range obj.Polygons {
+				polygons = append(polygons, polygon.Outer)
+				polygons = append(polygons, polygon.Holes...)
+			}
+		} else if len(obj.Mask) > 0 {
+			polygons = append(polygons, obj.Mask)
+		}
+		masks = append(masks, polygons)
+		colors = append(colors, sess.style.Color(obj.Label, sess.colors[obj.ID]))
 	}
+	sess.style.DrawMasks(img, masks, colors)
 
-	for _, obj := range objs {
-		_color := sess.colors[obj.ID]
-		utils.DrawLabel(
+	for i, obj := range objs {
+		sess.style.DrawLabel(
 			img,
 			obj.Label,
 			obj.Score,
 			obj.Box,
-			_color,
-			0, 0, 0,
+			colors[i],
 		)
 	}
 }
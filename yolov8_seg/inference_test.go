@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+const (
+	benchAnchors = 8400
+	benchClasses = 80
+	benchMasks   = 32
+	benchProto   = 160
+)
+
+// syntheticOutputs 以固定亂數產生 [1 116 8400] 及 [1 32 160 160] 的模型輸出:
+// 大部分 anchor 的分數很低, 只有 objects 個物件各有 3 個互相重疊的 anchor 超過門檻
+func syntheticOutputs(objects int) (output0 []float32, output1 []byte) {
+	r := rand.New(rand.NewSource(1))
+	channels := 4 + benchClasses + benchMasks
+	output0 = make([]float32, channels*benchAnchors)
+	set := func(ch, anchor int, v float32) { output0[ch*benchAnchors+anchor] = v }
+	for a := 0; a < benchAnchors; a++ {
+		set(0, a, r.Float32()*640)
+		set(1, a, r.Float32()*640)
+		set(2, a, 20+r.Float32()*180)
+		set(3, a, 20+r.Float32()*180)
+		for c := 0; c < benchClasses; c++ {
+			set(4+c, a, r.Float32()*0.1)
+		}
+		for k := 0; k < benchMasks; k++ {
+			set(4+benchClasses+k, a, float32(r.NormFloat64()))
+		}
+	}
+	for i := 0; i < objects; i++ {
+		xc, yc := 100+r.Float32()*440, 100+r.Float32()*440
+		w, h := 60+r.Float32()*120, 60+r.Float32()*120
+		class := r.Intn(benchClasses)
+		for j := 0; j < 3; j++ {
+			a := r.Intn(benchAnchors)
+			set(0, a, xc+float32(j)*2)
+			set(1, a, yc-float32(j)*2)
+			set(2, a, w)
+			set(3, a, h)
+			set(4+class, a, 0.9-float32(j)*0.1)
+		}
+	}
+
+	output1 = make([]byte, benchMasks*benchProto*benchProto*4)
+	for i := 0; i < len(output1); i += 4 {
+		binary.LittleEndian.PutUint32(output1[i:], math.Float32bits(float32(r.NormFloat64())))
+	}
+	return output0, output1
+}
+
+func benchSession() *Session_SEG {
+	names := make([]string, benchClasses)
+	for i := range names {
+		names[i] = fmt.Sprint("class", i)
+	}
+	return &Session_SEG{
+		names:     names,
+		inputSize: image.Pt(640, 640),
+		mask:      MaskOption{Threshold: 0.5},
+		iou:       0.5,
+	}
+}
+
+func protoMat(tb testing.TB, output1 []byte) gocv.Mat {
+	mat, err := gocv.NewMatWithSizesFromBytes([]int{benchMasks, benchProto, benchProto}, gocv.MatTypeCV32F, output1)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return mat
+}
+
+// process_output_rows 改寫前的後處理, 作為比較的基準: 轉置後每個 anchor 取 RowRange/ColRange 以 MinMaxLoc 找最高分,
+// 每個存活者各自做一次 [1 32] x [32 25600] 的矩陣乘法
+func (sess *Session_SEG) process_output_rows(
+	_output0, output1, img *gocv.Mat,
+	xFactor, yFactor float32, pad image.Point, accu_thresh float32,
+) []SegmentObject {
+	output0 := _output0.T() // [116 8400] => [8400 116]
+	_output0.Close()
+	defer func() {
+		output0.Close()
+		output1.Close()
+	}()
+
+	objs := []SegmentObject{}
+	sizes_0 := output0.Size()
+	sizes_1 := output1.Size()
+	rows := sizes_0[0]
+	totalSize := sizes_0[1]
+	maskSize := sizes_1[0]
+	maskHeight := sizes_1[1]
+	nameSize := totalSize - maskSize
+	padX, padY := float32(pad.X), float32(pad.Y)
+
+	boxes := []image.Rectangle{}
+	scores := []float32{}
+	classIds := []int{}
+	originIdx := []int{}
+	inputBoxes := [][4]float32{}
+	for index := 0; index < rows; index++ {
+		func() {
+			row := output0.RowRange(index, index+1)
+			defer row.Close()
+			classes := row.ColRange(4, nameSize)
+			defer classes.Close()
+			_, maxScore, _, maxLoc := gocv.MinMaxLoc(classes)
+			if maxScore < accu_thresh {
+				return
+			}
+			xc, yc := row.GetFloatAt(0, 0), row.GetFloatAt(0, 1)
+			w, h := row.GetFloatAt(0, 2), row.GetFloatAt(0, 3)
+			x1 := utils.NormalizePoint((xc-w*0.5-padX)*xFactor, img.Cols())
+			y1 := utils.NormalizePoint((yc-h*0.5-padY)*yFactor, img.Rows())
+			x2 := utils.NormalizePoint((xc+w*0.5-padX)*xFactor, img.Cols())
+			y2 := utils.NormalizePoint((yc+h*0.5-padY)*yFactor, img.Rows())
+			boxes = append(boxes, image.Rect(x1, y1, x2, y2))
+			scores = append(scores, maxScore)
+			classIds = append(classIds, maxLoc.X)
+			originIdx = append(originIdx, index)
+			inputBoxes = append(inputBoxes, [4]float32{xc - w*0.5, yc - h*0.5, xc + w*0.5, yc + h*0.5})
+		}()
+	}
+	if len(boxes) == 0 {
+		return objs
+	}
+
+	protos := output1.Reshape(output1.Channels(), maskSize)
+	defer protos.Close()
+	for _, idx := range gocv.NMSBoxes(boxes, scores, accu_thresh, sess.iou) {
+		if boxes[idx].Empty() {
+			continue
+		}
+		func() {
+			row := output0.RowRange(originIdx[idx], originIdx[idx]+1)
+			col := row.ColRange(nameSize, totalSize)
+			row.Close()
+			mask := col.MultiplyMatrix(protos)
+			col.Close()
+			prob := mask.Reshape(mask.Channels(), maskHeight)
+			mask.Close()
+			defer prob.Close()
+			prob.MultiplyFloat(-1)
+			gocv.Exp(prob, &prob)
+			prob.AddFloat(1)
+			gocv.Pow(prob, -1, &prob)
+
+			region := sess.decode_mask(prob, inputBoxes[idx], boxes[idx], xFactor, yFactor, pad, image.Pt(img.Cols(), img.Rows()))
+			defer region.Close()
+			obj := SegmentObject{
+				ID:    classIds[idx],
+				Label: sess.names[classIds[idx]],
+				Score: scores[idx],
+				Box:   boxes[idx],
+			}
+			sess.fill_mask(&obj, region)
+			objs = append(objs, obj)
+		}()
+	}
+	return objs
+}
+
+// 直接掃 []float32 的結果要跟逐列掃描的基準一致
+func TestProcessOutputMatchesRowScan(t *testing.T) {
+	sess := benchSession()
+	output0, output1 := syntheticOutputs(20)
+	img := gocv.NewMatWithSize(640, 640, gocv.MatTypeCV8UC3)
+	defer img.Close()
+
+	protos := protoMat(t, output1)
+	got, err := sess.process_output(output0, []int{1, 4 + benchClasses + benchMasks, benchAnchors}, &protos, &img, 1, 1, image.Point{}, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := make([]byte, len(output0)*4)
+	for i, v := range output0 {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(v))
+	}
+	rows, err := gocv.NewMatFromBytes(4+benchClasses+benchMasks, benchAnchors, gocv.MatTypeCV32F, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseProtos := protoMat(t, output1)
+	want := sess.process_output_rows(&rows, &baseProtos, &img, 1, 1, image.Point{}, 0.5)
+
+	if len(got) != len(want) || len(got) == 0 {
+		t.Fatalf("got %d objects, want %d", len(got), len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.ID != w.ID || g.Box != w.Box || g.Score != w.Score || len(g.Mask) != len(w.Mask) {
+			t.Errorf("object %d: got %v %v %.3f (%d points), want %v %v %.3f (%d points)",
+				i, g.Label, g.Box, g.Score, len(g.Mask), w.Label, w.Box, w.Score, len(w.Mask))
+		}
+	}
+}
+
+func BenchmarkProcessOutput(b *testing.B) {
+	sess := benchSession()
+	output0, output1 := syntheticOutputs(20)
+	sizes0 := []int{1, 4 + benchClasses + benchMasks, benchAnchors}
+	img := gocv.NewMatWithSize(640, 640, gocv.MatTypeCV8UC3)
+	defer img.Close()
+
+	b.Run("vectorized", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			protos := protoMat(b, output1)
+			b.StartTimer()
+			if _, err := sess.process_output(output0, sizes0, &protos, &img, 1, 1, image.Point{}, 0.5); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	raw := make([]byte, len(output0)*4)
+	for i, v := range output0 {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(v))
+	}
+	b.Run("rows", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			protos := protoMat(b, output1)
+			rows, err := gocv.NewMatFromBytes(sizes0[1], sizes0[2], gocv.MatTypeCV32F, raw)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			sess.process_output_rows(&rows, &protos, &img, 1, 1, image.Point{}, 0.5)
+		}
+	})
+}
@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"image/color"
 	"log"
+	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
 
 	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
 
 	ort "github.com/yam8511/go-onnxruntime"
 )
@@ -25,6 +29,46 @@ func main() {
 	input := flag.String("input", "bus.jpg", "inference input image")
 	onnxFile := flag.String("onnx", "yolov8n-seg.onnx", "inference onnx model")
 	flag.Float64Var(&threshold, "conf", 0.7, "inference confidence threshold")
+	show := flag.Bool("show", false, "show results in a window with threshold trackbars (space pause, n step, s snapshot, l labels, m masks, q quit)")
+	iou := flag.Float64("iou", 0.5, "NMS IoU threshold")
+	sliceSize := flag.Int("slice", 0, "sliced inference with tile size, 0 to disable")
+	sliceOverlap := flag.Float64("slice_overlap", 0.2, "overlap ratio between tiles")
+	sliceFull := flag.Bool("slice_full", true, "also run inference on the full image when slicing")
+	sliceMerge := flag.String("slice_merge", "nmm", "merge method across tile seams: nms or nmm")
+	maskThreshold := flag.Float64("mask_conf", 0.5, "mask threshold after sigmoid")
+	retinaMasks := flag.Bool("retina_masks", false, "upsample mask prototypes to full resolution before cropping (finer edges)")
+	letterbox := flag.Bool("letterbox", false, "letterbox the input like Ultralytics instead of stretching it")
+	maskBitmap := flag.Bool("mask_bitmap", false, "keep full-resolution binary masks and save them as result_seg_mask_{i}.png")
+	maskPolygons := flag.Bool("mask_polygons", false, "output all mask contours with holes (RetrievalCComp)")
+	maskRLE := flag.Bool("mask_rle", false, "output masks as COCO RLE in the JSON")
+	jsonFile := flag.String("json", "", "save the segments as JSON")
+	palette := flag.String("palette", "ultralytics", "class color palette: ultralytics or hash")
+	colorMap := flag.String("colors", "", "JSON or YAML file mapping class names to #RRGGBB colors")
+	styleFile := flag.String("style", "", "JSON drawing style config, e.g. thickness, label_position and per-class colors")
+	thickness := flag.Int("thickness", 2, "box thickness")
+	fontScale := flag.Float64("font_scale", 0.8, "label font scale")
+	fontFile := flag.String("font", "", "TTF/OTF font for labels (e.g. Noto Sans CJK for Chinese), empty for Hershey")
+	fontSize := flag.Float64("font_size", 20, "TTF font size in pixels")
+	labelPos := flag.String("label_pos", "outside", "label position: outside or inside the box")
+	hideLabels := flag.Bool("hide_labels", false, "hide class names")
+	hideScores := flag.Bool("hide_scores", false, "hide scores")
+	labelAlpha := flag.Float64("label_alpha", 1, "label background opacity")
+	maskAlpha := flag.Float64("mask_alpha", 0.4, "mask fill opacity, 0 to draw outlines only")
+	maskOutline := flag.Int("mask_outline", 2, "mask outline thickness, 0 to disable")
+	cutoutMode := flag.Bool("cutout", false, "save a background removed BGRA PNG as result_seg_cutout.png")
+	cutoutClasses := flag.String("cutout_classes", "", "comma separated classes to keep in the cutout, empty for all")
+	cutoutFeather := flag.Int("cutout_feather", 0, "feather the cutout edges by N pixels")
+	cutoutCrops := flag.Bool("cutout_crops", false, "also save each instance as result_seg_cutout_{i}.png")
+	cutoutBg := flag.String("cutout_bg", "transparent", "cutout background: transparent, blur or #RRGGBB")
+	redactMode := flag.Bool("redact", false, "anonymize segmented objects in the input image or video")
+	redactClasses := flag.String("redact_classes", "person", "comma separated classes to anonymize, empty for all")
+	redactMethod := flag.String("redact_method", "blur", "anonymize method: blur, pixelate or fill")
+	redactLevel := flag.Int("redact_level", 8, "blur kernel or pixel blocks relative to the box long side")
+	redactPadding := flag.Float64("redact_pad", 0.1, "expand the box (or dilate the mask) by this ratio before anonymizing")
+	redactColor := flag.String("redact_color", "#000000", "fill color as #RRGGBB")
+	redactMask := flag.Bool("redact_mask", true, "anonymize exactly inside the mask instead of the whole box")
+	redactOutput := flag.String("redact_out", "", "anonymized output, default result_redact.jpg or result_redact.mp4")
+	redactAudit := flag.String("redact_audit", "result_redact.json", "save the redaction audit as JSON")
 	flag.Parse()
 
 	ortSDK, err := ort.New_ORT_SDK(func(opt *ort.OrtSdkOption) {
@@ -47,7 +91,139 @@ func main() {
 	}
 	defer sess.release()
 
+	if *styleFile != "" {
+		if sess.style, err = utils.LoadDrawStyle(*styleFile); err != nil {
+			log.Println("讀取樣式設定失敗: ", err)
+			return
+		}
+	}
+	// 有指定的參數覆寫樣式設定
+	reloadFont := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "thickness":
+			sess.style.Thickness = *thickness
+		case "font_scale":
+			sess.style.FontScale = *fontScale
+		case "label_pos":
+			sess.style.LabelPos = *labelPos
+		case "hide_labels":
+			sess.style.HideLabels = *hideLabels
+		case "hide_scores":
+			sess.style.HideScores = *hideScores
+		case "label_alpha":
+			sess.style.LabelAlpha = *labelAlpha
+		case "font":
+			sess.style.FontFile = *fontFile
+			reloadFont = true
+		case "font_size":
+			sess.style.FontSize = *fontSize
+			reloadFont = true
+		case "mask_alpha":
+			sess.style.MaskAlpha = *maskAlpha
+		case "mask_outline":
+			sess.style.MaskOutline = *maskOutline
+		}
+	})
+	if reloadFont {
+		if err := sess.style.LoadFont(); err != nil {
+			log.Println("讀取字型失敗: ", err)
+			return
+		}
+	}
+
+	if sess.colors, err = utils.PaletteColors(sess.names, *palette); err != nil {
+		log.Println(err)
+		return
+	}
+	if *colorMap != "" {
+		colors, err := utils.LoadColorMap(*colorMap)
+		if err != nil {
+			log.Println("讀取顏色設定失敗: ", err)
+			return
+		}
+		if sess.style.Colors == nil {
+			sess.style.Colors = map[string]color.RGBA{}
+		}
+		for name, c := range colors {
+			sess.style.Colors[name] = c
+		}
+	}
+
+	if *sliceSize > 0 {
+		opt := utils.DefaultSliceOption()
+		opt.Width, opt.Height = *sliceSize, *sliceSize
+		opt.Overlap = *sliceOverlap
+		opt.FullImage = *sliceFull
+		opt.Merge = *sliceMerge
+		sess.slice = &opt
+	}
+	sess.mask = MaskOption{
+		Threshold: float32(*maskThreshold),
+		Retina:    *retinaMasks,
+		Bitmap:    *maskBitmap,
+		Polygons:  *maskPolygons,
+		RLE:       *maskRLE,
+	}
+	sess.letterbox = *letterbox
+
+	cutoutOpt := CutoutOption{Feather: *cutoutFeather, Crops: *cutoutCrops}
+	if *cutoutMode {
+		cutoutOpt.Background, cutoutOpt.Color, err = parse_background(*cutoutBg)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if *cutoutClasses != "" {
+			cutoutOpt.Classes = utils.SplitList(*cutoutClasses)
+		}
+		sess.mask.Bitmap = true
+	}
+
+	sess.iou = float32(*iou)
+	if *show {
+		sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		if err := sess.show(sig, *input, float32(threshold)); err != nil {
+			log.Println("inference failed:", err)
+		}
+		return
+	}
+
 	sig, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	if *redactMode {
+		opt := utils.DefaultRedactOption()
+		opt.Method = *redactMethod
+		opt.Level = *redactLevel
+		opt.Padding = *redactPadding
+		if opt.Color, err = utils.ParseHexColor(*redactColor); err != nil {
+			log.Println(err)
+			return
+		}
+		if *redactClasses != "" {
+			opt.Classes = utils.SplitList(*redactClasses)
+		}
+		if *redactMask {
+			sess.mask.Bitmap = true
+		}
+		output := *redactOutput
+		if output == "" {
+			output = "result_redact.jpg"
+			if utils.IsVideo(*input) {
+				output = "result_redact.mp4"
+			}
+		}
+		audit, err := sess.redact_file(sig, *input, output, float32(threshold), opt, *redactMask)
+		if err != nil {
+			log.Println("redact failed:", err)
+		}
+		if err := save_json(*redactAudit, audit); err != nil {
+			log.Println("儲存 JSON 失敗: ", err)
+			return
+		}
+		fmt.Printf("redact %d objects in %d frames. and saved to %s\n", len(audit.Records), audit.Frames, output)
+		return
+	}
+
 	for i := 0; i < 5; i++ {
 		select {
 		case <-sig.Done():
@@ -59,9 +235,45 @@ func main() {
 			log.Println("inference failed:", err)
 			return
 		}
+		if *maskBitmap {
+			for i, obj := range objs {
+				mask := obj.Bitmap.ToMat(img.Cols(), img.Rows())
+				gocv.IMWrite(fmt.Sprintf("result_seg_mask_%d.png", i), mask)
+				mask.Close()
+			}
+		}
+		if *jsonFile != "" {
+			if *maskRLE {
+				for i := range objs {
+					objs[i].encode_rle(img.Cols(), img.Rows())
+				}
+			}
+			if err := save_json(*jsonFile, objs); err != nil {
+				log.Println("儲存 JSON 失敗: ", err)
+				img.Close()
+				return
+			}
+		}
+		if *cutoutMode {
+			result, crops := cutout(img, objs, cutoutOpt)
+			gocv.IMWrite("result_seg_cutout.png", result)
+			result.Close()
+			for i, crop := range crops {
+				gocv.IMWrite(fmt.Sprintf("result_seg_cutout_%d.png", i), crop)
+				crop.Close()
+			}
+		}
 		sess.draw(&img, objs)
 		gocv.IMWrite("result_seg.jpg", img)
 		img.Close()
 		fmt.Printf("detect %d objects. and saved to result_seg.jpg\n", len(objs))
 	}
 }
+
+func save_json(filename string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+type MaskOption struct {
+	Threshold float32 // sigmoid 後的遮罩門檻
+	Retina    bool    // 先把原型放大到原圖解析度再裁切框, 邊緣較精細
+	Bitmap    bool    // 保留全解析度的二值遮罩, 並計算像素面積
+	Polygons  bool    // 以 RetrievalCComp 輸出所有外輪廓及孔洞
+	RLE       bool    // 輸出 COCO RLE (需要二值遮罩)
+}
+
+// decode_mask 依 Ultralytics 8.0 的方式解碼單一物件的遮罩 (prob 為 sigmoid 後 [160 160] 的遮罩):
+// process_mask 在原型空間把框外清成 0, 雙線性內插到模型輸入後以門檻二值化,
+// 再如 scale_masks 去掉補邊並內插回原圖. Retina 時對應 process_mask_native: 原型去掉補邊直接內插到原圖,
+// 以原圖座標的框裁切後二值化. inputBox 為模型輸入座標的框, imgSize 為原圖大小, 回傳 box 大小的 CV8U 二值遮罩
+func (sess *Session_SEG) decode_mask(
+	prob gocv.Mat,
+	inputBox [4]float32,
+	box image.Rectangle,
+	xFactor, yFactor float32,
+	pad, imgSize image.Point,
+) gocv.Mat {
+	data, err := prob.DataPtrFloat32()
+	if err != nil || box.Empty() {
+		return gocv.Zeros(box.Dy(), box.Dx(), gocv.MatTypeCV8U)
+	}
+	buf := sess.decode_mask_bytes(data, image.Pt(prob.Cols(), prob.Rows()), inputBox, box, xFactor, yFactor, pad, imgSize)
+	mask, err := gocv.NewMatFromBytes(box.Dy(), box.Dx(), gocv.MatTypeCV8U, buf)
+	if err != nil {
+		return gocv.Zeros(box.Dy(), box.Dx(), gocv.MatTypeCV8U)
+	}
+	return mask
+}
+
+// decode_mask_bytes decode_mask 的計算, 以 float32 照 torch 的運算順序, 結果與 Ultralytics 逐像素相同
+func (sess *Session_SEG) decode_mask_bytes(
+	prob []float32, protoSize image.Point,
+	inputBox [4]float32,
+	box image.Rectangle,
+	xFactor, yFactor float32,
+	pad, imgSize image.Point,
+) []byte {
+	mask := make([]byte, box.Dx()*box.Dy())
+	if box.Empty() {
+		return mask
+	}
+	if sess.mask.Retina {
+		// 原圖座標的框, 與 process_output 的算法相同但不取整數
+		x1 := clampf((inputBox[0]-float32(pad.X))*xFactor, float32(imgSize.X))
+		y1 := clampf((inputBox[1]-float32(pad.Y))*yFactor, float32(imgSize.Y))
+		x2 := clampf((inputBox[2]-float32(pad.X))*xFactor, float32(imgSize.X))
+		y2 := clampf((inputBox[3]-float32(pad.Y))*yFactor, float32(imgSize.Y))
+		src := unpad_rect(protoSize, imgSize, sess.letterbox)
+		xs := resize_indices(src.Dx(), imgSize.X, box.Min.X, box.Max.X)
+		ys := resize_indices(src.Dy(), imgSize.Y, box.Min.Y, box.Max.Y)
+		at := func(x, y int) float32 { return prob[(src.Min.Y+y)*protoSize.X+src.Min.X+x] }
+		for j, sy := range ys {
+			y := float32(box.Min.Y + j)
+			if y < y1 || y >= y2 {
+				continue
+			}
+			for i, sx := range xs {
+				x := float32(box.Min.X + i)
+				if x < x1 || x >= x2 {
+					continue
+				}
+				if lerp2(at, sx, sy) > sess.mask.Threshold {
+					mask[j*box.Dx()+i] = 255
+				}
+			}
+		}
+		return mask
+	}
+
+	// process_mask: 原型空間的框 (float32), 保留 x1 <= c < x2, y1 <= r < y2
+	sx := float32(protoSize.X) / float32(sess.inputSize.X)
+	sy := float32(protoSize.Y) / float32(sess.inputSize.Y)
+	px1, py1, px2, py2 := inputBox[0]*sx, inputBox[1]*sy, inputBox[2]*sx, inputBox[3]*sy
+	cropped := func(x, y int) float32 {
+		if float32(x) < px1 || float32(x) >= px2 || float32(y) < py1 || float32(y) >= py2 {
+			return 0
+		}
+		return prob[y*protoSize.X+x]
+	}
+	// 放大到模型輸入並二值化, 只算 box 用得到的範圍
+	src := unpad_rect(sess.inputSize, imgSize, sess.letterbox)
+	xs := resize_indices(src.Dx(), imgSize.X, box.Min.X, box.Max.X)
+	ys := resize_indices(src.Dy(), imgSize.Y, box.Min.Y, box.Max.Y)
+	need := image.Rect(xs[0].i0, ys[0].i0, xs[len(xs)-1].i1+1, ys[len(ys)-1].i1+1).Add(src.Min)
+	ux := resize_indices(protoSize.X, sess.inputSize.X, need.Min.X, need.Max.X)
+	uy := resize_indices(protoSize.Y, sess.inputSize.Y, need.Min.Y, need.Max.Y)
+	binary := make([]float32, need.Dx()*need.Dy())
+	for j, iy := range uy {
+		for i, ix := range ux {
+			if lerp2(cropped, ix, iy) > sess.mask.Threshold {
+				binary[j*need.Dx()+i] = 1
+			}
+		}
+	}
+	// scale_masks: 二值遮罩內插回原圖, 超過 0.5 為前景
+	off := src.Min.Sub(need.Min)
+	at := func(x, y int) float32 { return binary[(off.Y+y)*need.Dx()+off.X+x] }
+	for j, iy := range ys {
+		for i, ix := range xs {
+			if lerp2(at, ix, iy) > 0.5 {
+				mask[j*box.Dx()+i] = 255
+			}
+		}
+	}
+	return mask
+}
+
+// unpad_rect scale_masks 去掉補邊後的範圍: size 為遮罩大小, 以 float64 計算並截成整數, 與 Python 相同
+func unpad_rect(size, imgSize image.Point, letterbox bool) image.Rectangle {
+	if !letterbox {
+		return image.Rect(0, 0, size.X, size.Y)
+	}
+	gain := math.Min(float64(size.Y)/float64(imgSize.Y), float64(size.X)/float64(imgSize.X))
+	padX := (float64(size.X) - float64(imgSize.X)*gain) / 2
+	padY := (float64(size.Y) - float64(imgSize.Y)*gain) / 2
+	return image.Rect(int(padX), int(padY), int(float64(size.X)-padX), int(float64(size.Y)-padY))
+}
+
+// lerpIndex 輸出像素在輸入上的兩個鄰居及權重
+type lerpIndex struct {
+	i0, i1 int
+	lambda float32
+}
+
+// resize_indices 與 torch F.interpolate(mode="bilinear", align_corners=False) 相同,
+// 以 float32 算出大小 in 放大或縮小到 out 時, 輸出第 from ~ to-1 個像素的取樣位置
+func resize_indices(in, out, from, to int) []lerpIndex {
+	scale := float32(in) / float32(out)
+	indices := make([]lerpIndex, 0, to-from)
+	for dst := from; dst < to; dst++ {
+		src := float32(scale*(float32(dst)+0.5)) - 0.5
+		if src < 0 {
+			src = 0
+		}
+		i0 := int(src)
+		if i0 > in-1 {
+			i0 = in - 1
+		}
+		idx := lerpIndex{i0: i0, i1: i0, lambda: src - float32(i0)}
+		if i0 < in-1 {
+			idx.i1 = i0 + 1
+		}
+		indices = append(indices, idx)
+	}
+	return indices
+}
+
+// lerp2 雙線性內插, 乘法各自轉成 float32 避免被合併成 FMA
+func lerp2(at func(x, y int) float32, x, y lerpIndex) float32 {
+	x0, x1 := 1-x.lambda, x.lambda
+	top := float32(at(x.i0, y.i0)*x0) + float32(at(x.i1, y.i0)*x1)
+	bottom := float32(at(x.i0, y.i1)*x0) + float32(at(x.i1, y.i1)*x1)
+	return float32(top*(1-y.lambda)) + float32(bottom*y.lambda)
+}
+
+func clampf(v, max float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// fill_mask 由框內的二值遮罩填入輪廓, 依設定再填入多邊形及全解析度遮罩
+func (sess *Session_SEG) fill_mask(obj *SegmentObject, mask gocv.Mat) {
+	obj.Mask = utils.LargestContour(mask, obj.Box.Min)
+	if sess.mask.Polygons {
+		obj.Polygons = utils.ContourPolygons(mask, obj.Box.Min)
+	}
+	if sess.mask.Bitmap || sess.mask.RLE {
+		obj.Bitmap = utils.NewBitmask(mask, obj.Box.Min)
+		obj.Area = obj.Bitmap.Area()
+	}
+}
+
+// translate 把框及遮罩平移 offset
+func (obj *SegmentObject) translate(offset image.Point) {
+	obj.Box = obj.Box.Add(offset)
+	for i := range obj.Mask {
+		obj.Mask[i] = obj.Mask[i].Add(offset)
+	}
+	for i := range obj.Polygons {
+		polygon := &obj.Polygons[i]
+		for k := range polygon.Outer {
+			polygon.Outer[k] = polygon.Outer[k].Add(offset)
+		}
+		for _, hole := range polygon.Holes {
+			for k := range hole {
+				hole[k] = hole[k].Add(offset)
+			}
+		}
+	}
+	if obj.Bitmap != nil {
+		obj.Bitmap.Rect = obj.Bitmap.Rect.Add(offset)
+	}
+}
+
+// merge 把同一個物件在多個切片上的遮罩取聯集
+func (obj *SegmentObject) merge(others []SegmentObject, box image.Rectangle) {
+	obj.Box = box
+	masks := [][]image.Point{}
+	bitmaps := []*utils.Bitmask{}
+	for _, other := range others {
+		masks = append(masks, other.Mask)
+		if other.Bitmap != nil {
+			bitmaps = append(bitmaps, other.Bitmap)
+		}
+	}
+
+	if len(bitmaps) == 0 {
+		obj.Mask = utils.MergePolygons(masks, box)
+		return
+	}
+
+	obj.Bitmap = utils.MergeBitmasks(bitmaps)
+	obj.Area = obj.Bitmap.Area()
+	union := obj.Bitmap.Mat()
+	defer union.Close()
+	obj.Mask = utils.LargestContour(union, obj.Bitmap.Rect.Min)
+	if obj.Polygons != nil {
+		obj.Polygons = utils.ContourPolygons(union, obj.Bitmap.Rect.Min)
+	}
+}
+
+// encode_rle 以原圖大小把二值遮罩編碼成 COCO RLE
+func (obj *SegmentObject) encode_rle(imageWidth, imageHeight int) {
+	if obj.Bitmap == nil {
+		return
+	}
+	rle := obj.Bitmap.RLE(imageWidth, imageHeight)
+	obj.RLE = &rle
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"os"
+	"testing"
+
+	"go-onnxruntime-example/pkg/gocv"
+)
+
+// blockProb [160 160] 的遮罩, rect 內為 1 其餘為 0
+func blockProb(rect image.Rectangle) gocv.Mat {
+	prob := gocv.Zeros(160, 160, gocv.MatTypeCV32F)
+	region := prob.Region(rect)
+	region.SetTo(gocv.NewScalar(1, 0, 0, 0))
+	region.Close()
+	return prob
+}
+
+// 原型上剛好對齊框的方塊, 解碼後框內除了四個角都是前景:
+// 放大 4 倍的雙線性內插在角落為 (5/8)^2 < 0.5, Ultralytics 也一樣
+func TestDecodeMaskBlock(t *testing.T) {
+	cases := []struct {
+		name     string
+		letter   bool
+		retina   bool
+		proto    image.Rectangle
+		inputBox [4]float32
+		box      image.Rectangle
+		pad      image.Point
+		img      image.Point
+	}{
+		{"stretch", false, false, image.Rect(40, 40, 80, 80), [4]float32{160, 160, 320, 320}, image.Rect(160, 160, 320, 320), image.Point{}, image.Pt(640, 640)},
+		{"stretch retina", false, true, image.Rect(40, 40, 80, 80), [4]float32{160, 160, 320, 320}, image.Rect(160, 160, 320, 320), image.Point{}, image.Pt(640, 640)},
+		{"letterbox", true, false, image.Rect(40, 60, 80, 100), [4]float32{160, 240, 320, 400}, image.Rect(160, 160, 320, 320), image.Pt(0, 80), image.Pt(640, 480)},
+		{"letterbox retina", true, true, image.Rect(40, 60, 80, 100), [4]float32{160, 240, 320, 400}, image.Rect(160, 160, 320, 320), image.Pt(0, 80), image.Pt(640, 480)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sess := &Session_SEG{inputSize: image.Pt(640, 640), mask: MaskOption{Threshold: 0.5, Retina: c.retina}, letterbox: c.letter}
+			prob := blockProb(c.proto)
+			defer prob.Close()
+			mask := sess.decode_mask(prob, c.inputBox, c.box, 1, 1, c.pad, c.img)
+			defer mask.Close()
+			if mask.Cols() != c.box.Dx() || mask.Rows() != c.box.Dy() {
+				t.Fatalf("mask size %dx%d, want %dx%d", mask.Cols(), mask.Rows(), c.box.Dx(), c.box.Dy())
+			}
+			if n := gocv.CountNonZero(mask); n != c.box.Dx()*c.box.Dy()-4 {
+				t.Errorf("foreground %d, want %d", n, c.box.Dx()*c.box.Dy()-4)
+			}
+			w, h := c.box.Dx()-1, c.box.Dy()-1
+			for _, corner := range []image.Point{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+				if mask.GetUCharAt(corner.Y, corner.X) != 0 {
+					t.Errorf("corner %v is foreground", corner)
+				}
+			}
+		})
+	}
+}
+
+// 框只蓋到原型方塊的一半時, 非 retina 在原型空間裁切, 方塊外的部分不應該出現
+func TestDecodeMaskCropsInProtoSpace(t *testing.T) {
+	sess := &Session_SEG{inputSize: image.Pt(640, 640), mask: MaskOption{Threshold: 0.5}}
+	prob := blockProb(image.Rect(0, 0, 160, 160))
+	defer prob.Close()
+	box := image.Rect(160, 160, 320, 320)
+	mask := sess.decode_mask(prob, [4]float32{160, 160, 240, 320}, box, 1, 1, image.Point{}, image.Pt(640, 640))
+	defer mask.Close()
+	left := mask.Region(image.Rect(0, 0, 80, 160))
+	right := mask.Region(image.Rect(84, 0, 160, 160))
+	defer left.Close()
+	defer right.Close()
+	if n := gocv.CountNonZero(left); n != 80*160-4 {
+		t.Errorf("inside the input box %d, want %d", n, 80*160-4)
+	}
+	if n := gocv.CountNonZero(right); n != 0 {
+		t.Errorf("outside the input box %d, want 0", n)
+	}
+}
+
+type maskFixture struct {
+	Generator string  `json:"generator"`
+	Input     [2]int  `json:"input"`
+	Image     [2]int  `json:"image"`
+	Pad       [2]int  `json:"pad"`
+	Factor    float32 `json:"factor"`
+	Threshold float32 `json:"threshold"`
+	Objects   []struct {
+		Prob      string     `json:"prob"`
+		InputBox  [4]float32 `json:"input_box"`
+		Box       [4]int     `json:"box"`
+		Letterbox []int      `json:"letterbox"`
+		Retina    []int      `json:"retina"`
+	} `json:"objects"`
+}
+
+// probMat 把 base64 的 little-endian float32 轉成 [160 160] 的 Mat
+func probMat(t *testing.T, s string) gocv.Mat {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mat, err := gocv.NewMatFromBytes(160, 160, gocv.MatTypeCV32F, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mat
+}
+
+// runsMask 把 row-major 的 run length (從 0 開始) 展開成 0 / 255
+func runsMask(counts []int, size int) []byte {
+	mask := make([]byte, 0, size)
+	v := byte(0)
+	for _, n := range counts {
+		for i := 0; i < n; i++ {
+			mask = append(mask, v)
+		}
+		v = 255 - v
+	}
+	return mask
+}
+
+// maxEdgeDiff 容許不同的像素數. 兩邊都以 float32 照 torch 的運算順序內插,
+// 只有 torch 的向量化迴圈把乘加合併成 FMA, 或 sigmoid 差 1 ulp 時, 剛好落在門檻上的邊緣像素可能不同
+const maxEdgeDiff = 8
+
+// 與 Ultralytics 的遮罩逐像素比較 (testdata/export_masks.py 產生, 檔案中的 generator 記錄來源),
+// 不同的像素必須在參考遮罩的邊緣上, 而且最多 maxEdgeDiff 個
+func TestDecodeMaskMatchesUltralytics(t *testing.T) {
+	b, err := os.ReadFile("testdata/ultralytics_masks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := maskFixture{}
+	if err := json.Unmarshal(b, &fixture); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("reference masks from", fixture.Generator)
+
+	for _, retina := range []bool{false, true} {
+		sess := &Session_SEG{
+			inputSize: image.Pt(fixture.Input[0], fixture.Input[1]),
+			mask:      MaskOption{Threshold: fixture.Threshold, Retina: retina},
+			letterbox: true,
+		}
+		for i, obj := range fixture.Objects {
+			box := image.Rect(obj.Box[0], obj.Box[1], obj.Box[2], obj.Box[3])
+			prob := probMat(t, obj.Prob)
+			mask := sess.decode_mask(prob, obj.InputBox, box, fixture.Factor, fixture.Factor,
+				image.Pt(fixture.Pad[0], fixture.Pad[1]), image.Pt(fixture.Image[0], fixture.Image[1]))
+			got, err := mask.DataPtrUint8()
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := obj.Letterbox
+			if retina {
+				counts = obj.Retina
+			}
+			want := runsMask(counts, box.Dx()*box.Dy())
+			if len(want) != len(got) {
+				t.Fatalf("retina=%t object %d: reference has %d pixels, want %d", retina, i, len(want), len(got))
+			}
+			diff := 0
+			for k := range got {
+				if got[k] == want[k] {
+					continue
+				}
+				diff++
+				if x, y := k%box.Dx(), k/box.Dx(); !onEdge(want, box.Dx(), box.Dy(), x, y) {
+					t.Errorf("retina=%t object %d: pixel (%d, %d) differs inside a region", retina, i, box.Min.X+x, box.Min.Y+y)
+				}
+			}
+			if diff > maxEdgeDiff {
+				t.Errorf("retina=%t object %d: %d pixels differ, want <= %d", retina, i, diff, maxEdgeDiff)
+			}
+			prob.Close()
+			mask.Close()
+		}
+	}
+}
+
+// onEdge 像素的上下左右是否有不同的值
+func onEdge(mask []byte, w, h, x, y int) bool {
+	v := mask[y*w+x]
+	for _, d := range []image.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		nx, ny := x+d.X, y+d.Y
+		if nx >= 0 && ny >= 0 && nx < w && ny < h && mask[ny*w+nx] != v {
+			return true
+		}
+	}
+	return false
+}
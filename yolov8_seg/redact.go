@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// redact 分割單張畫面並匿名化符合類別的物件, useMask 時只處理遮罩內 (需要 MaskOption.Bitmap)
+func (sess *Session_SEG) redact(img *gocv.Mat, frame int, threshold float32, opt utils.RedactOption, useMask bool) (
+	[]utils.RedactRecord, error,
+) {
+	objs, err := sess.predict_image(*img, threshold)
+	if err != nil {
+		return nil, err
+	}
+	records := []utils.RedactRecord{}
+	for _, obj := range objs {
+		if !opt.Match(obj.Label) {
+			continue
+		}
+		var mask *gocv.Mat
+		if useMask && obj.Bitmap != nil {
+			m := obj.Bitmap.ToMat(img.Cols(), img.Rows())
+			mask = &m
+		}
+		rect := utils.Redact(img, obj.Box, mask, opt)
+		if mask != nil {
+			mask.Close()
+		}
+		if rect.Empty() {
+			continue
+		}
+		records = append(records, utils.RedactRecord{
+			Frame: frame,
+			ID:    obj.ID,
+			Label: obj.Label,
+			Score: obj.Score,
+			Box:   rect,
+			Mask:  mask != nil,
+		})
+	}
+	return records, nil
+}
+
+// redact_file 匿名化圖片或影片並寫到 output, ctx 取消時停止並回傳已處理的部分
+func (sess *Session_SEG) redact_file(ctx context.Context, input, output string, threshold float32, opt utils.RedactOption, useMask bool) (
+	utils.RedactAudit, error,
+) {
+	return utils.RedactFile(ctx, input, output, opt, func(img *gocv.Mat, frame int) ([]utils.RedactRecord, error) {
+		return sess.redact(img, frame, threshold, opt, useMask)
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image"
+
+	"go-onnxruntime-example/pkg/gocv"
+	"go-onnxruntime-example/pkg/utils"
+)
+
+// predict_sliced 將大圖切成互相重疊的切片分別推論 (SAHI),
+// 把框和遮罩平移回原圖座標後, 在切片接縫處以 NMS 或 NMM 合併
+func (sess *Session_SEG) predict_sliced(img gocv.Mat, threshold float32, opt utils.SliceOption) (
+	[]SegmentObject, error,
+) {
+	candidates := []SegmentObject{}
+	rects := utils.SliceRects(img.Cols(), img.Rows(), opt)
+	for _, rect := range rects {
+		region := img.Region(rect)
+		tile := region.Clone()
+		region.Close()
+		objs, err := sess.predict(tile, threshold)
+		tile.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			obj.translate(rect.Min)
+			candidates = append(candidates, obj)
+		}
+	}
+
+	if opt.FullImage && len(rects) > 1 {
+		objs, err := sess.predict(img, threshold)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, objs...)
+	}
+
+	objs := []SegmentObject{}
+	if len(candidates) == 0 {
+		return objs, nil
+	}
+
+	boxes := make([]image.Rectangle, len(candidates))
+	scores := make([]float32, len(candidates))
+	classIds := make([]int, len(candidates))
+	for i, obj := range candidates {
+		boxes[i] = obj.Box
+		scores[i] = obj.Score
+		classIds[i] = obj.ID
+	}
+
+	switch opt.Merge {
+	case "nmm":
+		merged, groups := utils.NonMaxMerge(boxes, scores, classIds, opt.MatchMetric, opt.MatchThresh)
+		for i, box := range merged {
+			obj := candidates[groups[i][0]]
+			if len(groups[i]) > 1 {
+				others := make([]SegmentObject, 0, len(groups[i]))
+				for _, idx := range groups[i] {
+					others = append(others, candidates[idx])
+				}
+				obj.merge(others, box)
+			}
+			objs = append(objs, obj)
+		}
+	default:
+		indices := gocv.NMSBoxes(boxes, scores, threshold, opt.MatchThresh)
+		for _, idx := range indices {
+			objs = append(objs, candidates[idx])
+		}
+	}
+
+	return objs, nil
+}
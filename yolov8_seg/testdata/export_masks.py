@@ -0,0 +1,228 @@
+# 產生 mask_test.go 使用的 Ultralytics 參考遮罩, 在 yolov8_seg 下執行
+#   python testdata/export_masks.py
+# 以固定亂數產生原型及係數, 分別以 process_mask + scale_masks (letterbox 路徑) 及 process_mask_native (retina_masks)
+# 解碼, 把 sigmoid 後的 [160 160] 遮罩及原圖座標下框內的參考遮罩 (row-major 的 run length, 從 0 開始) 寫到
+# testdata/ultralytics_masks.json.
+#
+# 有安裝 ultralytics (8.0.x, pip install "ultralytics<8.1") 時以它的 ops 產生, 並印出與下面移植版的差異;
+# 沒有時使用只依賴標準函式庫的移植版: 照 ultralytics 8.0 ops.py 的 crop_mask, process_mask, process_mask_native,
+# scale_masks 以及 torch F.interpolate(mode="bilinear", align_corners=False) 的 float32 運算順序.
+# 檔案中的 "generator" 記錄是哪一種產生的.
+import base64
+import json
+import math
+import random
+import struct
+
+_f32 = struct.Struct("<f")
+
+
+def f32(x):
+    return _f32.unpack(_f32.pack(x))[0]
+
+
+orig_h, orig_w = 1080, 810  # bus.jpg
+input_h, input_w = 640, 640
+proto_h, proto_w = 160, 160
+threshold = 0.5
+
+# 與 utils.Letterbox 及 prepare_input 相同
+gain = min(input_w / orig_w, input_h / orig_h)
+pad_w = (input_w - round(orig_w * gain)) // 2
+pad_h = (input_h - round(orig_h * gain)) // 2
+factor = f32(1 / gain)
+
+rng = random.Random(0)
+# 低頻的原型比較像真實模型的輸出, 遮罩才會是成塊的: 9x9 平均 (補 0, 除以 81) 後乘 6
+noise = [[[rng.gauss(0, 1) for _ in range(proto_w)] for _ in range(proto_h)] for _ in range(32)]
+
+
+def box_blur(img, k=9):
+    r = k // 2
+    rows = [[sum(row[max(0, x - r):x + r + 1]) for x in range(proto_w)] for row in img]
+    return [
+        [sum(rows[yy][x] for yy in range(max(0, y - r), min(proto_h, y + r + 1))) / (k * k) * 6 for x in range(proto_w)]
+        for y in range(proto_h)
+    ]
+
+
+protos = [[[f32(v) for v in row] for row in box_blur(p)] for p in noise]
+coeffs = [[f32(rng.gauss(0, 1)) for _ in range(32)] for _ in range(3)]
+input_boxes = [
+    [120.0, 60.0, 400.0, 520.0],
+    [300.5, 200.25, 560.75, 600.5],
+    [90.0, 330.0, 250.0, 470.0],
+]
+
+
+def sigmoid_mask(c):
+    return [
+        [f32(1 / (1 + math.exp(-sum(c[k] * protos[k][y][x] for k in range(32))))) for x in range(proto_w)]
+        for y in range(proto_h)
+    ]
+
+
+probs = [sigmoid_mask(c) for c in coeffs]
+
+
+# 原圖座標的框, 與 inference.go 相同: (模型座標 - pad) * factor 以 float32 計算, 再以 NormalizePoint 四捨五入
+def orig_coord(v, pad, size):
+    return min(max(f32(f32(v - pad) * factor), 0.0), float(size))
+
+
+def normalize_point(v, size):
+    return min(max(int(math.floor(v + 0.5)), 0), size)
+
+
+orig_boxes = [
+    [orig_coord(b[0], pad_w, orig_w), orig_coord(b[1], pad_h, orig_h), orig_coord(b[2], pad_w, orig_w), orig_coord(b[3], pad_h, orig_h)]
+    for b in input_boxes
+]
+int_boxes = [
+    [normalize_point(b[0], orig_w), normalize_point(b[1], orig_h), normalize_point(b[2], orig_w), normalize_point(b[3], orig_h)]
+    for b in orig_boxes
+]
+
+
+# ---- ultralytics 8.0 ops 的移植 ----
+
+
+def interp_indices(size_in, size_out):
+    # torch upsample_bilinear2d (align_corners=False) 的 compute_indices_weights_linear
+    scale = f32(size_in / size_out)
+    out = []
+    for dst in range(size_out):
+        src = max(f32(f32(scale * (dst + 0.5)) - 0.5), 0.0)
+        i0 = min(int(src), size_in - 1)
+        i1 = i0 + 1 if i0 < size_in - 1 else i0
+        out.append((i0, i1, f32(src - i0)))
+    return out
+
+
+def interpolate(mask, out_h, out_w, rows=None, cols=None):
+    # F.interpolate(mode="bilinear", align_corners=False), rows, cols 只算需要的輸出範圍
+    ys = interp_indices(len(mask), out_h)
+    xs = interp_indices(len(mask[0]), out_w)
+    rows = rows or range(out_h)
+    cols = cols or range(out_w)
+    out = []
+    for y in rows:
+        y0, y1, ly = ys[y]
+        line = []
+        for x in cols:
+            x0, x1, lx = xs[x]
+            wx0 = f32(1 - lx)
+            top = f32(f32(mask[y0][x0] * wx0) + f32(mask[y0][x1] * lx))
+            bottom = f32(f32(mask[y1][x0] * wx0) + f32(mask[y1][x1] * lx))
+            line.append(f32(f32(top * f32(1 - ly)) + f32(bottom * ly)))
+        out.append(line)
+    return out
+
+
+def crop_mask(mask, box, rows, cols):
+    # crop_mask: 保留 x1 <= c < x2, y1 <= r < y2
+    x1, y1, x2, y2 = box
+    return [[v if x1 <= c < x2 and y1 <= r < y2 else 0.0 for c, v in zip(cols, line)] for r, line in zip(rows, mask)]
+
+
+def unpad(mask, shape):
+    # scale_masks 去掉補邊: gain 及 pad 以 Python float 計算後以 int() 截斷
+    mh, mw = len(mask), len(mask[0])
+    g = min(mh / shape[0], mw / shape[1])
+    pw, ph = (mw - shape[1] * g) / 2, (mh - shape[0] * g) / 2
+    top, left, bottom, right = int(ph), int(pw), int(mh - ph), int(mw - pw)
+    return [line[left:right] for line in mask[top:bottom]]
+
+
+def port_letterbox(prob, input_box, box):
+    # process_mask(upsample=True): 原型空間的框為 float32 乘上 mw / iw
+    s = f32(proto_w / input_w), f32(proto_h / input_h)
+    proto_box = [f32(input_box[0] * s[0]), f32(input_box[1] * s[1]), f32(input_box[2] * s[0]), f32(input_box[3] * s[1])]
+    cropped = crop_mask(prob, proto_box, range(proto_h), range(proto_w))
+    binary = [[1.0 if v > threshold else 0.0 for v in line] for line in interpolate(cropped, input_h, input_w)]
+    # scale_masks(masks, (h, w)) > 0.5, 只取框內
+    x1, y1, x2, y2 = box
+    scaled = interpolate(unpad(binary, (orig_h, orig_w)), orig_h, orig_w, range(y1, y2), range(x1, x2))
+    return [[v > 0.5 for v in line] for line in scaled]
+
+
+def port_retina(prob, orig_box, box):
+    # process_mask_native: scale_masks 到原圖, crop_mask 原圖座標的框, 再以門檻二值化
+    x1, y1, x2, y2 = box
+    scaled = interpolate(unpad(prob, (orig_h, orig_w)), orig_h, orig_w, range(y1, y2), range(x1, x2))
+    cropped = crop_mask(scaled, orig_box, range(y1, y2), range(x1, x2))
+    return [[v > threshold for v in line] for line in cropped]
+
+
+def ultralytics_masks():
+    import torch
+    import ultralytics
+    from ultralytics.utils import ops
+
+    p = torch.tensor(protos, dtype=torch.float32)
+    c = torch.tensor(coeffs, dtype=torch.float32)
+    ib = torch.tensor(input_boxes, dtype=torch.float32)
+    ob = torch.tensor(orig_boxes, dtype=torch.float32)
+    masks = ops.process_mask(p, c, ib, (input_h, input_w), upsample=True)
+    letterbox = ops.scale_masks(masks[None].float(), (orig_h, orig_w))[0] > 0.5
+    retina = ops.process_mask_native(p, c, ob, (orig_h, orig_w)) > threshold
+    crop = lambda m, b: m[b[1]:b[3], b[0]:b[2]].tolist()
+    return (
+        "ultralytics " + ultralytics.__version__,
+        [crop(letterbox[i], b) for i, b in enumerate(int_boxes)],
+        [crop(retina[i], b) for i, b in enumerate(int_boxes)],
+    )
+
+
+def runs(mask):
+    # row-major 的 run length, 第一段為 0 的數量
+    counts, cur, n = [], False, 0
+    for line in mask:
+        for v in line:
+            if bool(v) != cur:
+                counts.append(n)
+                cur, n = not cur, 0
+            n += 1
+    counts.append(n)
+    return counts
+
+
+def diff(a, b):
+    return sum(x != y for la, lb in zip(a, b) for x, y in zip(la, lb))
+
+
+port = (
+    "ultralytics 8.0 ops port (python stdlib, float32)",
+    [port_letterbox(probs[i], input_boxes[i], b) for i, b in enumerate(int_boxes)],
+    [port_retina(probs[i], orig_boxes[i], b) for i, b in enumerate(int_boxes)],
+)
+try:
+    result = ultralytics_masks()
+    for i in range(len(int_boxes)):
+        print(f"object {i}: port differs in {diff(result[1][i], port[1][i])} letterbox, "
+              f"{diff(result[2][i], port[2][i])} retina pixels")
+except ImportError:
+    result = port
+    print("ultralytics not installed, using the port")
+
+generator, letterbox, retina = result
+fixture = {
+    "generator": generator,
+    "input": [input_w, input_h],
+    "image": [orig_w, orig_h],
+    "pad": [pad_w, pad_h],
+    "factor": factor,
+    "threshold": threshold,
+    "objects": [
+        {
+            "prob": base64.b64encode(b"".join(_f32.pack(v) for line in probs[i] for v in line)).decode(),
+            "input_box": input_boxes[i],
+            "box": int_boxes[i],
+            "letterbox": runs(letterbox[i]),
+            "retina": runs(retina[i]),
+        }
+        for i in range(len(int_boxes))
+    ],
+}
+with open("testdata/ultralytics_masks.json", "w") as f:
+    json.dump(fixture, f)